@@ -70,3 +70,10 @@ type ErrorCtxAsTuple struct {
 		}
 	}
 }
+
+// ErrorCtxTagged has fields whose encoded
+// keys differ from their Go names
+type ErrorCtxTagged struct {
+	Val string             `msg:"val"`
+	Tup ErrorCtxTupleChild `msg:"tup"`
+}
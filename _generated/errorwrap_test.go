@@ -2,7 +2,9 @@ package _generated
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/tinylib/msgp/msgp"
@@ -189,6 +191,90 @@ func TestErrorCtxAsTupleDecode(t *testing.T) {
 	}
 }
 
+// stringOffsets returns the offsets of
+// the strings that dodgifyMsgpString wrecks
+func stringOffsets(bts []byte) []int64 {
+	var out []int64
+	tk := msgp.NewBytesTokenizer(bts)
+	for {
+		tok, err := tk.Next()
+		if err == io.EOF {
+			return out
+		} else if err != nil {
+			panic(err)
+		}
+		if tok.Kind == msgp.StrToken || tok.Kind == msgp.KeyToken {
+			out = append(out, tok.Offset)
+		}
+	}
+}
+
+func TestErrorCtxLocation(t *testing.T) {
+	for name, m := range map[string]interface {
+		msgp.Marshaler
+		msgp.Unmarshaler
+		msgp.Decodable
+	}{
+		"map":   fillErrorCtxAsMap(),
+		"tuple": fillErrorCtxAsTuple(),
+	} {
+		bts := marshalErrorCtx(m)
+		for i, off := range stringOffsets(bts) {
+			dodgeBts := dodgifyMsgpString(bts, i)
+
+			_, uerr := m.UnmarshalMsg(dodgeBts)
+			derr := m.DecodeMsg(msgp.NewReader(bytes.NewReader(dodgeBts)))
+			for _, err := range []error{uerr, derr} {
+				var le msgp.LocatedError
+				if !errors.As(err, &le) {
+					t.Fatalf("%s: %d: %v is not a msgp.LocatedError", name, i, err)
+				}
+				if le.Offset() != off {
+					t.Errorf("%s: %d: got offset %d; wanted %d", name, i, le.Offset(), off)
+				}
+				var path []string
+				for _, p := range le.Path() {
+					path = append(path, p.String())
+				}
+				// the error shows Go names, and the path
+				// shows keys, or indexes for tuple fields
+				var want []string
+				if ctx := strings.TrimPrefix(strings.TrimPrefix(err.Error(), errPrefix), " at "); ctx != "" {
+					want = strings.Split(ctx, "/")
+				}
+				ok := len(path) == len(want)
+				for j := 0; ok && j < len(path); j++ {
+					ok = path[j] == want[j] || (name == "tuple" && le.Path()[j].IsIndex)
+				}
+				if !ok {
+					t.Errorf("%s: %d: got path %q; wanted %q", name, i, path, want)
+				}
+			}
+		}
+	}
+
+	// paths use the encoded keys
+	bts := marshalErrorCtx(&ErrorCtxTagged{Val: "a", Tup: ErrorCtxTupleChild{Val: "b"}})
+	for i, want := range map[int]string{1: "val", 3: "tup/0"} {
+		var ec ErrorCtxTagged
+		_, uerr := ec.UnmarshalMsg(dodgifyMsgpString(bts, i))
+		derr := ec.DecodeMsg(msgp.NewReader(bytes.NewReader(dodgifyMsgpString(bts, i))))
+		for _, err := range []error{uerr, derr} {
+			var le msgp.LocatedError
+			if !errors.As(err, &le) {
+				t.Fatalf("%d: %v is not a msgp.LocatedError", i, err)
+			}
+			var path []string
+			for _, p := range le.Path() {
+				path = append(path, p.String())
+			}
+			if got := strings.Join(path, "/"); got != want {
+				t.Errorf("%d: got path %q; wanted %q (%v)", i, got, want, err)
+			}
+		}
+	}
+}
+
 func diffstrs(a, b []string) (ok bool, as, bs []string) {
 	ma := map[string]bool{}
 	mb := map[string]bool{}
@@ -1385,3 +1385,36 @@ func TestAllowNilZeroCopy(t *testing.T) {
 		}
 	})
 }
+
+func TestTotalBytesBudget(t *testing.T) {
+	// 90 strings of 1KiB are within every per-item limit
+	data := UnlimitedData{BigSlice: make([]string, 90)}
+	for i := range data.BigSlice {
+		data.BigSlice[i] = string(bytes.Repeat([]byte{'x'}, 1024))
+	}
+	var buf bytes.Buffer
+	w := msgp.NewWriter(&buf)
+	if err := data.EncodeMsg(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	var result UnlimitedData
+	reader := msgp.NewReader(bytes.NewReader(buf.Bytes()))
+	reader.SetMaxTotalBytes(64 << 10)
+	err := result.DecodeMsg(reader)
+	if !errors.Is(err, msgp.ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded, got %v", err)
+	}
+
+	reader.Reset(bytes.NewReader(buf.Bytes()))
+	reader.SetMaxTotalBytes(128 << 10)
+	if err := result.DecodeMsg(reader); err != nil {
+		t.Errorf("Unexpected error within budget: %v", err)
+	}
+
+	_, err = msgp.UnmarshalWithLimits(&result, buf.Bytes(), msgp.Limits{MaxTotalBytes: 64 << 10})
+	if !errors.Is(err, msgp.ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Converting to these types removes the generated methods,
+// so MarshalReflect has to use the struct tags.
+type (
+	reflectOmitEmpty0 OmitEmpty0
+	reflectOmitZero0  OmitZero0
+	reflectEmbedded   GetUserRequestWithEmbeddedStruct
+)
+
+func TestReflectMatchesGenerated(t *testing.T) {
+	name := NamedString("n")
+	oe := OmitEmpty0{
+		AInt:         1,
+		AString:      "s",
+		APtrNamedStr: &name,
+		ANamedStruct: NamedStruct{A: "a"},
+		AArrayInt:    [5]int{1},
+		ATime:        time.Unix(1700000000, 0),
+	}
+	oe.EmbeddableStruct.SomeEmbed = "e"
+	oz := OmitZero0{AStruct: OmitZeroA{C: "c"}, BStruct: OmitZeroA{A: "a"}, ANamedStruct: NamedStructOZ{B: "b"}}
+	emb := GetUserRequestWithEmbeddedStruct{Common: Common{RequestID: 1, Token: "t"}, UserID: 2}
+
+	tests := []struct {
+		name      string
+		generated msgp.Marshaler
+		plain     any
+	}{
+		{"omitempty", &oe, (*reflectOmitEmpty0)(&oe)},
+		{"omitempty zero", &OmitEmpty0{}, &reflectOmitEmpty0{}},
+		{"omitzero", &oz, (*reflectOmitZero0)(&oz)},
+		{"flatten", &emb, (*reflectEmbedded)(&emb)},
+	}
+	for _, tt := range tests {
+		want, err := tt.generated.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := msgp.MarshalReflect(nil, tt.plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %x; wanted %x", tt.name, got, want)
+		}
+	}
+
+	raw, _ := emb.MarshalMsg(nil)
+	var out reflectEmbedded
+	if _, err := msgp.UnmarshalReflect(raw, &out); err != nil {
+		t.Fatal(err)
+	}
+	if GetUserRequestWithEmbeddedStruct(out) != emb {
+		t.Errorf("got %+v; wanted %+v", out, emb)
+	}
+}
@@ -10,7 +10,7 @@ import (
 
 func decode(w io.Writer) *decodeGen {
 	return &decodeGen{
-		p:        printer{w: w},
+		p:        printer{w: w, wrapCall: "dc.WrapError(err"},
 		hasfield: false,
 	}
 }
@@ -212,7 +212,7 @@ func (d *decodeGen) structAsTuple(s *Struct) {
 			d.p.printf("\n%s = nil\n} else {", s.Fields[i].FieldElem.Varname())
 		}
 		SetIsAllowNil(fieldElem, anField)
-		d.ctx.PushString(s.Fields[i].FieldName)
+		d.ctx.PushTupleField(s.Fields[i].FieldName, i)
 		setTypeParams(fieldElem, s.typeParams)
 		next(d, fieldElem)
 
@@ -228,7 +228,7 @@ func (d *decodeGen) structAsTuple(s *Struct) {
 		}
 	}
 	if s.AsVarTuple {
-		d.p.printf("\nfor ; %[1]s > 0; %[1]s-- {\nif err = dc.Skip(); err != nil {\nerr = msgp.WrapError(err)\nreturn\n}\n}", sz)
+		d.p.printf("\nfor ; %[1]s > 0; %[1]s-- {\nif err = dc.Skip(); err != nil {\nerr = %[2]s\nreturn\n}\n}", sz, d.p.wrapErr(""))
 		d.p.printf("\n}") // end the block
 	}
 }
@@ -259,7 +259,7 @@ func (d *decodeGen) structAsMap(s *Struct) {
 	d.assignAndCheck("field", mapKey)
 	d.p.print("\nswitch msgp.UnsafeString(field) {")
 	for i := range s.Fields {
-		d.ctx.PushString(s.Fields[i].FieldName)
+		d.ctx.PushField(s.Fields[i].FieldName, s.Fields[i].FieldTag)
 		d.p.printf("\ncase %q:", s.Fields[i].FieldTag)
 		fieldElem := s.Fields[i].FieldElem
 		anField := s.Fields[i].HasTagPart("allownil") && fieldElem.AllowNil()
@@ -206,6 +206,23 @@ func (c contextVar) Arg() string {
 	return string(c)
 }
 
+// contextField is a struct field, which
+// error paths show by its encoded key,
+// or by its index in a tuple
+type contextField struct {
+	name  string
+	key   string
+	index int
+	tuple bool
+}
+
+func (c contextField) Arg() string {
+	if c.tuple {
+		return fmt.Sprintf("msgp.FieldIndex(%q, %d)", c.name, c.index)
+	}
+	return fmt.Sprintf("msgp.FieldKey(%q, %q)", c.name, c.key)
+}
+
 type Context struct {
 	path                   []contextItem
 	compFloats             bool
@@ -228,6 +245,18 @@ func (c *Context) PushVar(s string) {
 	c.path = append(c.path, contextVar(s))
 }
 
+// PushField pushes the struct field 'name',
+// which is encoded with the map key 'key'
+func (c *Context) PushField(name, key string) {
+	c.path = append(c.path, contextField{name: name, key: key})
+}
+
+// PushTupleField pushes the struct field
+// 'name', which is encoded at index 'idx'
+func (c *Context) PushTupleField(name string, idx int) {
+	c.path = append(c.path, contextField{name: name, index: idx, tuple: true})
+}
+
 func (c *Context) Pop() {
 	c.path = c.path[:len(c.path)-1]
 }
@@ -373,6 +402,10 @@ func unsetReceiver(p Elem) {
 type printer struct {
 	w   io.Writer
 	err error
+
+	// wrapCall is the start of the call used to wrap
+	// errors with context, e.g. "msgp.WrapError(err"
+	wrapCall string
 }
 
 // writes "var {{name}} {{typ}};"
@@ -453,15 +486,24 @@ func (p *printer) clearMap(name string) {
 
 func (p *printer) wrapErrCheck(ctx string) {
 	p.print("\nif err != nil {")
-	if ctx != "" {
-		p.printf("\nerr = msgp.WrapError(err, %s)", ctx)
-	} else {
-		p.print("\nerr = msgp.WrapError(err)")
-	}
+	p.printf("\nerr = %s", p.wrapErr(ctx))
 	p.printf("\nreturn")
 	p.print("\n}")
 }
 
+// wrapErr returns the expression that wraps
+// 'err' with context
+func (p *printer) wrapErr(ctx string) string {
+	call := p.wrapCall
+	if call == "" {
+		call = "msgp.WrapError(err"
+	}
+	if ctx != "" {
+		return call + ", " + ctx + ")"
+	}
+	return call + ")"
+}
+
 func (p *printer) resizeSlice(size string, s *Slice) {
 	p.printf("\nif cap(%[1]s) >= int(%[2]s) { %[1]s = (%[1]s)[:%[2]s] } else { %[1]s = make(%[3]s, %[2]s) }", s.Varname(), size, s.TypeName())
 }
@@ -10,7 +10,7 @@ import (
 
 func unmarshal(w io.Writer) *unmarshalGen {
 	return &unmarshalGen{
-		p: printer{w: w},
+		p: printer{w: w, wrapCall: "msgp.WrapErrorBytes(err, o, bts"},
 	}
 }
 
@@ -48,6 +48,9 @@ func (u *unmarshalGen) Execute(p Elem, ctx Context) error {
 	u.p.comment("UnmarshalMsg implements msgp.Unmarshaler")
 
 	u.p.printf("\nfunc (%s %s) UnmarshalMsg(bts []byte) (o []byte, err error) {", p.Varname(), methodReceiver(p))
+	// 'o' holds the input until the end, so that
+	// errors can record their offset within it
+	u.p.print("\no = bts")
 	next(u, p)
 	u.p.print("\no = bts")
 	u.p.nakedReturn()
@@ -231,7 +234,7 @@ func (u *unmarshalGen) tuple(s *Struct) {
 		if !u.p.ok() {
 			return
 		}
-		u.ctx.PushString(s.Fields[i].FieldName)
+		u.ctx.PushTupleField(s.Fields[i].FieldName, i)
 		fieldElem := s.Fields[i].FieldElem
 		anField := s.Fields[i].HasTagPart("allownil") && fieldElem.AllowNil()
 
@@ -269,7 +272,7 @@ func (u *unmarshalGen) tuple(s *Struct) {
 		}
 	}
 	if s.AsVarTuple {
-		u.p.printf("\nfor ; %[1]s > 0; %[1]s-- {\nbts, err = msgp.Skip(bts)\nif err != nil {\nerr = msgp.WrapError(err)\nreturn\n}\n}", sz)
+		u.p.printf("\nfor ; %[1]s > 0; %[1]s-- {\nbts, err = msgp.Skip(bts)\nif err != nil {\nerr = %[2]s\nreturn\n}\n}", sz, u.p.wrapErr(""))
 		u.p.printf("\n}") // end the block
 	}
 }
@@ -321,7 +324,7 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 			return
 		}
 		u.p.printf("\ncase %q:", s.Fields[i].FieldTag)
-		u.ctx.PushString(s.Fields[i].FieldName)
+		u.ctx.PushField(s.Fields[i].FieldName, s.Fields[i].FieldTag)
 
 		fieldElem := s.Fields[i].FieldElem
 		anField := s.Fields[i].HasTagPart("allownil") && fieldElem.AllowNil()
@@ -0,0 +1,294 @@
+package msgp
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// asyncBufSize is the size of the buffers
+// of AsyncWriters and PrefetchReaders
+const asyncBufSize = 64 << 10
+
+var (
+	errWriterClosed = errors.New("msgp: AsyncWriter is closed")
+	errReaderClosed = errors.New("msgp: PrefetchReader is closed")
+)
+
+// AsyncWriter is a Writer that writes to the underlying
+// io.Writer on a background goroutine. When its buffer fills
+// up, the buffer is queued to be written, and encoding continues
+// into the next free buffer, so encoding only waits for the
+// io.Writer when every buffer is queued.
+//
+// The embedded *Writer can be passed to EncodeMsg methods as usual.
+// Its Flush queues the data in the buffer and waits for every queued
+// buffer to be written. The first error returned by the io.Writer
+// is sticky: the buffers queued after it are dropped, and it is returned
+// by the next write that needs to queue a buffer, and by every Flush.
+//
+// An AsyncWriter must be closed to stop its goroutine.
+type AsyncWriter struct {
+	*Writer
+	a *asyncWriter
+}
+
+// NewAsyncWriter returns a new AsyncWriter writing to 'w',
+// with 'bufs' buffers (at least 2) of 64KiB each.
+func NewAsyncWriter(w io.Writer, bufs int) *AsyncWriter {
+	bufs = max(bufs, 2)
+	a := &asyncWriter{
+		w:     w,
+		queue: make(chan asyncBuf, bufs),
+		free:  make(chan []byte, bufs),
+		done:  make(chan struct{}),
+	}
+	for range bufs - 1 {
+		a.free <- make([]byte, 0, asyncBufSize)
+	}
+	go a.run()
+	mw := NewWriterSize(a, asyncBufSize)
+	mw.async = a
+	return &AsyncWriter{Writer: mw, a: a}
+}
+
+// Reset waits for the queued buffers to be written, discards
+// the data in the buffer, and makes the AsyncWriter write to 'w',
+// clearing any error.
+func (aw *AsyncWriter) Reset(w io.Writer) {
+	aw.a.wait()
+	aw.Writer.Reset(aw.a)
+	aw.a.mu.Lock()
+	aw.a.w, aw.a.err = w, nil
+	aw.a.mu.Unlock()
+}
+
+// Close flushes the AsyncWriter and stops its goroutine.
+// It doesn't close the underlying io.Writer. Writes that
+// need to queue a buffer after Close return an error.
+func (aw *AsyncWriter) Close() error {
+	if aw.a.closed {
+		return errWriterClosed
+	}
+	err := aw.Flush()
+	aw.a.closed = true
+	close(aw.a.queue)
+	<-aw.a.done
+	return err
+}
+
+// handoff queues the data in the buffer to be written,
+// and replaces the buffer with a free one
+func (mw *Writer) handoff() error {
+	next, err := mw.async.handoff(mw.buf[:mw.wloc])
+	if err != nil {
+		return err
+	}
+	mw.flushed += int64(mw.wloc)
+	mw.buf = next[:cap(next)]
+	mw.wloc = 0
+	return nil
+}
+
+// asyncBuf is a buffer to write, or
+// a request to be told when the buffers
+// queued before it have been written
+type asyncBuf struct {
+	b   []byte
+	ack chan struct{}
+}
+
+// asyncWriter is the background half of an AsyncWriter.
+// Apart from the goroutine, it is used by one goroutine at
+// a time, like a Writer; 'mu' guards what the two share.
+type asyncWriter struct {
+	queue  chan asyncBuf
+	free   chan []byte
+	done   chan struct{}
+	closed bool
+
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+func (a *asyncWriter) run() {
+	defer close(a.done)
+	for item := range a.queue {
+		if item.ack != nil {
+			close(item.ack)
+			continue
+		}
+		a.mu.Lock()
+		if a.err == nil {
+			_, a.err = a.w.Write(item.b)
+		}
+		a.mu.Unlock()
+		a.free <- item.b[:0]
+	}
+}
+
+func (a *asyncWriter) error() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// handoff queues 'b' and returns a free buffer.
+// If there is an error, 'b' isn't queued.
+func (a *asyncWriter) handoff(b []byte) ([]byte, error) {
+	if a.closed {
+		return b, errWriterClosed
+	}
+	if err := a.error(); err != nil {
+		return b, err
+	}
+	a.queue <- asyncBuf{b: b}
+	return <-a.free, nil
+}
+
+// wait waits for the queued buffers to be written
+func (a *asyncWriter) wait() error {
+	if a.closed {
+		return errWriterClosed
+	}
+	ack := make(chan struct{})
+	a.queue <- asyncBuf{ack: ack}
+	<-ack
+	return a.error()
+}
+
+// Write writes 'p' directly, once the queued buffers have been
+// written. The Writer uses it for data that doesn't go through
+// its buffer, such as payloads that are larger than the buffer.
+func (a *asyncWriter) Write(p []byte) (int, error) {
+	if err := a.wait(); err != nil {
+		return 0, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n, err := a.w.Write(p)
+	a.err = err
+	return n, err
+}
+
+// PrefetchReader is a Reader that reads ahead from the underlying
+// io.Reader on a background goroutine, into one buffer while the
+// other is being decoded, so decoding only waits for the io.Reader
+// when it catches up with it.
+//
+// The embedded *Reader can be passed to DecodeMsg methods as usual.
+// An error from the io.Reader is returned once the data read before
+// it has been consumed, and then on every read.
+//
+// A PrefetchReader must be closed to stop its goroutine, unless
+// the io.Reader returns an error (such as io.EOF) first.
+type PrefetchReader struct {
+	*Reader
+	p *prefetcher
+}
+
+// NewPrefetchReader returns a new PrefetchReader reading from 'r',
+// with two buffers of 64KiB.
+func NewPrefetchReader(r io.Reader) *PrefetchReader {
+	p := newPrefetcher(r)
+	return &PrefetchReader{Reader: NewReader(p), p: p}
+}
+
+// Reset stops reading ahead from the current io.Reader,
+// discards any data that was read ahead, and makes the
+// PrefetchReader read from 'r'.
+func (pr *PrefetchReader) Reset(r io.Reader) {
+	pr.p.close()
+	pr.p = newPrefetcher(r)
+	pr.Reader.Reset(pr.p)
+}
+
+// Close stops reading ahead. It doesn't close the underlying io.Reader,
+// and it doesn't wait for a read from it that is in progress; the data
+// from that read is discarded. Reads after Close return an error.
+func (pr *PrefetchReader) Close() error {
+	if pr.p.closed {
+		return errReaderClosed
+	}
+	pr.p.close()
+	return nil
+}
+
+// prefetchChunk is the result of a read
+type prefetchChunk struct {
+	b   []byte
+	err error
+}
+
+// prefetcher is the background half of a PrefetchReader
+type prefetcher struct {
+	r      io.Reader
+	full   chan prefetchChunk
+	free   chan []byte
+	stop   chan struct{}
+	closed bool
+
+	buf []byte // the buffer being consumed
+	cur []byte // the unread part of buf
+	err error  // the error after buf
+}
+
+func newPrefetcher(r io.Reader) *prefetcher {
+	p := &prefetcher{
+		r:    r,
+		full: make(chan prefetchChunk, 2),
+		free: make(chan []byte, 2),
+		stop: make(chan struct{}),
+	}
+	p.free <- make([]byte, asyncBufSize)
+	p.free <- make([]byte, asyncBufSize)
+	go p.run()
+	return p
+}
+
+func (p *prefetcher) run() {
+	for {
+		var buf []byte
+		select {
+		case buf = <-p.free:
+		case <-p.stop:
+			return
+		}
+		n, err := p.r.Read(buf[:cap(buf)])
+		select {
+		case p.full <- prefetchChunk{b: buf[:n], err: err}:
+		case <-p.stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *prefetcher) close() {
+	if !p.closed {
+		p.closed = true
+		close(p.stop)
+	}
+}
+
+func (p *prefetcher) Read(b []byte) (int, error) {
+	for len(p.cur) == 0 {
+		switch {
+		case p.closed:
+			return 0, errReaderClosed
+		case p.err != nil:
+			return 0, p.err
+		}
+		if p.buf != nil {
+			p.free <- p.buf
+		}
+		c := <-p.full
+		p.buf, p.cur, p.err = c.b, c.b, c.err
+	}
+	n := copy(b, p.cur)
+	p.cur = p.cur[n:]
+	return n, nil
+}
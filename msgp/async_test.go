@@ -0,0 +1,179 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// failWriter fails after 'n' bytes
+type failWriter struct {
+	n   int
+	err error
+}
+
+func (f *failWriter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		n := f.n
+		f.n = 0
+		return n, f.err
+	}
+	f.n -= len(p)
+	return len(p), nil
+}
+
+// writeTestObjects writes a mix of small and large objects
+func writeTestObjects(t *testing.T, w *Writer) {
+	t.Helper()
+	big := strings.Repeat("x", 100000)
+	for i := range 5000 {
+		w.WriteMapHeader(2)
+		w.WriteString("i")
+		w.WriteInt(i)
+		w.WriteString("s")
+		var err error
+		if i%1000 == 0 {
+			err = w.WriteString(big)
+		} else {
+			err = w.WriteString("small")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a container that is spooled
+	c, _ := w.BeginArray()
+	for i := range 20000 {
+		w.WriteInt(i)
+	}
+	if err := c.End(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncWriter(t *testing.T) {
+	var want bytes.Buffer
+	w := NewWriter(&want)
+	writeTestObjects(t, w)
+	w.Flush()
+
+	var got bytes.Buffer
+	aw := NewAsyncWriter(&got, 3)
+	writeTestObjects(t, aw.Writer)
+	if err := aw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Fatalf("got %d bytes; wanted %d", got.Len(), want.Len())
+	}
+	// EncodeMsg works with the Writer
+	if err := (Raw{0xc0}).EncodeMsg(aw.Writer); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if last := got.Bytes()[got.Len()-1]; last != 0xc0 {
+		t.Errorf("last byte is %x", last)
+	}
+	if err := aw.Close(); err != errWriterClosed {
+		t.Errorf("got %v; wanted %v", err, errWriterClosed)
+	}
+	if err := aw.WriteString(strings.Repeat("x", 1<<20)); err != errWriterClosed {
+		t.Errorf("got %v; wanted %v", err, errWriterClosed)
+	}
+
+	// errors are sticky
+	boom := errors.New("boom")
+	aw = NewAsyncWriter(&failWriter{n: 100000, err: boom}, 2)
+	var err error
+	for i := 0; err == nil && i < 1<<20; i++ {
+		err = aw.WriteString("abcdefgh")
+	}
+	if err != boom {
+		t.Errorf("write: got %v; wanted %v", err, boom)
+	}
+	if err := aw.Flush(); err != boom {
+		t.Errorf("Flush: got %v; wanted %v", err, boom)
+	}
+	if err := aw.Close(); err != boom {
+		t.Errorf("Close: got %v; wanted %v", err, boom)
+	}
+
+	// Reset clears the error
+	aw = NewAsyncWriter(&failWriter{err: boom}, 2)
+	aw.WriteNil()
+	if err := aw.Flush(); err != boom {
+		t.Errorf("Flush: got %v; wanted %v", err, boom)
+	}
+	got.Reset()
+	aw.Reset(&got)
+	aw.WriteNil()
+	if err := aw.Close(); err != nil || !bytes.Equal(got.Bytes(), []byte{0xc0}) {
+		t.Errorf("got %x, %v", got.Bytes(), err)
+	}
+}
+
+func TestPrefetchReader(t *testing.T) {
+	var data bytes.Buffer
+	w := NewWriter(&data)
+	writeTestObjects(t, w)
+	w.Flush()
+
+	readers := map[string]func() io.Reader{
+		"whole":    func() io.Reader { return bytes.NewReader(data.Bytes()) },
+		"half":     func() io.Reader { return iotest.HalfReader(bytes.NewReader(data.Bytes())) },
+		"data err": func() io.Reader { return iotest.DataErrReader(bytes.NewReader(data.Bytes())) },
+	}
+	for name, r := range readers {
+		t.Run(name, func(t *testing.T) {
+			pr := NewPrefetchReader(r())
+			defer pr.Close()
+			var got bytes.Buffer
+			cw := NewWriter(&got)
+			for range 5001 {
+				var raw Raw
+				if err := raw.DecodeMsg(pr.Reader); err != nil {
+					t.Fatal(err)
+				}
+				cw.Write(raw)
+			}
+			cw.Flush()
+			if !bytes.Equal(got.Bytes(), data.Bytes()) {
+				t.Fatal("data differs")
+			}
+			if _, err := pr.NextType(); err != io.EOF {
+				t.Errorf("got %v; wanted %v", err, io.EOF)
+			}
+		})
+	}
+
+	// an error comes after the data before it
+	boom := errors.New("boom")
+	pr := NewPrefetchReader(io.MultiReader(bytes.NewReader([]byte{0x01, 0x02}), iotest.ErrReader(boom)))
+	for _, want := range []int{1, 2} {
+		if n, err := pr.ReadInt(); err != nil || n != want {
+			t.Errorf("got %d, %v; wanted %d", n, err, want)
+		}
+	}
+	for range 2 {
+		if _, err := pr.ReadInt(); err != boom {
+			t.Errorf("got %v; wanted %v", err, boom)
+		}
+	}
+	pr.Close()
+
+	pr = NewPrefetchReader(bytes.NewReader(data.Bytes()))
+	pr.Close()
+	if _, err := pr.ReadInt(); err != errReaderClosed {
+		t.Errorf("got %v; wanted %v", err, errReaderClosed)
+	}
+	pr.Reset(bytes.NewReader([]byte{0x07}))
+	if n, err := pr.ReadInt(); err != nil || n != 7 {
+		t.Errorf("after Reset: got %d, %v", n, err)
+	}
+	pr.Close()
+}
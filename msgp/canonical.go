@@ -0,0 +1,317 @@
+package msgp
+
+import (
+	"bytes"
+	"math"
+	"slices"
+)
+
+// CanonicalOptions controls the output of CanonicalizeWith.
+type CanonicalOptions struct {
+	// BinKeysAsStr encodes 'bin' map keys as 'str',
+	// so that the two kinds of keys compare equal.
+	BinKeysAsStr bool
+}
+
+// Canonicalize appends the canonical form of the
+// MessagePack objects in 'raw' to 'dst'. Two messages
+// that hold the same values have the same canonical form,
+// which makes it suitable for hashing and for cache keys.
+//
+// In the canonical form:
+//
+//   - Integers use the smallest encoding, and non-negative
+//     integers are always encoded as unsigned.
+//   - Floats are encoded as float32 if that is lossless,
+//     and all NaNs are encoded the same way.
+//   - Strings, binary, extensions, arrays and maps use
+//     the smallest header for their length.
+//   - Map entries are sorted by the bytes of their
+//     canonical keys.
+//
+// Extension payloads are left as they are. Canonicalize returns
+// [ErrDuplicateKey] if a map has the same key more than once.
+// On error, 'dst' is returned unchanged.
+func Canonicalize(dst, raw []byte) ([]byte, error) {
+	return CanonicalizeWith(dst, raw, CanonicalOptions{})
+}
+
+// CanonicalizeWith is like Canonicalize, with options.
+func CanonicalizeWith(dst, raw []byte, opts CanonicalOptions) ([]byte, error) {
+	c := canonicalizer{opts: opts}
+	out := dst
+	for b := raw; len(b) > 0; {
+		var err error
+		out, b, err = c.value(out, b, 0, false)
+		if err != nil {
+			return dst, WrapErrorBytes(err, raw, b)
+		}
+	}
+	return out, nil
+}
+
+// Equal reports whether 'a' and 'b' hold the same
+// MessagePack objects, ignoring the differences
+// removed by Canonicalize (except that 'str' and 'bin'
+// keys always differ). Equal does not allocate.
+// It returns false if either input is malformed
+// or has a map with duplicate keys.
+//
+// Maps are compared in quadratic time,
+// so large maps should be compared by
+// canonicalizing them first.
+func Equal(a, b []byte) bool {
+	for len(a) > 0 && len(b) > 0 {
+		var ok bool
+		if a, b, ok = equalNext(a, b, 0); !ok {
+			return false
+		}
+	}
+	return len(a) == 0 && len(b) == 0
+}
+
+// canonItem is a decoded scalar, or the header of a map or
+// array, normalized so that equal values are identical:
+//
+//   - non-negative integers are UintType
+//   - floats are Float64Type
+//   - 'u' holds the bits of numbers and bools,
+//     and the number of elements for maps and arrays
+//   - 'p' holds the payload of str, bin and ext
+type canonItem struct {
+	typ Type
+	ext int8
+	u   uint64
+	p   []byte
+}
+
+func readItem(b []byte) (it canonItem, o []byte, err error) {
+	if len(b) == 0 {
+		return it, b, ErrShortBytes
+	}
+	it.typ = getType(b[0])
+	var sz uint32
+	switch it.typ {
+	case NilType:
+		o, err = ReadNilBytes(b)
+	case BoolType:
+		var t bool
+		t, o, err = ReadBoolBytes(b)
+		if t {
+			it.u = 1
+		}
+	case IntType:
+		var i int64
+		i, o, err = ReadInt64Bytes(b)
+		if i >= 0 {
+			it.typ = UintType
+		}
+		it.u = uint64(i)
+	case UintType:
+		it.u, o, err = ReadUint64Bytes(b)
+	case Float32Type, Float64Type:
+		var f float64
+		if it.typ == Float32Type {
+			var f32 float32
+			f32, o, err = ReadFloat32Bytes(b)
+			f = float64(f32)
+		} else {
+			f, o, err = ReadFloat64Bytes(b)
+		}
+		if math.IsNaN(f) {
+			f = math.NaN()
+		}
+		it.typ = Float64Type
+		it.u = math.Float64bits(f)
+	case StrType:
+		it.p, o, err = ReadStringZC(b)
+	case BinType:
+		it.p, o, err = ReadBytesZC(b)
+	case ExtensionType:
+		it.ext, o, it.p, err = readExt(b)
+	case ArrayType:
+		sz, o, err = ReadArrayHeaderBytes(b)
+		it.u = uint64(sz)
+	case MapType:
+		sz, o, err = ReadMapHeaderBytes(b)
+		it.u = uint64(sz)
+	default:
+		return it, b, InvalidPrefixError(b[0])
+	}
+	if err != nil {
+		return canonItem{}, b, err
+	}
+	return it, o, nil
+}
+
+// appendCanonical appends the canonical encoding
+// of the item (only the header for maps and arrays)
+func (it *canonItem) appendCanonical(b []byte) []byte {
+	switch it.typ {
+	case NilType:
+		return AppendNil(b)
+	case BoolType:
+		return AppendBool(b, it.u == 1)
+	case IntType:
+		return AppendInt64(b, int64(it.u))
+	case UintType:
+		return AppendUint64(b, it.u)
+	case Float64Type:
+		f := math.Float64frombits(it.u)
+		if f32 := float32(f); float64(f32) == f || math.IsNaN(f) {
+			return AppendFloat32(b, f32)
+		}
+		return AppendFloat64(b, f)
+	case StrType:
+		return AppendStringFromBytes(b, it.p)
+	case BinType:
+		return AppendBytes(b, it.p)
+	case ExtensionType:
+		b, _ = AppendExtension(b, &RawExtension{Type: it.ext, Data: it.p})
+		return b
+	case ArrayType:
+		return AppendArrayHeader(b, uint32(it.u))
+	case MapType:
+		return AppendMapHeader(b, uint32(it.u))
+	}
+	panic(fatal)
+}
+
+type canonicalizer struct {
+	opts CanonicalOptions
+}
+
+// canonEntry is the location of a map entry in the output,
+// relative to the end of the map header
+type canonEntry struct {
+	start, key, end int
+}
+
+// value appends the canonical form of the object at the start of 'b'.
+// On error, it returns 'b', and 'out' must be discarded.
+func (c *canonicalizer) value(dst, b []byte, depth int, isKey bool) (out, o []byte, err error) {
+	it, o, err := readItem(b)
+	if err != nil {
+		return dst, b, err
+	}
+	if isKey && c.opts.BinKeysAsStr && it.typ == BinType {
+		it.typ = StrType
+	}
+	dst = it.appendCanonical(dst)
+	switch it.typ {
+	case ArrayType:
+		if depth >= recursionLimit {
+			return dst, b, ErrRecursion
+		}
+		for i := range uint32(it.u) {
+			if dst, o, err = c.value(dst, o, depth+1, false); err != nil {
+				return dst, b, WrapErrorBytes(err, b, o, int(i))
+			}
+		}
+	case MapType:
+		if depth >= recursionLimit {
+			return dst, b, ErrRecursion
+		}
+		// every key and value is at least one byte
+		if uint64(len(o)) < 2*it.u {
+			return dst, b, ErrShortBytes
+		}
+		base := len(dst)
+		entries := make([]canonEntry, it.u)
+		for i := range entries {
+			e := &entries[i]
+			e.start = len(dst) - base
+			k := o
+			if dst, o, err = c.value(dst, o, depth+1, true); err != nil {
+				return dst, b, WrapErrorBytes(err, b, o)
+			}
+			e.key = len(dst) - base
+			if dst, o, err = c.value(dst, o, depth+1, false); err != nil {
+				return dst, b, WrapErrorBytes(err, b, o, keyString(k))
+			}
+			e.end = len(dst) - base
+		}
+		body := dst[base:]
+		cmp := func(x, y canonEntry) int {
+			return bytes.Compare(body[x.start:x.key], body[y.start:y.key])
+		}
+		if !slices.IsSortedFunc(entries, cmp) {
+			body = bytes.Clone(body)
+			slices.SortFunc(entries, cmp)
+			dst = dst[:base]
+			for _, e := range entries {
+				dst = append(dst, body[e.start:e.end]...)
+			}
+		}
+		for i := 1; i < len(entries); i++ {
+			if cmp(entries[i-1], entries[i]) == 0 {
+				return dst, b, ErrDuplicateKey
+			}
+		}
+	}
+	return dst, o, nil
+}
+
+// equalNext compares the objects at the start of 'a' and 'b',
+// and returns what follows them if they are equal.
+func equalNext(a, b []byte, depth int) (ra, rb []byte, ok bool) {
+	x, oa, err := readItem(a)
+	if err != nil {
+		return nil, nil, false
+	}
+	y, ob, err := readItem(b)
+	if err != nil || x.typ != y.typ || x.ext != y.ext || x.u != y.u || !bytes.Equal(x.p, y.p) {
+		return nil, nil, false
+	}
+	if (x.typ == ArrayType || x.typ == MapType) && depth >= recursionLimit {
+		return nil, nil, false
+	}
+	switch x.typ {
+	case ArrayType:
+		for range x.u {
+			if oa, ob, ok = equalNext(oa, ob, depth+1); !ok {
+				return nil, nil, false
+			}
+		}
+	case MapType:
+		// find the end of the map in 'b'
+		entries := ob
+		for range 2 * x.u {
+			if ob, err = skipDepth(ob, depth+1); err != nil {
+				return nil, nil, false
+			}
+		}
+		start := oa
+		for i := range x.u {
+			key := oa
+			// a duplicate key in 'a' could
+			// match the same entry in 'b' twice
+			p := start
+			for range i {
+				if _, _, dup := equalNext(p, key, depth+1); dup {
+					return nil, nil, false
+				}
+				p, _ = skipDepth(p, depth+1)
+				p, _ = skipDepth(p, depth+1)
+			}
+			found := false
+			p = entries
+			for range x.u {
+				va, vb, same := equalNext(key, p, depth+1)
+				if same {
+					if oa, _, ok = equalNext(va, vb, depth+1); !ok {
+						return nil, nil, false
+					}
+					found = true
+					break
+				}
+				p, _ = skipDepth(p, depth+1)
+				p, _ = skipDepth(p, depth+1)
+			}
+			if !found {
+				return nil, nil, false
+			}
+		}
+	}
+	return oa, ob, true
+}
@@ -0,0 +1,181 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	// each pair holds different encodings of the same value
+	pairs := []struct {
+		name string
+		a, b []byte
+	}{
+		{"int width", []byte{0xd3, 0, 0, 0, 0, 0, 0, 0, 5}, []byte{0x05}},
+		{"int vs uint", []byte{0xd1, 0x01, 0x00}, []byte{0xcd, 0x01, 0x00}},
+		{"negative", []byte{0xd2, 0xff, 0xff, 0xff, 0xfe}, []byte{0xfe}},
+		{"float width", AppendFloat64(nil, 1.5), AppendFloat32(nil, 1.5)},
+		{"nan", AppendFloat64(nil, math.NaN()), AppendFloat32(nil, float32(math.Inf(1))-float32(math.Inf(1)))},
+		{"str8", []byte{0xd9, 0x01, 'a'}, []byte{0xa1, 'a'}},
+		{"bin16", []byte{0xc5, 0x00, 0x01, 'a'}, []byte{0xc4, 0x01, 'a'}},
+		{"fixext", []byte{0xc7, 0x01, 0x05, 'a'}, []byte{0xd4, 0x05, 'a'}},
+		{"array16", []byte{0xdc, 0x00, 0x01, 0xc0}, []byte{0x91, 0xc0}},
+		{"map order", func() []byte {
+			b := AppendMapHeader(nil, 2)
+			b = AppendString(b, "b")
+			b = AppendInt(b, 2)
+			b = AppendString(b, "a")
+			return AppendFloat64(b, 1)
+		}(), func() []byte {
+			b := AppendMapHeader(nil, 2)
+			b = AppendString(b, "a")
+			b = AppendFloat32(b, 1)
+			b = AppendString(b, "b")
+			return AppendUint(b, 2)
+		}()},
+		{"nested", func() []byte {
+			b := AppendArrayHeader(nil, 1)
+			b = AppendMapHeader(b, 2)
+			b = AppendInt(b, 300)
+			b = AppendNil(b)
+			b = AppendInt(b, -1)
+			return AppendBool(b, true)
+		}(), func() []byte {
+			b := AppendArrayHeader(nil, 1)
+			b = AppendMapHeader(b, 2)
+			b = AppendInt(b, -1)
+			b = AppendBool(b, true)
+			b = AppendUint16(b, 300)
+			return AppendNil(b)
+		}()},
+	}
+	for _, tt := range pairs {
+		t.Run(tt.name, func(t *testing.T) {
+			ca, err := Canonicalize(nil, tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cb, err := Canonicalize(nil, tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(ca, cb) {
+				t.Errorf("%x and %x canonicalized to %x and %x", tt.a, tt.b, ca, cb)
+			}
+			again, err := Canonicalize(nil, ca)
+			if err != nil || !bytes.Equal(again, ca) {
+				t.Errorf("canonicalizing %x again: got %x, %v", ca, again, err)
+			}
+			if !Equal(tt.a, tt.b) || !Equal(tt.a, cb) {
+				t.Errorf("%x and %x are not Equal", tt.a, tt.b)
+			}
+		})
+	}
+
+	// binary keys
+	bkey := AppendMapHeader(nil, 1)
+	bkey = AppendBytes(bkey, []byte("k"))
+	bkey = AppendNil(bkey)
+	skey := AppendMapHeader(nil, 1)
+	skey = AppendString(skey, "k")
+	skey = AppendNil(skey)
+	if Equal(bkey, skey) {
+		t.Error("bin and str keys are Equal")
+	}
+	out, err := CanonicalizeWith([]byte{0xc0}, bkey, CanonicalOptions{BinKeysAsStr: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, append([]byte{0xc0}, skey...)) {
+		t.Errorf("got %x; wanted %x", out, skey)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	obj := func(vals ...any) []byte {
+		b, err := AppendIntf(nil, vals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	m := func(kv ...any) []byte {
+		b := AppendMapHeader(nil, uint32(len(kv)/2))
+		for _, v := range kv {
+			b, _ = AppendIntf(b, v)
+		}
+		return b
+	}
+	unequal := [][2][]byte{
+		{obj(1), obj(-1)},
+		{obj(1), obj(1.0)},
+		{obj(0.0), obj(math.Copysign(0, -1))},
+		{obj("a"), obj([]byte("a"))},
+		{obj(1, 2), obj(2, 1)},
+		{obj(1), obj(1, 2)},
+		{m("a", 1, "b", 2), m("a", 1, "c", 2)},
+		{m("a", 1, "b", 2), m("b", 1, "a", 2)},
+		{m("a", 1, "a", 1), m("a", 1, "b", 1)},
+		{m("a", 1, "b", 1), m("a", 1, "a", 1)},
+		{obj(1), obj(1)[:len(obj(1))-1]},
+		{obj(1), append(obj(1), 0xc0)},
+		{[]byte{0xc1}, []byte{0xc1}},
+	}
+	for _, tt := range unequal {
+		if Equal(tt[0], tt[1]) || Equal(tt[1], tt[0]) {
+			t.Errorf("%x and %x are Equal", tt[0], tt[1])
+		}
+	}
+	if !Equal(nil, nil) {
+		t.Error("empty inputs are not Equal")
+	}
+	// sequences of objects
+	if !Equal(append(obj(1), m("x", 1, "y", nil)...), append(obj(uint8(1)), m("y", nil, "x", 1)...)) {
+		t.Error("sequences are not Equal")
+	}
+
+	a, b := m("a", []any{1, 2.5, "x"}, "b", nil), m("b", nil, "a", []any{uint(1), float32(2.5), "x"})
+	if allocs := testing.AllocsPerRun(10, func() {
+		if !Equal(a, b) {
+			t.Fatal("not Equal")
+		}
+	}); allocs != 0 {
+		t.Errorf("Equal made %v allocations", allocs)
+	}
+}
+
+func TestCanonicalizeErrors(t *testing.T) {
+	dup := AppendMapHeader(nil, 2)
+	dup = AppendString(dup, "a")
+	dup = AppendInt(dup, 1)
+	dup = AppendString(dup, "a")
+	dup = AppendInt(dup, 2)
+	_, err := Canonicalize(nil, dup)
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("got %v; wanted %v", err, ErrDuplicateKey)
+	}
+
+	// {"a": [1, <bad>]}
+	raw := AppendMapHeader(nil, 1)
+	raw = AppendString(raw, "a")
+	raw = AppendArrayHeader(raw, 2)
+	raw = AppendInt(raw, 1)
+	raw = append(raw, 0xc1)
+	dst := []byte("prefix")
+	out, err := Canonicalize(dst, raw)
+	if !errors.Is(err, InvalidPrefixError(0xc1)) {
+		t.Fatalf("got %v; wanted %v", err, InvalidPrefixError(0xc1))
+	}
+	if !bytes.Equal(out, dst) {
+		t.Errorf("got output %q; wanted %q", out, dst)
+	}
+	var lerr LocatedError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("%v is not a LocatedError", err)
+	}
+	if lerr.Offset() != int64(len(raw)-1) || pathString(lerr.Path()) != "a/1" {
+		t.Errorf("got offset %d, path %q", lerr.Offset(), pathString(lerr.Path()))
+	}
+}
@@ -0,0 +1,694 @@
+package msgp
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// CBOR major types
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// CBOR tags with a meaning of their own
+const (
+	cborTagEpoch        = 1     // seconds since the epoch
+	cborTagExtendedTime = 1001  // RFC 9581
+	cborTagSelfDescribe = 55799 // a marker with no meaning
+)
+
+const (
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+// CBORError is returned when CBOR input is malformed, or when a
+// value can't be translated between CBOR and MessagePack.
+type CBORError struct {
+	Msg string
+}
+
+// Error implements error.
+func (e *CBORError) Error() string { return "msgp: cbor: " + e.Msg }
+
+// Resumable returns false for CBORErrors.
+func (e *CBORError) Resumable() bool { return false }
+
+func cborErr(msg string) error { return &CBORError{Msg: msg} }
+
+// CBOROptions configures the translation between CBOR and MessagePack.
+//
+// Both data models have the same numbers, strings, byte strings, arrays
+// and maps, so those are translated directly. Integers and floats keep
+// their signs and widths (except that CBOR half-precision floats become
+// float32s, and integer widths are minimized). Indefinite-length CBOR
+// items become MessagePack items with a count: arrays and maps get a
+// 5-byte header (see (*Writer).BeginArray). CBOR text must be valid UTF-8,
+// so MessagePack 'str's that aren't can't be translated.
+//
+// The MessagePack timestamp extension (and the msgp time extension) becomes
+// CBOR tag 1 (epoch time) if it is a whole number of seconds, or else tag 1001
+// (extended time, from RFC 9581) with the seconds and nanoseconds. In the
+// other direction, tags 1 and 1001 become timestamp extensions. Tag 55799
+// (self-described CBOR) is dropped. Other tags and extension types are
+// translated according to Tags.
+//
+// Anything else, such as CBOR 'undefined', simple values and unknown tags,
+// or MessagePack extensions with no tag, results in a *CBORError.
+type CBOROptions struct {
+	// Tags maps CBOR tags to MessagePack extension types, in both
+	// directions. The content of each of these tags must be a byte
+	// string, which holds the data of the extension.
+	Tags map[uint64]int8
+
+	// Limits bounds the input, in the same way that
+	// the limits of a Reader do. (See Limits.)
+	Limits Limits
+}
+
+// CopyToCBOR reads MessagePack from 'src' and copies it as
+// CBOR to 'dst' until EOF, using the default CBOROptions.
+func CopyToCBOR(dst io.Writer, src io.Reader) (n int64, err error) {
+	return (&CBOROptions{}).CopyToCBOR(dst, src)
+}
+
+// CopyFromCBOR reads CBOR from 'src' and copies it as MessagePack
+// to 'dst' until EOF, using the default CBOROptions.
+func CopyFromCBOR(dst io.Writer, src io.Reader) (n int64, err error) {
+	return (&CBOROptions{}).CopyFromCBOR(dst, src)
+}
+
+// AppendCBOR appends the CBOR translation of the MessagePack
+// objects in 'msg' to 'dst', using the default CBOROptions.
+func AppendCBOR(dst []byte, msg []byte) ([]byte, error) {
+	return (&CBOROptions{}).AppendCBOR(dst, msg)
+}
+
+// AppendFromCBOR appends the MessagePack translation of the CBOR
+// items in 'data' to 'dst', using the default CBOROptions.
+func AppendFromCBOR(dst []byte, data []byte) ([]byte, error) {
+	return (&CBOROptions{}).AppendFromCBOR(dst, data)
+}
+
+// CopyToCBOR reads MessagePack from 'src' and copies it as CBOR
+// to 'dst' until EOF. It returns the number of bytes written.
+func (o *CBOROptions) CopyToCBOR(dst io.Writer, src io.Reader) (n int64, err error) {
+	cw := &countWriter{w: dst}
+	err = o.translate(cw, src, (*cborTranscoder).toCBOR)
+	return cw.n, err
+}
+
+// CopyFromCBOR reads CBOR from 'src' and copies it as MessagePack
+// to 'dst' until EOF. It returns the number of bytes written.
+func (o *CBOROptions) CopyFromCBOR(dst io.Writer, src io.Reader) (n int64, err error) {
+	cw := &countWriter{w: dst}
+	err = o.translate(cw, src, (*cborTranscoder).fromCBOR)
+	return cw.n, err
+}
+
+// AppendCBOR appends the CBOR translation of
+// the MessagePack objects in 'msg' to 'dst'.
+// On error, it returns 'dst' unchanged.
+func (o *CBOROptions) AppendCBOR(dst []byte, msg []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	if err := o.translate(buf, bytes.NewReader(msg), (*cborTranscoder).toCBOR); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+// AppendFromCBOR appends the MessagePack translation
+// of the CBOR items in 'data' to 'dst'.
+// On error, it returns 'dst' unchanged.
+func (o *CBOROptions) AppendFromCBOR(dst []byte, data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	if err := o.translate(buf, bytes.NewReader(data), (*cborTranscoder).fromCBOR); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// cborTranscoder translates one item at a time
+type cborTranscoder struct {
+	opts *CBOROptions
+	r    *Reader
+	w    *Writer
+	ext  map[int8]uint64 // the inverse of opts.Tags
+	buf  []byte
+}
+
+// translate translates every item in 'src' with 'next'
+func (o *CBOROptions) translate(dst io.Writer, src io.Reader, next func(*cborTranscoder) error) error {
+	t := cborTranscoder{opts: o, r: NewReader(src), w: NewWriter(dst)}
+	defer freeR(t.r)
+	defer freeW(t.w)
+	t.r.SetLimits(o.Limits)
+	for {
+		if _, err := t.r.R.PeekByte(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := next(&t); err != nil {
+			t.w.Flush()
+			return noEOF(err)
+		}
+	}
+	return t.w.Flush()
+}
+
+// head writes the head of a CBOR item
+func (t *cborTranscoder) head(major byte, n uint64) error {
+	m := major << 5
+	switch {
+	case n < 24:
+		return t.w.push(m | byte(n))
+	case n <= math.MaxUint8:
+		return t.w.prefix8(m|24, uint8(n))
+	case n <= math.MaxUint16:
+		return t.w.prefix16(m|25, uint16(n))
+	case n <= math.MaxUint32:
+		return t.w.prefix32(m|26, uint32(n))
+	default:
+		return t.w.prefix64(m|27, n)
+	}
+}
+
+// int writes an integer as CBOR
+func (t *cborTranscoder) int(i int64) error {
+	if i < 0 {
+		return t.head(cborNegInt, uint64(-1-i))
+	}
+	return t.head(cborUint, uint64(i))
+}
+
+// toCBOR translates the next MessagePack object to CBOR
+func (t *cborTranscoder) toCBOR() error {
+	typ, err := t.r.NextType()
+	if err != nil {
+		return err
+	}
+	switch typ {
+	case NilType:
+		if err := t.r.ReadNil(); err != nil {
+			return err
+		}
+		return t.w.push(0xf6)
+	case BoolType:
+		b, err := t.r.ReadBool()
+		if err != nil {
+			return err
+		}
+		if b {
+			return t.w.push(0xf5)
+		}
+		return t.w.push(0xf4)
+	case IntType:
+		i, err := t.r.ReadInt64()
+		if err != nil {
+			return err
+		}
+		return t.int(i)
+	case UintType:
+		u, err := t.r.ReadUint64()
+		if err != nil {
+			return err
+		}
+		return t.head(cborUint, u)
+	case Float32Type:
+		f, err := t.r.ReadFloat32()
+		if err != nil {
+			return err
+		}
+		return t.w.prefix32(0xfa, math.Float32bits(f))
+	case Float64Type:
+		f, err := t.r.ReadFloat64()
+		if err != nil {
+			return err
+		}
+		return t.w.prefix64(0xfb, math.Float64bits(f))
+	case StrType:
+		t.buf, err = t.r.ReadStringAsBytes(t.buf[:0])
+		if err != nil {
+			return err
+		}
+		if !utf8.Valid(t.buf) {
+			return cborErr("string is not valid UTF-8")
+		}
+		if err := t.head(cborText, uint64(len(t.buf))); err != nil {
+			return err
+		}
+		_, err = t.w.Write(t.buf)
+		return err
+	case BinType:
+		t.buf, err = t.r.ReadBytes(t.buf[:0])
+		if err != nil {
+			return err
+		}
+		if err := t.head(cborBytes, uint64(len(t.buf))); err != nil {
+			return err
+		}
+		_, err = t.w.Write(t.buf)
+		return err
+	case ArrayType, MapType:
+		var sz uint32
+		major := byte(cborArray)
+		if typ == ArrayType {
+			sz, err = t.r.ReadArrayHeader()
+		} else {
+			major = cborMap
+			sz, err = t.r.ReadMapHeader()
+		}
+		if err != nil {
+			return err
+		}
+		if sz > t.r.GetMaxElements() {
+			return ErrLimitExceeded
+		}
+		done, err := t.r.recursiveCall()
+		if err != nil {
+			return err
+		}
+		defer done()
+		if err := t.head(major, uint64(sz)); err != nil {
+			return err
+		}
+		n := uint64(sz)
+		if typ == MapType {
+			n *= 2
+		}
+		for range n {
+			if err := t.toCBOR(); err != nil {
+				return noEOF(err)
+			}
+		}
+		return nil
+	case TimeType:
+		tm, err := t.r.ReadTime()
+		if err != nil {
+			return err
+		}
+		sec, nsec := tm.Unix(), int64(tm.Nanosecond())
+		if nsec == 0 {
+			if err := t.head(cborTag, cborTagEpoch); err != nil {
+				return err
+			}
+			return t.int(sec)
+		}
+		// {1: seconds, -9: nanoseconds}
+		if err := t.head(cborTag, cborTagExtendedTime); err != nil {
+			return err
+		}
+		if err := t.head(cborMap, 2); err != nil {
+			return err
+		}
+		if err := t.int(1); err != nil {
+			return err
+		}
+		if err := t.int(sec); err != nil {
+			return err
+		}
+		if err := t.int(-9); err != nil {
+			return err
+		}
+		return t.int(nsec)
+	case ExtensionType, Complex64Type, Complex128Type:
+		etyp, data, err := t.r.ReadExtensionRaw()
+		if err != nil {
+			return err
+		}
+		if t.ext == nil {
+			t.ext = make(map[int8]uint64, len(t.opts.Tags))
+			for tag, e := range t.opts.Tags {
+				t.ext[e] = tag
+			}
+		}
+		tag, ok := t.ext[etyp]
+		if !ok {
+			return cborErr("no tag for extension type " + strconv.Itoa(int(etyp)))
+		}
+		if err := t.head(cborTag, tag); err != nil {
+			return err
+		}
+		if err := t.head(cborBytes, uint64(len(data))); err != nil {
+			return err
+		}
+		_, err = t.w.Write(data)
+		return err
+	}
+	return cborErr("unsupported type " + typ.String())
+}
+
+// readHead reads the head of a CBOR item; 'info' is
+// cborIndefinite for indefinite lengths and "break"
+func (t *cborTranscoder) readHead() (major, info byte, arg uint64, err error) {
+	b, err := t.r.R.ReadByte()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b>>5, b&31
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		p, err := t.r.R.Next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, noEOF(err)
+		}
+		for _, c := range p {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, info, arg, nil
+	case info == cborIndefinite && major >= cborBytes && major != cborTag:
+		return major, info, 0, nil
+	}
+	return 0, 0, 0, cborErr("invalid initial byte 0x" + strconv.FormatUint(uint64(b), 16))
+}
+
+// isBreak consumes the "break" that ends
+// an indefinite-length item, if it is next
+func (t *cborTranscoder) isBreak() (bool, error) {
+	b, err := t.r.R.PeekByte()
+	if err != nil {
+		return false, noEOF(err)
+	}
+	if b != cborBreak {
+		return false, nil
+	}
+	_, err = t.r.R.Skip(1)
+	return true, err
+}
+
+// fromCBOR translates the next CBOR item to MessagePack
+func (t *cborTranscoder) fromCBOR() error {
+	major, info, arg, err := t.readHead()
+	if err != nil {
+		return err
+	}
+	// skip self-describe markers in a loop, so
+	// a long run of them can't exhaust the stack
+	for major == cborTag && arg == cborTagSelfDescribe {
+		if major, info, arg, err = t.readHead(); err != nil {
+			return noEOF(err)
+		}
+	}
+	switch major {
+	case cborUint:
+		return t.w.WriteUint64(arg)
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return cborErr("negative integer out of range")
+		}
+		return t.w.WriteInt64(-1 - int64(arg))
+	case cborBytes, cborText:
+		if err := t.readString(major, info, arg); err != nil {
+			return err
+		}
+		if major == cborText {
+			return t.w.WriteStringFromBytes(t.buf)
+		}
+		return t.w.WriteBytes(t.buf)
+	case cborArray, cborMap:
+		done, err := t.r.recursiveCall()
+		if err != nil {
+			return err
+		}
+		defer done()
+		items := 1
+		if major == cborMap {
+			items = 2
+		}
+		if info == cborIndefinite {
+			return t.indefinite(major, items)
+		}
+		if arg > uint64(t.r.GetMaxElements()) {
+			return ErrLimitExceeded
+		}
+		if err := t.r.chargeElements(uint32(arg)); err != nil {
+			return err
+		}
+		if major == cborArray {
+			err = t.w.WriteArrayHeader(uint32(arg))
+		} else {
+			err = t.w.WriteMapHeader(uint32(arg))
+		}
+		if err != nil {
+			return err
+		}
+		for range arg * uint64(items) {
+			if err := t.fromCBOR(); err != nil {
+				return noEOF(err)
+			}
+		}
+		return nil
+	case cborTag:
+		return t.tag(arg)
+	}
+	switch info {
+	case 20, 21:
+		return t.w.WriteBool(info == 21)
+	case 22:
+		return t.w.WriteNil()
+	case 25:
+		return t.w.WriteFloat32(halfToFloat32(uint16(arg)))
+	case 26:
+		return t.w.WriteFloat32(math.Float32frombits(uint32(arg)))
+	case 27:
+		return t.w.WriteFloat64(math.Float64frombits(arg))
+	case cborIndefinite:
+		return cborErr("unexpected break")
+	case 23:
+		return cborErr("undefined has no MessagePack equivalent")
+	}
+	return cborErr("simple value " + strconv.FormatUint(arg, 10) + " has no MessagePack equivalent")
+}
+
+// indefinite translates an indefinite-length array or map,
+// whose elements are groups of 'items' items
+func (t *cborTranscoder) indefinite(major byte, items int) error {
+	var c Container
+	var err error
+	if major == cborArray {
+		c, err = t.w.BeginArray()
+	} else {
+		c, err = t.w.BeginMap()
+	}
+	if err != nil {
+		return err
+	}
+	for n := uint32(0); ; n++ {
+		brk, err := t.isBreak()
+		if err != nil {
+			return err
+		}
+		if brk {
+			break
+		}
+		if n >= t.r.GetMaxElements() {
+			return ErrLimitExceeded
+		}
+		if err := t.r.chargeElements(1); err != nil {
+			return err
+		}
+		for range items {
+			if err := t.fromCBOR(); err != nil {
+				return noEOF(err)
+			}
+		}
+	}
+	return c.End()
+}
+
+// readString reads a byte or text string into t.buf
+func (t *cborTranscoder) readString(major, info byte, arg uint64) error {
+	t.buf = t.buf[:0]
+	if info != cborIndefinite {
+		return t.readChunk(major, arg)
+	}
+	for {
+		brk, err := t.isBreak()
+		if err != nil {
+			return err
+		}
+		if brk {
+			return nil
+		}
+		cmajor, cinfo, carg, err := t.readHead()
+		if err != nil {
+			return noEOF(err)
+		}
+		if cmajor != major || cinfo == cborIndefinite {
+			return cborErr("invalid chunk in indefinite-length string")
+		}
+		if err := t.readChunk(major, carg); err != nil {
+			return err
+		}
+	}
+}
+
+// readChunk appends a string of 'n' bytes to t.buf
+func (t *cborTranscoder) readChunk(major byte, n uint64) error {
+	limit := uint64(t.r.GetMaxElements())
+	if major == cborText {
+		limit = t.r.GetMaxStringLength()
+	}
+	if total := uint64(len(t.buf)) + n; total > limit || total > math.MaxUint32 {
+		return ErrLimitExceeded
+	}
+	if err := t.r.charge(n); err != nil {
+		return err
+	}
+	start := len(t.buf)
+	t.buf = append(t.buf, make([]byte, n)...)
+	_, err := t.r.R.ReadFull(t.buf[start:])
+	return noEOF(err)
+}
+
+// tag translates the content of a tagged item
+func (t *cborTranscoder) tag(tag uint64) error {
+	switch tag {
+	case cborTagEpoch:
+		major, info, arg, err := t.readHead()
+		if err != nil {
+			return noEOF(err)
+		}
+		var tm time.Time
+		switch {
+		case major == cborUint && arg <= math.MaxInt64:
+			tm = time.Unix(int64(arg), 0)
+		case major == cborNegInt && arg < math.MaxInt64:
+			tm = time.Unix(-1-int64(arg), 0)
+		case major == cborSimple && info >= 25 && info <= 27:
+			var f float64
+			switch info {
+			case 25:
+				f = float64(halfToFloat32(uint16(arg)))
+			case 26:
+				f = float64(math.Float32frombits(uint32(arg)))
+			default:
+				f = math.Float64frombits(arg)
+			}
+			sec := math.Floor(f)
+			if math.IsNaN(f) || sec < math.MinInt64 || sec >= math.MaxInt64 {
+				return cborErr("epoch time out of range")
+			}
+			tm = time.Unix(int64(sec), int64(math.Round((f-sec)*1e9)))
+		default:
+			return cborErr("invalid epoch time")
+		}
+		return t.w.WriteTimeExt(tm)
+	case cborTagExtendedTime:
+		return t.extendedTime()
+	}
+	etyp, ok := t.opts.Tags[tag]
+	if !ok {
+		return cborErr("no extension type for tag " + strconv.FormatUint(tag, 10))
+	}
+	major, info, arg, err := t.readHead()
+	if err != nil {
+		return noEOF(err)
+	}
+	if major != cborBytes {
+		return cborErr("content of tag " + strconv.FormatUint(tag, 10) + " is not a byte string")
+	}
+	if err := t.readString(major, info, arg); err != nil {
+		return err
+	}
+	return t.w.WriteExtensionRaw(etyp, t.buf)
+}
+
+// extendedTime translates the content of tag 1001, which is a map
+// holding the seconds (key 1), and optionally a fraction of a second
+// in milliseconds, microseconds or nanoseconds (keys -3, -6, -9)
+func (t *cborTranscoder) extendedTime() error {
+	major, _, n, err := t.readHead()
+	if err != nil {
+		return noEOF(err)
+	}
+	if major != cborMap {
+		return cborErr("extended time is not a map")
+	}
+	var (
+		sec, nsec int64
+		seen      bool
+	)
+	for range n {
+		key, err := t.readInt()
+		if err != nil {
+			return err
+		}
+		v, err := t.readInt()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case 1:
+			sec, seen = v, true
+		case -3:
+			nsec = v * 1e6
+		case -6:
+			nsec = v * 1e3
+		case -9:
+			nsec = v
+		default:
+			return cborErr("extended time key " + strconv.FormatInt(key, 10) + " has no MessagePack equivalent")
+		}
+	}
+	if !seen || nsec < 0 || nsec >= 1e9 {
+		return cborErr("invalid extended time")
+	}
+	return t.w.WriteTimeExt(time.Unix(sec, nsec))
+}
+
+// readInt reads an integer that fits in an int64
+func (t *cborTranscoder) readInt() (int64, error) {
+	major, _, arg, err := t.readHead()
+	if err != nil {
+		return 0, noEOF(err)
+	}
+	switch {
+	case major == cborUint && arg <= math.MaxInt64:
+		return int64(arg), nil
+	case major == cborNegInt && arg <= math.MaxInt64:
+		return -1 - int64(arg), nil
+	}
+	return 0, cborErr("expected an integer")
+}
+
+// halfToFloat32 converts an IEEE 754 half-precision float
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+	switch exp {
+	case 0:
+		// zero or subnormal: frac * 2^-24
+		f := float32(frac) / (1 << 24)
+		return math.Float32frombits(math.Float32bits(f) | sign)
+	case 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | frac<<13)
+}
@@ -0,0 +1,205 @@
+package msgp
+
+import (
+	"bytes"
+	hexenc "encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFromCBOR(t *testing.T) {
+	indefArray, outer := AppendBeginArray(nil)
+	indefArray = AppendInt(indefArray, 1)
+	indefArray = AppendArrayHeader(indefArray, 2)
+	indefArray = AppendInt(indefArray, 2)
+	indefArray = AppendInt(indefArray, 3)
+	indefArray, inner := AppendBeginArray(indefArray)
+	indefArray = AppendInt(indefArray, 4)
+	indefArray = AppendInt(indefArray, 5)
+	indefArray, _ = AppendEnd(indefArray, inner)
+	indefArray, _ = AppendEnd(indefArray, outer)
+
+	indefMap, m := AppendBeginMap(nil)
+	indefMap = AppendString(indefMap, "Fun")
+	indefMap = AppendBool(indefMap, true)
+	indefMap = AppendString(indefMap, "Amt")
+	indefMap = AppendInt(indefMap, -2)
+	indefMap, _ = AppendEnd(indefMap, m)
+
+	// from the examples in RFC 8949, appendix A
+	tests := []struct {
+		cbor string
+		want []byte
+	}{
+		{"00", AppendUint(nil, 0)},
+		{"1903e8", AppendUint(nil, 1000)},
+		{"1bffffffffffffffff", AppendUint64(nil, math.MaxUint64)},
+		{"20", AppendInt(nil, -1)},
+		{"3903e7", AppendInt(nil, -1000)},
+		{"f93c00", AppendFloat32(nil, 1)},
+		{"f97c00", AppendFloat32(nil, float32(math.Inf(1)))},
+		{"f90001", AppendFloat32(nil, 5.960464477539063e-8)},
+		{"f9c400", AppendFloat32(nil, -4)},
+		{"fa47c35000", AppendFloat32(nil, 100000)},
+		{"fb3ff199999999999a", AppendFloat64(nil, 1.1)},
+		{"f4", AppendBool(nil, false)},
+		{"f6", AppendNil(nil)},
+		{"4401020304", AppendBytes(nil, []byte{1, 2, 3, 4})},
+		{"62c3bc", AppendString(nil, "ü")},
+		{"83010203", []byte{0x93, 0x01, 0x02, 0x03}},
+		{"a201020304", []byte{0x82, 0x01, 0x02, 0x03, 0x04}},
+		{"9f018202039f0405ffff", indefArray},
+		{"bf6346756ef563416d7421ff", indefMap},
+		{"5f42010243030405ff", AppendBytes(nil, []byte{1, 2, 3, 4, 5})},
+		{"7f657374726561646d696e67ff", AppendString(nil, "streaming")},
+		{"c11a514b67b0", AppendTimeExt(nil, time.Unix(1363896240, 0))},
+		{"c1fb41d452d9ec200000", AppendTimeExt(nil, time.Unix(1363896240, 5e8))},
+		{"d9d9f700", AppendUint(nil, 0)},
+		{"0102", AppendUint(AppendUint(nil, 1), 2)},
+	}
+	for _, tt := range tests {
+		in, _ := hexenc.DecodeString(tt.cbor)
+		got, err := AppendFromCBOR(nil, in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.cbor, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got %x; wanted %x", tt.cbor, got, tt.want)
+		}
+	}
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	opts := &CBOROptions{Tags: map[uint64]int8{2: 7, 100000: Complex64Extension}}
+	var msg []byte
+	msg = AppendNil(msg)
+	msg = AppendBool(msg, true)
+	msg = AppendInt64(msg, math.MinInt64)
+	msg = AppendUint64(msg, math.MaxUint64)
+	msg = AppendFloat32(msg, 1.5)
+	msg = AppendFloat64(msg, math.Pi)
+	msg = AppendString(msg, "hello, world")
+	msg = AppendBytes(msg, bytes.Repeat([]byte{0xab}, 300))
+	msg = AppendMapHeader(msg, 2)
+	msg = AppendInt(msg, -3)
+	msg = AppendArrayHeader(msg, 2)
+	msg = AppendString(msg, "")
+	msg = AppendMapHeader(msg, 0)
+	msg = AppendString(msg, "t")
+	msg = AppendTimeExt(msg, time.Unix(1700000000, 123456789))
+	msg = AppendTimeExt(msg, time.Unix(-5, 0))
+	msg = appendRawExt(t, msg, 7, []byte{1, 0, 0})
+	msg = AppendComplex64(msg, complex(1, 2))
+
+	cbor, err := opts.AppendCBOR(nil, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := opts.CopyFromCBOR(&buf, bytes.NewReader(cbor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) || !bytes.Equal(buf.Bytes(), msg) {
+		t.Errorf("got %x; wanted %x", buf.Bytes(), msg)
+	}
+
+	// without the tags, the extensions can't be translated
+	var cerr *CBORError
+	if _, err := AppendCBOR(nil, msg); !errors.As(err, &cerr) {
+		t.Errorf("got %v; wanted a *CBORError", err)
+	}
+	if _, err := AppendFromCBOR(nil, cbor); !errors.As(err, &cerr) {
+		t.Errorf("got %v; wanted a *CBORError", err)
+	}
+}
+
+// appendRawExt appends an extension with arbitrary data
+func appendRawExt(t *testing.T, b []byte, typ int8, data []byte) []byte {
+	b, err := AppendExtension(b, &RawExtension{Type: typ, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCBORErrors(t *testing.T) {
+	var cerr *CBORError
+	tests := []struct {
+		cbor   string
+		limits Limits
+		want   any
+	}{
+		{"3bffffffffffffffff", Limits{}, &cerr},
+		{"f7", Limits{}, &cerr},
+		{"f0", Limits{}, &cerr},
+		{"ff", Limits{}, &cerr},
+		{"1c", Limits{}, &cerr},
+		{"d74401020304", Limits{}, &cerr},
+		{"5f6161ff", Limits{}, &cerr},
+		{"c1f6", Limits{}, &cerr},
+		{"d903e9a1206378797a", Limits{}, &cerr},
+		{"8301", Limits{}, io.ErrUnexpectedEOF},
+		{"9f01", Limits{}, io.ErrUnexpectedEOF},
+		{"1903", Limits{}, io.ErrUnexpectedEOF},
+		{"818181818100", Limits{MaxDepth: 3}, ErrRecursion},
+		{"9f818181818100ff", Limits{MaxDepth: 3}, ErrRecursion},
+		{"83010203", Limits{MaxElements: 2}, ErrLimitExceeded},
+		{"9f010203ff", Limits{MaxElements: 2}, ErrLimitExceeded},
+		{"7f626162626364ff", Limits{MaxStringLength: 3}, ErrLimitExceeded},
+	}
+	for _, tt := range tests {
+		in, _ := hexenc.DecodeString(tt.cbor)
+		opts := CBOROptions{Limits: tt.limits}
+		dst := []byte{0x01}
+		got, err := opts.AppendFromCBOR(dst, in)
+		if target, ok := tt.want.(**CBORError); ok {
+			if !errors.As(err, target) {
+				t.Errorf("%s: got %v; wanted a *CBORError", tt.cbor, err)
+			}
+		} else if !errors.Is(err, tt.want.(error)) {
+			t.Errorf("%s: got %v; wanted %v", tt.cbor, err, tt.want)
+		}
+		if !bytes.Equal(got, dst) {
+			t.Errorf("%s: got %x on error", tt.cbor, got)
+		}
+	}
+
+	// self-describe markers don't nest
+	in := append(bytes.Repeat([]byte{0xd9, 0xd9, 0xf7}, 10000), 0x00)
+	opts := CBOROptions{Limits: Limits{MaxDepth: 10}}
+	if got, err := opts.AppendFromCBOR(nil, in); err != nil || !bytes.Equal(got, AppendUint(nil, 0)) {
+		t.Errorf("self-describe run: got %x, %v", got, err)
+	}
+	if _, err := opts.AppendFromCBOR(nil, in[:len(in)-1]); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated self-describe run: got %v", err)
+	}
+
+	// the limits don't outlive the call
+	opts = CBOROptions{Limits: Limits{MaxTotalBytes: 1}}
+	if _, err := opts.AppendFromCBOR(nil, []byte{0x63, 0x61, 0x62, 0x63}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("got %v; wanted ErrLimitExceeded", err)
+	}
+	for range 10 {
+		if _, err := NewReader(bytes.NewReader(AppendString(nil, "abc"))).ReadString(); err != nil {
+			t.Fatalf("pooled Reader kept the limits: %v", err)
+		}
+	}
+
+	// MessagePack that CBOR can't hold
+	for _, msg := range [][]byte{
+		{0xa2, 0xff, 0xfe},       // invalid UTF-8
+		{0xd4, 0x10, 0x00},       // extension with no tag
+		{0x92, 0x01},             // truncated
+		{0x91, 0x91, 0x91, 0x90}, // too deep
+	} {
+		opts := CBOROptions{Limits: Limits{MaxDepth: 2}}
+		if _, err := opts.AppendCBOR(nil, msg); err == nil {
+			t.Errorf("%x: no error", msg)
+		}
+	}
+}
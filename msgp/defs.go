@@ -10,6 +10,11 @@
 //   - (*Writer).WriteXxxx() writes an object to the buffered *Writer type.
 //   - (*Reader).ReadXxxx() reads an object from a buffered *Reader type.
 //
+// When a ReadXxxxBytes() function returns an error, the remaining bytes that
+// it returns are its input, so that the caller can skip the value or locate
+// the error. Errors about a value that was read in full, such as IntOverflow,
+// are the exception: the remaining bytes are those after the value.
+//
 // Once a type has satisfied the `Encodable` and `Decodable` interfaces,
 // it can be written and read from arbitrary `io.Writer`s and `io.Reader`s using
 //
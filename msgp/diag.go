@@ -0,0 +1,702 @@
+package msgp
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Diag renders MessagePack in a human-readable diagnostic
+// notation, similar to the one used for CBOR, that keeps
+// the exact encoding of every value:
+//
+//	{"a": 1_u8, "b": h'00ff', "t": ext(-1, h'5f5e1000'), "f": 1.5_f32}
+//
+// The notation is:
+//
+//   - nil, true and false
+//   - integers, like 1 and -200
+//   - floats, like 1.5, 1.0, 1e+100, NaN and +Inf
+//   - strings, quoted as in Go
+//   - binary, as h'...' with the contents in hex
+//   - extensions, as ext(type, h'...')
+//   - arrays, as [a, b, ...]
+//   - maps, as {key: value, ...}
+//   - raw(h'...'), for bytes that are copied to the output as-is
+//
+// A value without a suffix has the encoding that the Append functions
+// in this package use for it, such as AppendInt64 for integers,
+// AppendFloat64 for floats and AppendString for strings. Other encodings
+// are shown with a suffix: _u8, _u16, _u32, _u64, _i8, _i16, _i32 and _i64
+// for integers, _f32 for floats, and _8, _16 and _32 for the width of the
+// length in the header of strings, binary, extensions, arrays and maps.
+//
+// Objects at the top level are written one per line.
+// Malformed input, starting from the first object that
+// can't be skipped, is written with raw(h'...').
+//
+// ParseDiag converts the notation back to the original bytes.
+func Diag(raw []byte) string {
+	var sb strings.Builder
+	for b := raw; len(b) > 0; {
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+		if _, err := Skip(b); err != nil {
+			writeRaw(&sb, b)
+			break
+		}
+		b = writeDiag(&sb, b)
+	}
+	return sb.String()
+}
+
+func writeRaw(sb *strings.Builder, b []byte) {
+	sb.WriteString("raw(h'")
+	writeHex(sb, b)
+	sb.WriteString("')")
+}
+
+// widths of the lengths of headers,
+// as used in suffixes
+var headerWidth = map[byte]string{
+	mbin8: "8", mbin16: "16", mbin32: "32",
+	mext8: "8", mext16: "16", mext32: "32",
+	mstr8: "8", mstr16: "16", mstr32: "32",
+	marray16: "16", marray32: "32",
+	mmap16: "16", mmap32: "32",
+}
+
+var intSuffix = map[byte]string{
+	muint8: "u8", muint16: "u16", muint32: "u32", muint64: "u64",
+	mint8: "i8", mint16: "i16", mint32: "i32", mint64: "i64",
+}
+
+// writeSuffix writes the suffix for the header 'lead'
+// if it isn't the same as the default, 'want'
+func writeSuffix(sb *strings.Builder, lead, want byte) {
+	if lead != want {
+		sb.WriteByte('_')
+		sb.WriteString(headerWidth[lead])
+	}
+}
+
+// writeDiag writes the valid object at the
+// start of 'b' and returns what follows it
+func writeDiag(sb *strings.Builder, b []byte) []byte {
+	lead := b[0]
+	spec := getBytespec(lead)
+	switch spec.typ {
+	case NilType:
+		sb.WriteString("nil")
+		return b[1:]
+	case BoolType:
+		sb.WriteString(strconv.FormatBool(lead == mtrue))
+		return b[1:]
+	case IntType, UintType:
+		var (
+			buf [9]byte
+			def []byte
+			o   []byte
+		)
+		if lead >= muint8 && lead <= muint64 {
+			var u uint64
+			u, o, _ = ReadUint64Bytes(b)
+			sb.WriteString(strconv.FormatUint(u, 10))
+			if u > math.MaxInt64 {
+				def = AppendUint64(buf[:0], u)
+			} else {
+				def = AppendInt64(buf[:0], int64(u))
+			}
+		} else {
+			var i int64
+			i, o, _ = ReadInt64Bytes(b)
+			sb.WriteString(strconv.FormatInt(i, 10))
+			def = AppendInt64(buf[:0], i)
+		}
+		if !bytes.Equal(def, b[:len(b)-len(o)]) {
+			sb.WriteByte('_')
+			sb.WriteString(intSuffix[lead])
+		}
+		return o
+	case Float32Type:
+		f, o, _ := ReadFloat32Bytes(b)
+		s := formatFloat(float64(f), 32)
+		if g, err := strconv.ParseFloat(s, 32); err != nil || math.Float32bits(float32(g)) != math.Float32bits(f) {
+			writeRaw(sb, b[:len(b)-len(o)])
+			return o
+		}
+		sb.WriteString(s)
+		sb.WriteString("_f32")
+		return o
+	case Float64Type:
+		f, o, _ := ReadFloat64Bytes(b)
+		s := formatFloat(f, 64)
+		if g, err := strconv.ParseFloat(s, 64); err != nil || math.Float64bits(g) != math.Float64bits(f) {
+			writeRaw(sb, b[:len(b)-len(o)])
+			return o
+		}
+		sb.WriteString(s)
+		return o
+	case StrType, BinType:
+		hdr, n := header(spec, b)
+		p := b[hdr : hdr+int(n)]
+		if spec.typ == StrType {
+			sb.WriteString(strconv.Quote(string(p)))
+			writeSuffix(sb, lead, appendStrHeader(nil, uint32(len(p)))[0])
+		} else {
+			sb.WriteString("h'")
+			writeHex(sb, p)
+			sb.WriteByte('\'')
+			writeSuffix(sb, lead, AppendBytesHeader(nil, uint32(len(p)))[0])
+		}
+		return b[hdr+int(n):]
+	case ExtensionType:
+		typ, o, data, _ := readExt(b)
+		sb.WriteString("ext(")
+		sb.WriteString(strconv.Itoa(int(typ)))
+		sb.WriteString(", h'")
+		writeHex(sb, data)
+		sb.WriteString("')")
+		def, _ := AppendExtension(nil, &RawExtension{Type: typ, Data: data})
+		writeSuffix(sb, lead, def[0])
+		return o
+	case ArrayType, MapType:
+		hdr, n := header(spec, b)
+		o := b[hdr:]
+		if spec.typ == ArrayType {
+			sb.WriteByte('[')
+		} else {
+			sb.WriteByte('{')
+		}
+		for i := range n {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			if spec.typ == MapType {
+				o = writeDiag(sb, o)
+				sb.WriteString(": ")
+			}
+			o = writeDiag(sb, o)
+		}
+		if spec.typ == ArrayType {
+			sb.WriteByte(']')
+			writeSuffix(sb, lead, AppendArrayHeader(nil, uint32(n))[0])
+		} else {
+			sb.WriteByte('}')
+			writeSuffix(sb, lead, AppendMapHeader(nil, uint32(n))[0])
+		}
+		return o
+	}
+	// unreachable for valid objects
+	writeRaw(sb, b)
+	return nil
+}
+
+func formatFloat(f float64, bits int) string {
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0" // not an integer
+	}
+	return s
+}
+
+// appendStrHeader appends the header
+// that AppendString uses for 'sz' bytes
+func appendStrHeader(b []byte, sz uint32) []byte {
+	switch {
+	case sz <= 31:
+		return append(b, wfixstr(uint8(sz)))
+	case sz <= math.MaxUint8:
+		return appendHeader(b, mstr8, 1, sz)
+	case sz <= math.MaxUint16:
+		return appendHeader(b, mstr16, 2, sz)
+	default:
+		return appendHeader(b, mstr32, 4, sz)
+	}
+}
+
+// appendExtHeader appends the header that
+// AppendExtension uses for 'sz' bytes
+func appendExtHeader(b []byte, typ int8, sz uint32) []byte {
+	switch sz {
+	case 1:
+		return append(b, mfixext1, byte(typ))
+	case 2:
+		return append(b, mfixext2, byte(typ))
+	case 4:
+		return append(b, mfixext4, byte(typ))
+	case 8:
+		return append(b, mfixext8, byte(typ))
+	case 16:
+		return append(b, mfixext16, byte(typ))
+	}
+	switch {
+	case sz < math.MaxUint8:
+		b = appendHeader(b, mext8, 1, sz)
+	case sz < math.MaxUint16:
+		b = appendHeader(b, mext16, 2, sz)
+	default:
+		b = appendHeader(b, mext32, 4, sz)
+	}
+	return append(b, byte(typ))
+}
+
+// appendHeader appends 'lead' followed
+// by 'sz' in 'width' bytes
+func appendHeader(b []byte, lead byte, width int, sz uint32) []byte {
+	b = append(b, lead)
+	for i := width - 1; i >= 0; i-- {
+		b = append(b, byte(sz>>(8*i)))
+	}
+	return b
+}
+
+// ParseDiag parses the diagnostic notation written by Diag
+// and returns the MessagePack that it describes. Objects at
+// the top level may be separated by whitespace or commas.
+func ParseDiag(s string) ([]byte, error) {
+	p := diagParser{s: s}
+	for {
+		p.space()
+		if p.i < len(s) && s[p.i] == ',' {
+			p.i++
+			p.space()
+		}
+		if p.i == len(s) {
+			return p.compact(), nil
+		}
+		if err := p.value(0); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DiagError is returned by ParseDiag
+// when its input is malformed.
+type DiagError struct {
+	Offset int    // the offset of the error in the input
+	Msg    string // a description of the error
+}
+
+// Error implements the error interface
+func (e *DiagError) Error() string {
+	return "msgp: ParseDiag: " + e.Msg + " at offset " + strconv.Itoa(e.Offset)
+}
+
+// Resumable is always 'false' for DiagErrors
+func (e *DiagError) Resumable() bool { return false }
+
+type diagParser struct {
+	s    string
+	i    int
+	out  []byte
+	gaps []diagGap // unused header space in 'out'
+}
+
+// diagGap is the part of the space reserved for
+// a container header that the header didn't need
+type diagGap struct {
+	off, n int
+}
+
+// maxContainerHeader is the space reserved
+// for the header of an array or a map
+const maxContainerHeader = 5
+
+// compact removes the gaps from the output
+func (p *diagParser) compact() []byte {
+	if len(p.gaps) == 0 {
+		return p.out
+	}
+	slices.SortFunc(p.gaps, func(a, b diagGap) int { return a.off - b.off })
+	w := p.gaps[0].off
+	for i, g := range p.gaps {
+		end := len(p.out)
+		if i+1 < len(p.gaps) {
+			end = p.gaps[i+1].off
+		}
+		w += copy(p.out[w:], p.out[g.off+g.n:end])
+	}
+	return p.out[:w]
+}
+
+func (p *diagParser) fail(off int, msg string) error {
+	return &DiagError{Offset: off, Msg: msg}
+}
+
+func (p *diagParser) space() {
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case ' ', '\t', '\n', '\r':
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+// expect consumes 'c' after optional whitespace
+func (p *diagParser) expect(c byte) error {
+	p.space()
+	if p.i == len(p.s) || p.s[p.i] != c {
+		return p.fail(p.i, "expected "+strconv.QuoteRune(rune(c)))
+	}
+	p.i++
+	return nil
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '+' || c == '-'
+}
+
+func (p *diagParser) word() string {
+	start := p.i
+	for p.i < len(p.s) && isWordByte(p.s[p.i]) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// suffix reads the suffix after a string,
+// binary, extension, array or map
+func (p *diagParser) suffix() (string, int) {
+	if p.i < len(p.s) && p.s[p.i] == '_' {
+		p.i++
+		off := p.i
+		return p.word(), off
+	}
+	return "", p.i
+}
+
+// widths are the headers chosen by the suffixes _8, _16 and _32,
+// in the order bin, ext, str, array, map; 0 means that there
+// is no such header
+var widths = map[string][5]byte{
+	"8":  {mbin8, mext8, mstr8, 0, 0},
+	"16": {mbin16, mext16, mstr16, marray16, mmap16},
+	"32": {mbin32, mext32, mstr32, marray32, mmap32},
+}
+
+// sized appends the header for 'sz' elements given
+// the suffix 'suf'. 'kind' is an index into widths,
+// and def appends the default header.
+func (p *diagParser) sized(b []byte, kind int, sz int, suf string, off int, def func([]byte, uint32) []byte) ([]byte, error) {
+	if uint64(sz) > math.MaxUint32 {
+		return b, p.fail(off, "too many elements")
+	}
+	if suf == "" {
+		return def(b, uint32(sz)), nil
+	}
+	leads, ok := widths[suf]
+	if !ok || leads[kind] == 0 {
+		return b, p.fail(off, "unknown suffix _"+suf)
+	}
+	w, _ := strconv.Atoi(suf)
+	if uint64(sz) >= 1<<w {
+		return b, p.fail(off, "too many elements for suffix _"+suf)
+	}
+	return appendHeader(b, leads[kind], w/8, uint32(sz)), nil
+}
+
+func (p *diagParser) hex() ([]byte, error) {
+	if err := p.expect('h'); err != nil {
+		return nil, err
+	}
+	if p.i == len(p.s) || p.s[p.i] != '\'' {
+		return nil, p.fail(p.i, "expected '")
+	}
+	p.i++
+	end := strings.IndexByte(p.s[p.i:], '\'')
+	if end < 0 {
+		return nil, p.fail(p.i, "unterminated hex")
+	}
+	h := p.s[p.i : p.i+end]
+	if len(h)%2 != 0 {
+		return nil, p.fail(p.i, "odd length hex")
+	}
+	out := make([]byte, len(h)/2)
+	for i := range out {
+		hi, lo := unhex(h[2*i]), unhex(h[2*i+1])
+		if hi < 0 || lo < 0 {
+			return nil, p.fail(p.i+2*i, "invalid hex")
+		}
+		out[i] = byte(hi<<4 | lo)
+	}
+	p.i += end + 1
+	return out, nil
+}
+
+func unhex(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+func (p *diagParser) value(depth int) error {
+	p.space()
+	if p.i == len(p.s) {
+		return p.fail(p.i, "unexpected end of input")
+	}
+	start := p.i
+	switch c := p.s[p.i]; {
+	case c == '[' || c == '{':
+		if depth >= recursionLimit {
+			return p.fail(start, "too deeply nested")
+		}
+		return p.container(depth)
+	case c == '"':
+		return p.str()
+	case c == 'h' && p.i+1 < len(p.s) && p.s[p.i+1] == '\'':
+		data, err := p.hex()
+		if err != nil {
+			return err
+		}
+		suf, off := p.suffix()
+		if p.out, err = p.sized(p.out, 0, len(data), suf, off, AppendBytesHeader); err != nil {
+			return err
+		}
+		p.out = append(p.out, data...)
+		return nil
+	}
+	w := p.word()
+	switch w {
+	case "":
+		return p.fail(start, "unexpected "+strconv.QuoteRune(rune(p.s[start])))
+	case "nil":
+		p.out = AppendNil(p.out)
+		return nil
+	case "true", "false":
+		p.out = AppendBool(p.out, w == "true")
+		return nil
+	case "ext":
+		return p.ext()
+	case "raw":
+		if err := p.expect('('); err != nil {
+			return err
+		}
+		data, err := p.hex()
+		if err != nil {
+			return err
+		}
+		p.out = append(p.out, data...)
+		return p.expect(')')
+	}
+	return p.number(w, start)
+}
+
+func (p *diagParser) number(w string, off int) error {
+	num, suf, _ := strings.Cut(w, "_")
+	if num == "" || (num[0] != '-' && num[0] != '+' && (num[0] < '0' || num[0] > '9') && num != "NaN") {
+		return p.fail(off, "unexpected "+strconv.Quote(w))
+	}
+	bad := func() error { return p.fail(off, "invalid number "+strconv.Quote(w)) }
+	isFloat := strings.ContainsAny(num, ".eEIN")
+	switch {
+	case suf == "f32":
+		f, err := strconv.ParseFloat(num, 32)
+		if err != nil {
+			return bad()
+		}
+		p.out = AppendFloat32(p.out, float32(f))
+	case suf == "f64" || (suf == "" && isFloat):
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return bad()
+		}
+		p.out = AppendFloat64(p.out, f)
+	case isFloat:
+		return bad()
+	case suf == "":
+		if i, err := strconv.ParseInt(num, 10, 64); err == nil {
+			p.out = AppendInt64(p.out, i)
+		} else if u, err := strconv.ParseUint(num, 10, 64); err == nil {
+			p.out = AppendUint64(p.out, u)
+		} else {
+			return bad()
+		}
+	case suf[0] == 'u':
+		bits, err := strconv.Atoi(suf[1:])
+		if err != nil || (bits != 8 && bits != 16 && bits != 32 && bits != 64) {
+			return p.fail(off, "unknown suffix _"+suf)
+		}
+		u, err := strconv.ParseUint(num, 10, bits)
+		if err != nil {
+			return bad()
+		}
+		var lead byte
+		switch bits {
+		case 8:
+			lead = muint8
+		case 16:
+			lead = muint16
+		case 32:
+			lead = muint32
+		default:
+			lead = muint64
+		}
+		p.out = appendUint(p.out, lead, bits/8, u)
+	case suf[0] == 'i':
+		bits, err := strconv.Atoi(suf[1:])
+		if err != nil || (bits != 8 && bits != 16 && bits != 32 && bits != 64) {
+			return p.fail(off, "unknown suffix _"+suf)
+		}
+		i, err := strconv.ParseInt(num, 10, bits)
+		if err != nil {
+			return bad()
+		}
+		var lead byte
+		switch bits {
+		case 8:
+			lead = mint8
+		case 16:
+			lead = mint16
+		case 32:
+			lead = mint32
+		default:
+			lead = mint64
+		}
+		p.out = appendUint(p.out, lead, bits/8, uint64(i))
+	default:
+		return p.fail(off, "unknown suffix _"+suf)
+	}
+	return nil
+}
+
+// appendUint appends 'lead' followed by
+// the low 'width' bytes of 'u'
+func appendUint(b []byte, lead byte, width int, u uint64) []byte {
+	b = append(b, lead)
+	for i := width - 1; i >= 0; i-- {
+		b = append(b, byte(u>>(8*i)))
+	}
+	return b
+}
+
+func (p *diagParser) str() error {
+	start := p.i
+	i := p.i + 1
+	for ; i < len(p.s) && p.s[i] != '"'; i++ {
+		if p.s[i] == '\\' {
+			i++
+		}
+	}
+	if i >= len(p.s) {
+		return p.fail(start, "unterminated string")
+	}
+	str, err := strconv.Unquote(p.s[start : i+1])
+	if err != nil {
+		return p.fail(start, "invalid string")
+	}
+	p.i = i + 1
+	suf, off := p.suffix()
+	if p.out, err = p.sized(p.out, 2, len(str), suf, off, appendStrHeader); err != nil {
+		return err
+	}
+	p.out = append(p.out, str...)
+	return nil
+}
+
+func (p *diagParser) ext() error {
+	if err := p.expect('('); err != nil {
+		return err
+	}
+	p.space()
+	off := p.i
+	typ, err := strconv.ParseInt(p.word(), 10, 8)
+	if err != nil {
+		return p.fail(off, "invalid extension type")
+	}
+	if err := p.expect(','); err != nil {
+		return err
+	}
+	p.space()
+	data, err := p.hex()
+	if err != nil {
+		return err
+	}
+	if err := p.expect(')'); err != nil {
+		return err
+	}
+	suf, off := p.suffix()
+	def := func(b []byte, sz uint32) []byte {
+		return appendExtHeader(b, int8(typ), sz)
+	}
+	if p.out, err = p.sized(p.out, 1, len(data), suf, off, def); err != nil {
+		return err
+	}
+	if suf != "" {
+		p.out = append(p.out, byte(typ))
+	}
+	p.out = append(p.out, data...)
+	return nil
+}
+
+// container parses an array or a map. Space for the header is
+// reserved before the elements are written, and the header is
+// written at the end of that space once their number is known.
+// The rest of the space is removed by compact.
+func (p *diagParser) container(depth int) error {
+	isMap := p.s[p.i] == '{'
+	closing := byte(']')
+	if isMap {
+		closing = '}'
+	}
+	p.i++
+	start := len(p.out)
+	p.out = append(p.out, make([]byte, maxContainerHeader)...)
+	n := 0
+	for {
+		p.space()
+		if p.i < len(p.s) && p.s[p.i] == closing {
+			p.i++
+			break
+		}
+		if n > 0 {
+			if err := p.expect(','); err != nil {
+				return err
+			}
+		}
+		if err := p.value(depth + 1); err != nil {
+			return err
+		}
+		if isMap {
+			if err := p.expect(':'); err != nil {
+				return err
+			}
+			if err := p.value(depth + 1); err != nil {
+				return err
+			}
+		}
+		n++
+	}
+	suf, off := p.suffix()
+	var (
+		hdr []byte
+		err error
+	)
+	buf := p.out[start : start : start+maxContainerHeader]
+	if isMap {
+		hdr, err = p.sized(buf, 4, n, suf, off, AppendMapHeader)
+	} else {
+		hdr, err = p.sized(buf, 3, n, suf, off, AppendArrayHeader)
+	}
+	if err != nil {
+		return err
+	}
+	gap := maxContainerHeader - len(hdr)
+	copy(p.out[start+gap:], hdr)
+	if gap > 0 {
+		p.gaps = append(p.gaps, diagGap{off: start, n: gap})
+	}
+	return nil
+}
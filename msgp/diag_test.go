@@ -0,0 +1,115 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiag(t *testing.T) {
+	tests := []struct {
+		diag string
+		raw  []byte
+	}{
+		{`nil`, []byte{0xc0}},
+		{`true`, []byte{0xc3}},
+		{`1`, []byte{0x01}},
+		{`-1`, []byte{0xff}},
+		{`1_u8`, []byte{0xcc, 0x01}},
+		{`200_u8`, []byte{0xcc, 200}},
+		{`200`, []byte{0xd1, 0x00, 200}},
+		{`-5_i64`, []byte{0xd3, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfb}},
+		{`18446744073709551615`, AppendUint64(nil, math.MaxUint64)},
+		{`1.5`, AppendFloat64(nil, 1.5)},
+		{`1.5_f32`, AppendFloat32(nil, 1.5)},
+		{`1.0`, AppendFloat64(nil, 1)},
+		{`-Inf_f32`, AppendFloat32(nil, float32(math.Inf(-1)))},
+		{`"a\x00é"`, AppendString(nil, "a\x00é")},
+		{`"a"_8`, []byte{0xd9, 0x01, 'a'}},
+		{`"\xff"`, []byte{0xa1, 0xff}},
+		{`h'00ff'`, AppendBytes(nil, []byte{0x00, 0xff})},
+		{`h''_32`, []byte{0xc6, 0, 0, 0, 0}},
+		{`ext(5, h'01')`, []byte{0xd4, 0x05, 0x01}},
+		{`ext(-1, h'01')_8`, []byte{0xc7, 0x01, 0xff, 0x01}},
+		{`ext(5, h'')`, []byte{0xc7, 0x00, 0x05}},
+		{`[]`, []byte{0x90}},
+		{`[1, [nil]]_16`, []byte{0xdc, 0x00, 0x02, 0x01, 0x91, 0xc0}},
+		{`[[[]], {"a": [1]_32}]`, []byte{0x92, 0x91, 0x90, 0x81, 0xa1, 'a', 0xdd, 0, 0, 0, 1, 0x01}},
+		{`{"a": 1_u8, 2: {}_32}`, []byte{0x82, 0xa1, 'a', 0xcc, 0x01, 0x02, 0xdf, 0, 0, 0, 0}},
+		{`raw(h'cb7ff8000000000002')`, []byte{0xcb, 0x7f, 0xf8, 0, 0, 0, 0, 0, 0x02}},
+		{"1\n\"x\"", []byte{0x01, 0xa1, 'x'}},
+		{"1\nraw(h'92c1')", []byte{0x01, 0x92, 0xc1}},
+	}
+	for _, tt := range tests {
+		if got := Diag(tt.raw); got != tt.diag {
+			t.Errorf("Diag(%x): got %s; wanted %s", tt.raw, got, tt.diag)
+		}
+		got, err := ParseDiag(tt.diag)
+		if err != nil {
+			t.Errorf("ParseDiag(%s): %v", tt.diag, err)
+		} else if !bytes.Equal(got, tt.raw) {
+			t.Errorf("ParseDiag(%s): got %x; wanted %x", tt.diag, got, tt.raw)
+		}
+	}
+
+	// a mix of everything should survive a round trip
+	raw, err := AppendIntf(nil, map[string]any{
+		"time":  time.Unix(1e9, 5),
+		"list":  []any{int8(-100), uint32(1 << 20), 3.25, float32(-0.5), strings.Repeat("s", 300)},
+		"bytes": bytes.Repeat([]byte{7}, 70000),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ParseDiag(Diag(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(back, raw) {
+		t.Error("round trip changed the encoding")
+	}
+
+	// formatting is flexible
+	got, err := ParseDiag(" [ 1 ,2,{ \"k\":nil } ] , 3 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x93, 0x01, 0x02, 0x81, 0xa1, 'k', 0xc0, 0x03}; !bytes.Equal(got, want) {
+		t.Errorf("got %x; wanted %x", got, want)
+	}
+}
+
+func TestParseDiagErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		off int
+	}{
+		{`[1, 2`, 5},
+		{`{"a" 1}`, 5},
+		{`"abc`, 0},
+		{`h'abc'`, 2},
+		{`h'zz'`, 2},
+		{`256_u8`, 0},
+		{`1_q8`, 0},
+		{`1.5_u8`, 0},
+		{`[1]_8`, 4},
+		{`"a"_64`, 4},
+		{`ext(300, h'')`, 4},
+		{`foo`, 0},
+		{`:`, 0},
+	}
+	for _, tt := range tests {
+		_, err := ParseDiag(tt.in)
+		var derr *DiagError
+		if !errors.As(err, &derr) {
+			t.Errorf("ParseDiag(%s): got %v; wanted a *DiagError", tt.in, err)
+			continue
+		}
+		if derr.Offset != tt.off {
+			t.Errorf("ParseDiag(%s): got offset %d; wanted %d (%v)", tt.in, derr.Offset, tt.off, err)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package msgp
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind is the kind of a Change.
+type ChangeKind uint8
+
+const (
+	// Added means that the value only exists in the new message.
+	Added ChangeKind = iota + 1
+	// Removed means that the value only exists in the old message.
+	Removed
+	// Changed means that the value is different in the new message.
+	Changed
+)
+
+// String implements fmt.Stringer
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	default:
+		return "<invalid>"
+	}
+}
+
+// Change is a difference between two messages,
+// as returned by Diff.
+type Change struct {
+	Path []PathElem // the location of the value
+	Kind ChangeKind
+	Old  Raw // the old value; nil if Kind is Added
+	New  Raw // the new value; nil if Kind is Removed
+}
+
+// String renders the change as a line of text, like
+//
+//	a/1/b: changed 1 -> "one"
+//
+// Values are shown in a notation similar to JSON that
+// keeps 'str', 'bin' and extensions apart.
+func (c Change) String() string {
+	var sb strings.Builder
+	if len(c.Path) == 0 {
+		sb.WriteString("<root>")
+	} else {
+		sb.WriteString(pathString(c.Path))
+	}
+	sb.WriteString(": ")
+	sb.WriteString(c.Kind.String())
+	sb.WriteByte(' ')
+	switch c.Kind {
+	case Added:
+		writeText(&sb, c.New)
+	case Removed:
+		writeText(&sb, c.Old)
+	default:
+		writeText(&sb, c.Old)
+		sb.WriteString(" -> ")
+		writeText(&sb, c.New)
+	}
+	return sb.String()
+}
+
+// MarshalMsg implements Marshaler. A change is encoded as a map
+// with the fields "path" (an array of strings and integers),
+// "kind", and "old" and/or "new".
+func (c Change) MarshalMsg(b []byte) ([]byte, error) {
+	n := uint32(2)
+	if c.Kind != Added {
+		n++
+	}
+	if c.Kind != Removed {
+		n++
+	}
+	o := AppendMapHeader(b, n)
+	o = AppendString(o, "path")
+	o = AppendArrayHeader(o, uint32(len(c.Path)))
+	for _, p := range c.Path {
+		if p.IsIndex {
+			o = AppendInt(o, p.Index)
+		} else {
+			o = AppendString(o, p.Key)
+		}
+	}
+	o = AppendString(o, "kind")
+	o = AppendString(o, c.Kind.String())
+	if c.Kind != Added {
+		o = AppendString(o, "old")
+		o = appendRawOrNil(o, c.Old)
+	}
+	if c.Kind != Removed {
+		o = AppendString(o, "new")
+		o = appendRawOrNil(o, c.New)
+	}
+	return o, nil
+}
+
+func appendRawOrNil(b []byte, r Raw) []byte {
+	if len(r) == 0 {
+		return AppendNil(b)
+	}
+	return append(b, r...)
+}
+
+// FormatChanges renders a list of changes
+// as text, one change per line.
+func FormatChanges(changes []Change) string {
+	var sb strings.Builder
+	for _, c := range changes {
+		sb.WriteString(c.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// AppendChanges appends a list of changes
+// to 'b' as an array of the maps written
+// by (Change).MarshalMsg.
+func AppendChanges(b []byte, changes []Change) []byte {
+	o := AppendArrayHeader(b, uint32(len(changes)))
+	for _, c := range changes {
+		o, _ = c.MarshalMsg(o)
+	}
+	return o
+}
+
+// Diff returns the differences between the
+// first MessagePack objects in 'a' and 'b'.
+//
+// Maps are compared by key, regardless of the order
+// of their entries, and arrays are compared index by index,
+// so a value inserted into an array changes every element
+// after it. Other values are compared as they are by Equal,
+// and the Old and New values of the changes point into 'a' and 'b'.
+// Malformed input is compared byte for byte.
+func Diff(a, b []byte) []Change {
+	d := differ{}
+	d.diff(a, b, 0)
+	return d.out
+}
+
+type differ struct {
+	path []PathElem
+	out  []Change
+}
+
+func (d *differ) add(kind ChangeKind, old, new []byte) {
+	d.out = append(d.out, Change{
+		Path: slices.Clone(d.path),
+		Kind: kind,
+		Old:  old,
+		New:  new,
+	})
+}
+
+// nextObject returns the object at the start of 'b',
+// or all of 'b' if it is malformed
+func nextObject(b []byte) (obj, rest []byte) {
+	o, err := Skip(b)
+	if err != nil {
+		return b, nil
+	}
+	return b[:len(b)-len(o)], o
+}
+
+func (d *differ) diff(a, b []byte, depth int) {
+	ta, tb := InvalidType, InvalidType
+	if _, err := Skip(a); err == nil {
+		ta = getType(a[0])
+	}
+	if _, err := Skip(b); err == nil {
+		tb = getType(b[0])
+	}
+	a, _ = nextObject(a)
+	b, _ = nextObject(b)
+	if depth < recursionLimit && ta == tb && (ta == MapType || ta == ArrayType) {
+		if ta == MapType {
+			d.maps(a, b, depth)
+		} else {
+			d.arrays(a, b, depth)
+		}
+		return
+	}
+	if !Equal(a, b) {
+		d.add(Changed, a, b)
+	}
+}
+
+func (d *differ) arrays(a, b []byte, depth int) {
+	na, oa, _ := ReadArrayHeaderBytes(a)
+	nb, ob, _ := ReadArrayHeaderBytes(b)
+	var va, vb []byte
+	for i := range max(na, nb) {
+		d.path = append(d.path, PathElem{Index: int(i), IsIndex: true})
+		switch {
+		case i >= na:
+			vb, ob = nextObject(ob)
+			d.add(Added, nil, vb)
+		case i >= nb:
+			va, oa = nextObject(oa)
+			d.add(Removed, va, nil)
+		default:
+			va, oa = nextObject(oa)
+			vb, ob = nextObject(ob)
+			d.diff(va, vb, depth+1)
+		}
+		d.path = d.path[:len(d.path)-1]
+	}
+}
+
+// diffEntry is a map entry with its key in canonical form
+type diffEntry struct {
+	key   string
+	path  PathElem
+	value []byte
+}
+
+func diffEntries(b []byte) []diffEntry {
+	sz, o, _ := ReadMapHeaderBytes(b)
+	out := make([]diffEntry, 0, min(uint64(sz), uint64(len(o))/2))
+	var k, v []byte
+	for range sz {
+		k, o = nextObject(o)
+		v, o = nextObject(o)
+		if len(k) == 0 {
+			break
+		}
+		ck, _ := Canonicalize(nil, k)
+		out = append(out, diffEntry{key: string(ck), path: PathElem{Key: keyString(k)}, value: v})
+	}
+	return out
+}
+
+func (d *differ) maps(a, b []byte, depth int) {
+	ea, eb := diffEntries(a), diffEntries(b)
+	idx := make(map[string]int, len(eb))
+	for i, e := range eb {
+		idx[e.key] = i
+	}
+	seen := make([]bool, len(eb))
+	for _, e := range ea {
+		d.path = append(d.path, e.path)
+		if i, ok := idx[e.key]; ok && !seen[i] {
+			seen[i] = true
+			d.diff(e.value, eb[i].value, depth+1)
+		} else {
+			d.add(Removed, e.value, nil)
+		}
+		d.path = d.path[:len(d.path)-1]
+	}
+	for i, e := range eb {
+		if !seen[i] {
+			d.path = append(d.path, e.path)
+			d.add(Added, nil, e.value)
+			d.path = d.path[:len(d.path)-1]
+		}
+	}
+}
+
+// writeText writes a readable rendering of
+// the object at the start of 'b'
+func writeText(sb *strings.Builder, b []byte) {
+	if _, err := Skip(b); err != nil {
+		sb.WriteString("<invalid h'")
+		writeHex(sb, b)
+		sb.WriteString("'>")
+		return
+	}
+	writeRawText(sb, b)
+}
+
+// writeRawText writes the valid object at the
+// start of 'b' and returns what follows it
+func writeRawText(sb *strings.Builder, b []byte) []byte {
+	it, o, _ := readItem(b)
+	switch it.typ {
+	case NilType:
+		sb.WriteString("nil")
+	case BoolType:
+		sb.WriteString(strconv.FormatBool(it.u == 1))
+	case IntType:
+		sb.WriteString(strconv.FormatInt(int64(it.u), 10))
+	case UintType:
+		sb.WriteString(strconv.FormatUint(it.u, 10))
+	case Float64Type:
+		f := strconv.FormatFloat(math.Float64frombits(it.u), 'g', -1, 64)
+		sb.WriteString(f)
+		if !strings.ContainsAny(f, ".eIN") {
+			sb.WriteString(".0") // not an integer
+		}
+	case StrType:
+		sb.WriteString(strconv.Quote(string(it.p)))
+	case BinType:
+		sb.WriteString("h'")
+		writeHex(sb, it.p)
+		sb.WriteByte('\'')
+	case ExtensionType:
+		sb.WriteString("ext(")
+		sb.WriteString(strconv.Itoa(int(it.ext)))
+		sb.WriteString(", h'")
+		writeHex(sb, it.p)
+		sb.WriteString("')")
+	case ArrayType:
+		sb.WriteByte('[')
+		for i := range it.u {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			o = writeRawText(sb, o)
+		}
+		sb.WriteByte(']')
+	case MapType:
+		sb.WriteByte('{')
+		for i := range it.u {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			o = writeRawText(sb, o)
+			sb.WriteString(": ")
+			o = writeRawText(sb, o)
+		}
+		sb.WriteByte('}')
+	}
+	return o
+}
+
+func writeHex(sb *strings.Builder, p []byte) {
+	for _, c := range p {
+		sb.WriteByte(hex[c>>4])
+		sb.WriteByte(hex[c&0xf])
+	}
+}
@@ -0,0 +1,80 @@
+package msgp
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := AppendMapHeader(nil, 5)
+	old = AppendString(old, "id")
+	old = AppendInt(old, 7)
+	old = AppendString(old, "name")
+	old = AppendString(old, "a")
+	old = AppendString(old, "tags")
+	old = AppendArrayHeader(old, 2)
+	old = AppendString(old, "x")
+	old = AppendString(old, "y")
+	old = AppendString(old, "gone")
+	old = AppendBool(old, true)
+	old = AppendString(old, "ext")
+	old, _ = AppendExtension(old, &RawExtension{Type: 9, Data: []byte{1}})
+
+	// same id with a different encoding, entries reordered
+	new := AppendMapHeader(nil, 5)
+	new = AppendString(new, "ext")
+	new, _ = AppendExtension(new, &RawExtension{Type: 9, Data: []byte{2}})
+	new = AppendString(new, "tags")
+	new = AppendArrayHeader(new, 3)
+	new = AppendString(new, "x")
+	new = AppendBytes(new, []byte("y"))
+	new = AppendFloat64(new, 2)
+	new = AppendString(new, "name")
+	new = AppendString(new, "a")
+	new = AppendString(new, "id")
+	new = AppendUint64(new, 7)
+	new = AppendString(new, "added")
+	new = AppendNil(new)
+
+	want := `tags/1: changed "y" -> h'79'
+tags/2: added 2.0
+gone: removed true
+ext: changed ext(9, h'01') -> ext(9, h'02')
+added: added nil
+`
+	changes := Diff(old, new)
+	if got := FormatChanges(changes); got != want {
+		t.Errorf("got:\n%s\nwanted:\n%s", got, want)
+	}
+
+	// the msgpack rendering
+	doc := AppendChanges(nil, changes)
+	got, _, err := ReadIntfBytes(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := got.([]any)[0].(map[string]any)
+	if p := first["path"].([]any); len(p) != 2 || p[0] != "tags" || p[1] != int64(1) {
+		t.Errorf("got path %v", p)
+	}
+	if first["kind"] != "changed" || first["old"] != "y" || string(first["new"].([]byte)) != "y" {
+		t.Errorf("got change %v", first)
+	}
+
+	// every kind writes as many fields as its header says
+	for _, k := range []ChangeKind{0, Added, Removed, Changed, 9} {
+		raw, _ := Change{Kind: k}.MarshalMsg(nil)
+		if rest, err := Validate(raw, Limits{}); err != nil || len(rest) != 0 {
+			t.Errorf("kind %d: got %x, %v", k, rest, err)
+		}
+	}
+
+	if changes := Diff(old, old); len(changes) != 0 {
+		t.Errorf("got changes to the same message: %v", changes)
+	}
+	if got := FormatChanges(Diff(AppendInt(nil, 1), AppendString(nil, "1"))); got != "<root>: changed 1 -> \"1\"\n" {
+		t.Errorf("got %q", got)
+	}
+	if got := FormatChanges(Diff(AppendArrayHeader(nil, 1), []byte{0x91, 0xc0})); got != "<root>: changed <invalid h'91'> -> [nil]\n" {
+		t.Errorf("got %q", got)
+	}
+}
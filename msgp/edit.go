@@ -2,6 +2,7 @@ package msgp
 
 import (
 	"math"
+	"slices"
 )
 
 // Locate returns a []byte pointing to the field
@@ -13,6 +14,118 @@ func Locate(key string, raw []byte) []byte {
 	return raw[s:n]
 }
 
+// LocateMany locates the fields with the provided keys in a
+// messagepack map in a single pass over 'raw'. For each index i,
+// out[i] is set to a sub-slice of 'raw' pointing to the value
+// of keys[i], or to a zero-length slice if the key doesn't exist.
+// If a key occurs more than once in the map, the first occurrence is used.
+// LocateMany returns the number of keys that were found, and does no allocations.
+// 'out' must have at least len(keys) elements.
+//
+// LocateMany compares every field against every key, so a
+// [KeySet] should be preferred for more than a handful of keys.
+func LocateMany(raw []byte, keys []string, out [][]byte) int {
+	out = out[:len(keys)]
+	for i := range out {
+		out[i] = raw[:0]
+	}
+	sz, bts, err := ReadMapHeaderBytes(raw)
+	if err != nil {
+		return 0
+	}
+	var (
+		field []byte
+		found int
+	)
+	for i := uint32(0); i < sz && found < len(keys); i++ {
+		field, bts, err = ReadStringZC(bts)
+		if err != nil {
+			return found
+		}
+		start := len(raw) - len(bts)
+		bts, err = Skip(bts)
+		if err != nil {
+			return found
+		}
+		end := len(raw) - len(bts)
+		for j, key := range keys {
+			if len(out[j]) == 0 && UnsafeString(field) == key {
+				out[j] = raw[start:end]
+				found++
+			}
+		}
+	}
+	return found
+}
+
+// KeySet is a precompiled set of map keys that
+// can be located in a messagepack map in a single pass.
+// A KeySet is safe for concurrent use once created.
+type KeySet struct {
+	keys []string
+	idx  map[string][]int
+}
+
+// NewKeySet returns a KeySet for the provided keys.
+// The order of 'keys' determines the order of the
+// values filled in by (*KeySet).Locate.
+func NewKeySet(keys ...string) *KeySet {
+	ks := &KeySet{
+		keys: slices.Clone(keys),
+		idx:  make(map[string][]int, len(keys)),
+	}
+	for i, key := range keys {
+		ks.idx[key] = append(ks.idx[key], i)
+	}
+	return ks
+}
+
+// Len returns the number of keys in the set.
+func (ks *KeySet) Len() int { return len(ks.keys) }
+
+// Keys returns a copy of the keys in the set.
+func (ks *KeySet) Keys() []string { return slices.Clone(ks.keys) }
+
+// Locate works like [LocateMany] with the keys of the set,
+// but the cost of looking up a field does not depend
+// on the number of keys. 'out' must have at least ks.Len() elements.
+// Locate does no allocations.
+func (ks *KeySet) Locate(raw []byte, out [][]byte) int {
+	out = out[:len(ks.keys)]
+	for i := range out {
+		out[i] = raw[:0]
+	}
+	sz, bts, err := ReadMapHeaderBytes(raw)
+	if err != nil {
+		return 0
+	}
+	var (
+		field []byte
+		found int
+	)
+	for i := uint32(0); i < sz && found < len(ks.keys); i++ {
+		field, bts, err = ReadStringZC(bts)
+		if err != nil {
+			return found
+		}
+		start := len(raw) - len(bts)
+		bts, err = Skip(bts)
+		if err != nil {
+			return found
+		}
+		idx, ok := ks.idx[UnsafeString(field)]
+		if !ok || len(out[idx[0]]) != 0 {
+			continue
+		}
+		end := len(raw) - len(bts)
+		for _, j := range idx {
+			out[j] = raw[start:end]
+			found++
+		}
+	}
+	return found
+}
+
 // Replace takes a key ("key") in a messagepack map ("raw")
 // and replaces its value with the one provided and returns
 // the new []byte. The returned []byte may point to the same
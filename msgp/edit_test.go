@@ -3,6 +3,7 @@ package msgp
 import (
 	"bytes"
 	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -83,6 +84,74 @@ func TestLocate(t *testing.T) {
 	}
 }
 
+func TestLocateMany(t *testing.T) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	en.WriteMapHeader(4)
+	en.WriteString("thing_one")
+	en.WriteString("value_one")
+	en.WriteString("thing_two")
+	en.WriteFloat64(2.0)
+	en.WriteString("thing_three")
+	en.WriteArrayHeader(2)
+	en.WriteInt(1)
+	en.WriteInt(2)
+	en.WriteString("thing_one")
+	en.WriteString("duplicate")
+	en.Flush()
+	raw := buf.Bytes()
+
+	keys := []string{"thing_three", "nope", "thing_one", "thing_two", "thing_one"}
+	check := func(name string, n int, out [][]byte) {
+		t.Helper()
+		if n != 4 {
+			t.Errorf("%s: found %d keys; wanted 4", name, n)
+		}
+		for i, key := range keys {
+			want := Locate(key, raw)
+			if !bytes.Equal(out[i], want) {
+				t.Errorf("%s: key %q: got %x; wanted %x", name, key, out[i], want)
+			}
+		}
+	}
+
+	out := make([][]byte, len(keys))
+	check("LocateMany", LocateMany(raw, keys, out), out)
+
+	ks := NewKeySet(keys...)
+	if ks.Len() != len(keys) {
+		t.Errorf("got Len() %d; wanted %d", ks.Len(), len(keys))
+	}
+	out = make([][]byte, ks.Len())
+	check("KeySet", ks.Locate(raw, out), out)
+
+	if n := ks.Locate([]byte{mnil}, out); n != 0 {
+		t.Errorf("found %d keys in a non-map", n)
+	}
+	for i := range out {
+		if len(out[i]) != 0 {
+			t.Errorf("key %q: wanted a zero-length slice", keys[i])
+		}
+	}
+
+	// the set doesn't share the caller's slice
+	ks.Keys()[0] = "changed"
+	ks2 := NewKeySet(keys...)
+	keys[0] = "changed"
+	if !slices.Equal(ks2.Keys(), ks.Keys()) || ks.Keys()[0] != "thing_three" {
+		t.Errorf("keys changed: %q", ks2.Keys())
+	}
+	keys[0] = "thing_three"
+
+	allocs := testing.AllocsPerRun(100, func() {
+		LocateMany(raw, keys, out)
+		ks.Locate(raw, out)
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocs; wanted 0", allocs)
+	}
+}
+
 func TestReplace(t *testing.T) {
 	// there are 4 cases that need coverage:
 	//  - new value is smaller than old value
@@ -197,3 +266,26 @@ func BenchmarkLocate(b *testing.B) {
 		Locate("thing_three", raw)
 	}
 }
+
+func BenchmarkKeySetLocate(b *testing.B) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	en.WriteMapHeader(3)
+	en.WriteString("thing_one")
+	en.WriteString("value_one")
+	en.WriteString("thing_two")
+	en.WriteFloat64(2.0)
+	en.WriteString("thing_three")
+	en.WriteBytes([]byte("hello!"))
+	en.Flush()
+
+	raw := buf.Bytes()
+	ks := NewKeySet("thing_three", "thing_one")
+	out := make([][]byte, ks.Len())
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ks.Locate(raw, out)
+	}
+}
@@ -10,7 +10,10 @@ const resumableDefault = false
 var (
 	// ErrShortBytes is returned when the
 	// slice being decoded is too short to
-	// contain the contents of the message
+	// contain the contents of the message.
+	// Errors from generated code wrap it with
+	// its location (see LocatedError), so use
+	// errors.Is to check for it there.
 	ErrShortBytes error = errShort{}
 
 	// ErrRecursion is returned when the maximum recursion limit is reached for an operation.
@@ -21,6 +24,14 @@ var (
 	// Limits can be set on the Reader to prevent excessive memory usage by adversarial data.
 	ErrLimitExceeded error = errLimitExceeded{}
 
+	// ErrInvalidUTF8 is returned by validation
+	// when a 'str' object is not valid UTF-8.
+	ErrInvalidUTF8 error = errInvalidUTF8{}
+
+	// ErrDuplicateKey is returned by Canonicalize
+	// when a map has the same key more than once.
+	ErrDuplicateKey error = errDuplicateKey{}
+
 	// this error is only returned
 	// if we reach code that should
 	// be unreachable
@@ -40,6 +51,28 @@ type Error interface {
 	Resumable() bool
 }
 
+// LocatedError is implemented by errors that record
+// where in the input they occurred. Errors returned by
+// generated code implement it, and it can be retrieved
+// from them with errors.As. The error that was located
+// is still found by errors.Is, errors.As and Cause.
+type LocatedError interface {
+	error
+
+	// Offset returns the offset of the value that caused
+	// the error from the start of the input, or -1 if
+	// the offset isn't known. For errors about a value
+	// that was read in full, like IntOverflow, the offset
+	// in a []byte is that of the end of the value.
+	Offset() int64
+
+	// Path returns the location of the value
+	// that caused the error within the object,
+	// using the map keys and array indexes of
+	// the encoded object.
+	Path() []PathElem
+}
+
 // contextError allows msgp Error instances to be enhanced with additional
 // context about their origin.
 type contextError interface {
@@ -50,9 +83,136 @@ type contextError interface {
 	withContext(ctx string) error
 }
 
+// locatedError implements LocatedError by
+// wrapping an error with its location
+type locatedError struct {
+	err  error
+	path *pathNode
+	off  int64 // offset plus one, or zero if unknown
+	rest int64 // bytes left in a []byte input plus one, or zero if unknown
+}
+
+// pathNode is a (shared, immutable) list of
+// path elements, outermost first
+type pathNode struct {
+	elems []PathElem
+	next  *pathNode
+}
+
+func (e *locatedError) Error() string { return e.err.Error() }
+
+// Unwrap returns the error that was located.
+func (e *locatedError) Unwrap() error { return e.err }
+
+func (e *locatedError) Resumable() bool { return Resumable(e.err) }
+
+// Offset implements LocatedError
+func (e *locatedError) Offset() int64 { return e.off - 1 }
+
+// Path implements LocatedError
+func (e *locatedError) Path() []PathElem {
+	var out []PathElem
+	for n := e.path; n != nil; n = n.next {
+		out = append(out, n.elems...)
+	}
+	return out
+}
+
+// within returns a copy of the error with
+// context added to both the error and the path
+func (e *locatedError) within(ctx []any) *locatedError {
+	out := *e
+	out.err = withContext(e.err, ctx)
+	if elems := ctxPath(ctx); len(elems) > 0 {
+		out.path = &pathNode{elems: elems, next: e.path}
+	}
+	return &out
+}
+
+// located returns 'err' with context added and
+// its location recorded, if it doesn't have one yet
+func located(err error, ctx []any) *locatedError {
+	e, ok := err.(*locatedError)
+	if !ok {
+		e = &locatedError{err: err}
+	}
+	return e.within(ctx)
+}
+
+// FieldContext is WrapError context for a struct field:
+// error messages show the Go name of the field, and the
+// paths of located errors show its key in the encoded
+// object, or its index if the struct is a tuple.
+// Generated code creates it with FieldKey and FieldIndex.
+type FieldContext struct {
+	name string
+	elem PathElem
+}
+
+// FieldKey returns the context for the field 'name',
+// which is encoded in a map with the key 'key'.
+func FieldKey(name, key string) FieldContext {
+	return FieldContext{name: name, elem: PathElem{Key: key}}
+}
+
+// FieldIndex returns the context for the field 'name',
+// which is encoded in an array at index 'idx'.
+func FieldIndex(name string, idx int) FieldContext {
+	return FieldContext{name: name, elem: PathElem{Index: idx, IsIndex: true}}
+}
+
+// String returns the Go name of the field.
+func (f FieldContext) String() string { return f.name }
+
+// ctxPath converts WrapError context into path elements.
+// Integers become indexes; everything else becomes a key.
+func ctxPath(ctx []any) []PathElem {
+	if len(ctx) == 0 {
+		return nil
+	}
+	out := make([]PathElem, len(ctx))
+	for i, cv := range ctx {
+		idx, ok := 0, true
+		switch v := cv.(type) {
+		case FieldContext:
+			out[i] = v.elem
+			continue
+		case int:
+			idx = v
+		case int8:
+			idx = int(v)
+		case int16:
+			idx = int(v)
+		case int32:
+			idx = int(v)
+		case int64:
+			idx = int(v)
+		case uint:
+			idx = int(v)
+		case uint8:
+			idx = int(v)
+		case uint16:
+			idx = int(v)
+		case uint32:
+			idx = int(v)
+		case uint64:
+			idx = int(v)
+		case string:
+			out[i].Key, ok = v, false
+		default:
+			out[i].Key, ok = ctxString(ctx[i:i+1]), false
+		}
+		out[i].Index, out[i].IsIndex = idx, ok
+	}
+	return out
+}
+
 // Cause returns the underlying cause of an error that has been wrapped
 // with additional context.
 func Cause(e error) error {
+	if l, ok := e.(*locatedError); ok {
+		e = l.err
+	}
 	out := e
 	if e, ok := e.(errWrapped); ok && e.cause != nil {
 		out = e.cause
@@ -74,10 +234,18 @@ func Resumable(e error) bool {
 // can be retrieved using Cause()
 //
 // The input error is not modified - a new error should be returned.
+// If the error is a LocatedError, the context is also added to its path.
 //
 // ErrShortBytes is not wrapped with any context due to backward compatibility
 // issues with the public API.
 func WrapError(err error, ctx ...any) error {
+	if e, ok := err.(*locatedError); ok {
+		return e.within(ctx)
+	}
+	return withContext(err, ctx)
+}
+
+func withContext(err error, ctx []any) error {
 	switch e := err.(type) {
 	case errShort:
 		return e
@@ -88,6 +256,39 @@ func WrapError(err error, ctx ...any) error {
 	}
 }
 
+// WrapError is like the WrapError function, and it returns a
+// LocatedError, which records the offset of the reader as the
+// location of the error if the error doesn't have one yet.
+// Generated DecodeMsg methods use it to wrap errors.
+func (m *Reader) WrapError(err error, ctx ...any) error {
+	e := located(err, ctx)
+	if e.off == 0 {
+		e.off = m.R.InputOffset() + 1
+	}
+	return e
+}
+
+// WrapErrorBytes is like WrapError, and it returns a LocatedError,
+// which records the location of the error within 'in', given that
+// 'rest' was left to decode when it occurred. Generated UnmarshalMsg
+// methods use it to wrap errors, and they return their input on
+// error so that callers can do the same.
+func WrapErrorBytes(err error, in, rest []byte, ctx ...any) error {
+	e := located(err, ctx)
+	if e.rest == 0 {
+		if rest == nil {
+			// not known; e.g. a hand-written
+			// UnmarshalMsg returned nil on error
+			return e
+		}
+		e.rest = int64(len(rest)) + 1
+	}
+	// outer contexts see more of the input,
+	// so they replace the offset from inner ones
+	e.off = int64(len(in)) - (e.rest - 1) + 1
+	return e
+}
+
 func addCtx(ctx, add string) string {
 	if ctx != "" {
 		return add + "/" + ctx
@@ -152,6 +353,45 @@ type errLimitExceeded struct{}
 func (e errLimitExceeded) Error() string   { return "msgp: configured reader limit exceeded" }
 func (e errLimitExceeded) Resumable() bool { return false }
 
+type errInvalidUTF8 struct{}
+
+func (e errInvalidUTF8) Error() string   { return "msgp: invalid UTF-8 in str" }
+func (e errInvalidUTF8) Resumable() bool { return false }
+
+type errDuplicateKey struct{}
+
+func (e errDuplicateKey) Error() string   { return "msgp: duplicate map key" }
+func (e errDuplicateKey) Resumable() bool { return false }
+
+// PathElem is one step in the location of a value inside
+// of a MessagePack object: either a map key or an array index.
+type PathElem struct {
+	Key     string // map key; only valid if !IsIndex
+	Index   int    // array index; only valid if IsIndex
+	IsIndex bool
+}
+
+// String returns the key or the decimal index.
+func (p PathElem) String() string {
+	if p.IsIndex {
+		return strconv.Itoa(p.Index)
+	}
+	return p.Key
+}
+
+// pathString joins the path the same
+// way that error contexts are joined
+func pathString(path []PathElem) string {
+	out := ""
+	for i, p := range path {
+		if i > 0 {
+			out += "/"
+		}
+		out += p.String()
+	}
+	return out
+}
+
 // ArrayError is an error returned
 // when decoding a fix-sized array
 // of the wrong size
@@ -177,3 +177,58 @@ func TestSimpleQuoteStr(t *testing.T) {
 		})
 	}
 }
+
+func TestLocatedError(t *testing.T) {
+	// bytes: inner errors see less of the input than outer ones
+	in := []byte("0123456789")
+	err := WrapErrorBytes(&TypeError{}, in[4:], in[6:], "b", 2)
+	err = WrapErrorBytes(err, in, in[4:], "a")
+	var lerr LocatedError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("%T is not a LocatedError", err)
+	}
+	if lerr.Offset() != 6 {
+		t.Errorf("got offset %d; wanted 6", lerr.Offset())
+	}
+	if got := pathString(lerr.Path()); got != "a/b/2" {
+		t.Errorf("got path %q; wanted %q", got, "a/b/2")
+	}
+	if p := lerr.Path(); !p[2].IsIndex || p[2].Index != 2 {
+		t.Errorf("got %+v; wanted index 2", p[2])
+	}
+
+	// streams: the innermost offset wins
+	r := NewReader(strings.NewReader("abcdef"))
+	r.R.Skip(3)
+	err = r.WrapError(errors.New("test"), "x")
+	r.R.Skip(2)
+	err = r.WrapError(err, "y")
+	if !errors.As(err, &lerr) || lerr.Offset() != 3 {
+		t.Errorf("got %v; wanted offset 3", err)
+	}
+	if got := pathString(lerr.Path()); got != "y/x" {
+		t.Errorf("got path %q; wanted %q", got, "y/x")
+	}
+
+	// the located error is still found, and WrapError
+	// adds to the path without changing the offset
+	err = WrapError(WrapErrorBytes(ErrShortBytes, in, in[1:]), "z")
+	if !errors.Is(err, ErrShortBytes) || Cause(err) != ErrShortBytes || err.Error() != ErrShortBytes.Error() {
+		t.Errorf("got %v", err)
+	}
+	if !errors.As(err, &lerr) || lerr.Offset() != 1 || pathString(lerr.Path()) != "z" {
+		t.Errorf("got offset %d, path %q", lerr.Offset(), pathString(lerr.Path()))
+	}
+	err = WrapErrorBytes(TypeError{Method: StrType, Encoded: IntType}, in, in[1:], FieldKey("Name", "name"), FieldIndex("Tup", 2))
+	if _, ok := Cause(err).(TypeError); !ok || !Resumable(err) || !strings.HasSuffix(err.Error(), " at Name/Tup") {
+		t.Errorf("got %v", err)
+	}
+	if !errors.As(err, &lerr) || pathString(lerr.Path()) != "name/2" || !lerr.Path()[1].IsIndex {
+		t.Errorf("got path %+v", lerr.Path())
+	}
+
+	// no location
+	if errors.As(WrapError(io.EOF, "z"), &lerr) {
+		t.Errorf("%v is a LocatedError", lerr)
+	}
+}
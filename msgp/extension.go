@@ -4,6 +4,7 @@ import (
 	"errors"
 	"math"
 	"strconv"
+	"sync"
 )
 
 const (
@@ -24,8 +25,119 @@ const (
 // msgTimeExtension is a painful workaround to avoid "constant -1 overflows byte".
 var msgTimeExtension = int8(MsgTimeExtension)
 
-// our extensions live here
-var extensionReg = make(map[int8]func() Extension)
+// ConflictPolicy is what ExtensionRegistry.Register does
+// when the extension type is already registered.
+type ConflictPolicy uint8
+
+const (
+	// ConflictError makes Register return an ExtensionConflictError
+	ConflictError ConflictPolicy = iota
+	// ConflictOverride makes Register replace the registered extension
+	ConflictOverride
+)
+
+// ExtensionConflictError is returned by ExtensionRegistry.Register
+// when the extension type is already registered in the registry.
+type ExtensionConflictError struct {
+	Type int8
+}
+
+// Error implements the error interface
+func (e ExtensionConflictError) Error() string {
+	return "msgp: extension type " + strconv.Itoa(int(e.Type)) + " is already registered"
+}
+
+// ExtensionRegistry maps extension types to functions that return new
+// Extensions, for the methods that decode `interface{}` values: ReadIntf,
+// ReadIntfBytes and the JSON conversions, WriteToJSON and UnmarshalAsJSON.
+// (Readers use the registry set with SetExtensions, and the package-level
+// functions use DefaultExtensions.) An extension type that isn't registered
+// is decoded as a *RawExtension.
+//
+// Each registry is a separate namespace: registering a type in one
+// doesn't affect the others. A registry created with a parent falls
+// back to it for the types it doesn't have, and a type registered in
+// the registry shadows the parent's. So a library can use its own
+// registry, created with DefaultExtensions as its parent, without
+// conflicting with the types that other libraries register globally,
+// and a test can register temporary types in a registry of its own.
+//
+// The zero value is an empty registry without a parent.
+// An ExtensionRegistry is safe for concurrent use.
+type ExtensionRegistry struct {
+	parent *ExtensionRegistry
+
+	mu    sync.RWMutex
+	types map[int8]func() Extension
+}
+
+// DefaultExtensions is the global registry, used by RegisterExtension,
+// by ReadIntfBytes, and by Readers that don't have a registry set.
+var DefaultExtensions = &ExtensionRegistry{}
+
+// NewExtensionRegistry returns an empty registry that falls back
+// to 'parent', which may be nil, for the types it doesn't have.
+func NewExtensionRegistry(parent *ExtensionRegistry) *ExtensionRegistry {
+	return &ExtensionRegistry{parent: parent}
+}
+
+// Register registers 'f' for the extension type 'typ'. f() should return
+// a newly-initialized zero value of the extension. If 'typ' is already
+// registered in the registry (not in its parent), 'policy' decides
+// whether Register returns an ExtensionConflictError or replaces it.
+// Types 3, 4, and 5 are reserved for complex64, complex128, and time.Time,
+// and Register returns an error for them.
+func (x *ExtensionRegistry) Register(typ int8, f func() Extension, policy ConflictPolicy) error {
+	switch typ {
+	case Complex64Extension, Complex128Extension, TimeExtension:
+		return errors.New("msgp: forbidden extension type: " + strconv.Itoa(int(typ)))
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if _, ok := x.types[typ]; ok && policy != ConflictOverride {
+		return ExtensionConflictError{Type: typ}
+	}
+	if x.types == nil {
+		x.types = make(map[int8]func() Extension)
+	}
+	x.types[typ] = f
+	return nil
+}
+
+// Unregister removes the extension type 'typ' from the registry.
+// It doesn't remove it from the parent.
+func (x *ExtensionRegistry) Unregister(typ int8) {
+	x.mu.Lock()
+	delete(x.types, typ)
+	x.mu.Unlock()
+}
+
+// Lookup returns the function registered for the extension
+// type 'typ' in the registry or, failing that, in its parent.
+func (x *ExtensionRegistry) Lookup(typ int8) (f func() Extension, ok bool) {
+	for ; x != nil; x = x.parent {
+		x.mu.RLock()
+		f, ok = x.types[typ]
+		x.mu.RUnlock()
+		if ok {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// SetExtensions makes the Reader decode extensions in ReadIntf
+// (and WriteToJSON) with the types registered in 'x'.
+// A nil 'x' restores the default, DefaultExtensions.
+func (m *Reader) SetExtensions(x *ExtensionRegistry) { m.ext = x }
+
+// Extensions returns the registry that the Reader uses.
+func (m *Reader) Extensions() *ExtensionRegistry {
+	if m.ext == nil {
+		return DefaultExtensions
+	}
+	return m.ext
+}
 
 // RegisterExtension registers extensions so that they
 // can be initialized and returned by methods that
@@ -40,18 +152,19 @@ var extensionReg = make(map[int8]func() Extension)
 //
 //	msgp.RegisterExtension(10, func() msgp.Extension { &MyExtension{} })
 //
-// RegisterExtension will panic if you call it multiple times
-// with the same 'typ' argument, or if you use a reserved
-// type (3, 4, or 5).
+// RegisterExtension registers the extension in DefaultExtensions.
+// It will panic if you call it multiple times with the same
+// 'typ' argument, or if you use a reserved type (3, 4, or 5).
+// See ExtensionRegistry for registering extensions that
+// don't conflict with those of other packages.
 func RegisterExtension(typ int8, f func() Extension) {
-	switch typ {
-	case Complex64Extension, Complex128Extension, TimeExtension:
-		panic(errors.New("msgp: forbidden extension type: " + strconv.Itoa(int(typ))))
-	}
-	if _, ok := extensionReg[typ]; ok {
+	err := DefaultExtensions.Register(typ, f, ConflictError)
+	if _, ok := err.(ExtensionConflictError); ok {
 		panic(errors.New("msgp: RegisterExtension() called with typ " + strconv.Itoa(int(typ)) + " more than once"))
 	}
-	extensionReg[typ] = f
+	if err != nil {
+		panic(err)
+	}
 }
 
 // ExtensionTypeError is an error type returned
@@ -214,6 +327,19 @@ func (mw *Writer) WriteExtension(e Extension) error {
 		return err
 	}
 
+	// open containers stay in the buffer,
+	// so it has to grow to fit the object
+	if len(mw.open) > 0 && length > mw.avail() {
+		if err := mw.flush(); err != nil {
+			return err
+		}
+		if length > mw.avail() {
+			if err := mw.grow(length); err != nil {
+				return err
+			}
+		}
+	}
+
 	// we can only write directly to the
 	// buffer if we're sure that it
 	// fits the object
@@ -375,6 +501,9 @@ func (m *Reader) peekExtensionHeader() (offset int, length int, extType int8, er
 // object in the stream is not an extension, or if
 // e.Type() is not the same as the wire type.
 func (m *Reader) ReadExtension(e Extension) error {
+	if err := m.skipPayload(); err != nil {
+		return err
+	}
 	offset, length, extType, err := m.peekExtensionHeader()
 	if err != nil {
 		return err
@@ -386,6 +515,9 @@ func (m *Reader) ReadExtension(e Extension) error {
 	if uint32(length) > m.GetMaxElements() {
 		return ErrLimitExceeded
 	}
+	if err := m.charge(uint64(length)); err != nil {
+		return err
+	}
 
 	p, err := m.R.Peek(offset + length)
 	if err != nil {
@@ -403,6 +535,9 @@ func (m *Reader) ReadExtension(e Extension) error {
 // as an extension. The returned slice is only
 // valid until the next *Reader method call.
 func (m *Reader) ReadExtensionRaw() (int8, []byte, error) {
+	if err := m.skipPayload(); err != nil {
+		return 0, nil, err
+	}
 	offset, length, extType, err := m.peekExtensionHeader()
 	if err != nil {
 		return 0, nil, err
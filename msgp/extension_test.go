@@ -203,3 +203,81 @@ func BenchmarkExtensionReadWrite(b *testing.B) {
 		}
 	})
 }
+
+// regExt is an extension for registry tests
+type regExt struct{ RawExtension }
+
+func (e *regExt) MarshalJSON() ([]byte, error) { return []byte(`"reg"`), nil }
+
+func TestExtensionRegistry(t *testing.T) {
+	const typ = 42
+	newExt := func() Extension { return &regExt{RawExtension{Type: typ}} }
+	msg, _ := AppendExtension(nil, &RawExtension{Type: typ, Data: []byte{1, 2, 3}})
+
+	lib := NewExtensionRegistry(DefaultExtensions)
+	if err := lib.Register(typ, newExt, ConflictError); err != nil {
+		t.Fatal(err)
+	}
+	err := lib.Register(typ, newExt, ConflictError)
+	if err != (ExtensionConflictError{Type: typ}) {
+		t.Errorf("got %v; wanted a conflict", err)
+	}
+	if err := lib.Register(typ, newExt, ConflictOverride); err != nil {
+		t.Error(err)
+	}
+	if err := lib.Register(TimeExtension, newExt, ConflictOverride); err == nil {
+		t.Error("no error for a reserved type")
+	}
+
+	// the global registry is unaffected
+	if _, ok := DefaultExtensions.Lookup(typ); ok {
+		t.Fatal("type registered globally")
+	}
+	i, _, err := ReadIntfBytes(msg)
+	if _, ok := i.(*RawExtension); !ok || err != nil {
+		t.Errorf("got %T, %v; wanted *RawExtension", i, err)
+	}
+	i, _, err = lib.ReadIntfBytes(msg)
+	if _, ok := i.(*regExt); !ok || err != nil {
+		t.Errorf("got %T, %v; wanted *regExt", i, err)
+	}
+
+	// and so do the JSON conversions
+	var js bytes.Buffer
+	if _, err := lib.UnmarshalAsJSON(&js, msg); err != nil || js.String() != `"reg"` {
+		t.Errorf("got %s, %v", js.Bytes(), err)
+	}
+	js.Reset()
+	if _, err := UnmarshalAsJSON(&js, msg); err != nil || js.String() == `"reg"` {
+		t.Errorf("got %s, %v", js.Bytes(), err)
+	}
+	js.Reset()
+	m := NewReader(bytes.NewReader(msg))
+	m.SetExtensions(lib)
+	if _, err := m.WriteToJSON(&js); err != nil || js.String() != `"reg"` {
+		t.Errorf("got %s, %v", js.Bytes(), err)
+	}
+	m = NewReader(bytes.NewReader(msg))
+	m.SetExtensions(lib)
+	i, err = m.ReadIntf()
+	if _, ok := i.(*regExt); !ok || err != nil {
+		t.Errorf("got %T, %v; wanted *regExt", i, err)
+	}
+
+	// the parent's types are visible, and shadowed by the child's
+	const other = 43
+	if err := DefaultExtensions.Register(other, newExt, ConflictError); err != nil {
+		t.Fatal(err)
+	}
+	defer DefaultExtensions.Unregister(other)
+	if _, ok := lib.Lookup(other); !ok {
+		t.Error("parent type not found")
+	}
+	if _, ok := NewExtensionRegistry(nil).Lookup(other); ok {
+		t.Error("type found without a parent")
+	}
+	lib.Unregister(typ)
+	if _, ok := lib.Lookup(typ); ok {
+		t.Error("type found after Unregister")
+	}
+}
@@ -66,6 +66,9 @@ type MarshalSizer interface {
 // performs as expected in a production environment.
 // (Linux users should run a kernel and filesystem
 // that support fallocate(2) for the best results.)
+//
+// WriteFileSafe does not depend on Msgsize being
+// an upper bound.
 func WriteFile(src MarshalSizer, file *os.File) error {
 	sz := src.Msgsize()
 	err := fallocate(file, int64(sz))
@@ -88,3 +91,64 @@ func WriteFile(src MarshalSizer, file *os.File) error {
 	}
 	return file.Truncate(int64(len(chunk)))
 }
+
+// WriteFileSafe is like WriteFile, but it does not depend
+// on the size estimate being correct. If 'src' implements
+// Sizer, the file is written through a mapping of Msgsize()
+// bytes; if the encoded object turns out to be larger than that
+// (or 'src' isn't a Sizer), it is written with ordinary writes instead.
+// Either way, the file is truncated to the exact size of
+// the object, and, if 'sync' is set, committed to stable storage.
+func WriteFileSafe(src Marshaler, file *os.File, sync bool) error {
+	sz := 0
+	if s, ok := src.(Sizer); ok {
+		sz = s.Msgsize()
+	}
+	n, err := writeMapped(src, file, sz)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(n); err != nil {
+		return err
+	}
+	if sync {
+		return file.Sync()
+	}
+	return nil
+}
+
+// writeMapped writes 'src' through a mapping of the first 'sz'
+// bytes of 'file', or with WriteAt if it doesn't fit, and
+// returns the size of the object
+func writeMapped(src Marshaler, file *os.File, sz int) (int64, error) {
+	if sz <= 0 {
+		out, err := src.MarshalMsg(nil)
+		if err != nil {
+			return 0, err
+		}
+		_, err = file.WriteAt(out, 0)
+		return int64(len(out)), err
+	}
+	err := fallocate(file, int64(sz))
+	if err != nil {
+		return 0, err
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, sz, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return 0, err
+	}
+	adviseWrite(data)
+	// MarshalMsg can't write past the capacity of the mapping,
+	// so an underestimate moves the output to the heap
+	out, err := src.MarshalMsg(data[:0])
+	moved := len(out) > 0 && &out[0] != &data[0]
+	uerr := syscall.Munmap(data)
+	if err == nil {
+		err = uerr
+	}
+	if err != nil || !moved {
+		return int64(len(out)), err
+	}
+	_, err = file.WriteAt(out, 0)
+	return int64(len(out)), err
+}
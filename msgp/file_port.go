@@ -45,3 +45,23 @@ func WriteFile(src MarshalSizer, file *os.File) error {
 	_, err = file.Write(raw)
 	return err
 }
+
+// WriteFileSafe writes 'src' to 'file', truncates it
+// to the size of the object, and commits it to
+// stable storage if 'sync' is set.
+func WriteFileSafe(src Marshaler, file *os.File, sync bool) error {
+	raw, err := src.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(raw, 0); err != nil {
+		return err
+	}
+	if err := file.Truncate(int64(len(raw))); err != nil {
+		return err
+	}
+	if sync {
+		return file.Sync()
+	}
+	return nil
+}
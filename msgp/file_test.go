@@ -61,6 +61,59 @@ func TestReadWriteFile(t *testing.T) {
 	}
 }
 
+// badSize underestimates its size
+type badSize struct{ rawBytes }
+
+func (b badSize) Msgsize() int { return 1 }
+
+// noSize is not a Sizer
+type noSize struct{ data []byte }
+
+func (n noSize) MarshalMsg(b []byte) ([]byte, error) {
+	return msgp.AppendBytes(b, n.data), nil
+}
+
+func TestWriteFileSafe(t *testing.T) {
+	t.Parallel()
+
+	name := t.TempDir() + "/tmpfile"
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data := make([]byte, 100*1024)
+	rand.Read(data)
+	srcs := []struct {
+		name string
+		src  msgp.Marshaler
+	}{
+		{"exact", rawBytes(data)},
+		{"underestimated", badSize{rawBytes(data)}},
+		{"not a sizer", noSize{data}},
+		{"shorter", rawBytes(data[:10])},
+	}
+	for _, tt := range srcs {
+		// every write replaces a longer file
+		if _, err := f.WriteAt(make([]byte, 200*1024), 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := msgp.WriteFileSafe(tt.src, f, tt.name == "exact"); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		want, _ := tt.src.MarshalMsg(nil)
+		f.Seek(0, io.SeekStart)
+		got, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: wrote %d bytes; wanted %d", tt.name, len(got), len(want))
+		}
+	}
+}
+
 var (
 	blobstrings = []string{"", "a string", "a longer string here!"}
 	blobfloats  = []float64{0.0, -1.0, 1.0, 3.1415926535}
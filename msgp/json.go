@@ -61,6 +61,9 @@ func CopyToJSON(dst io.Writer, src io.Reader) (n int64, err error) {
 // JSON to 'w' until the underlying reader returns io.EOF. It returns
 // the number of bytes written, and an error if it stopped before EOF.
 func (m *Reader) WriteToJSON(w io.Writer) (n int64, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var j jsWriter
 	var bf *bufio.Writer
 	if jsw, ok := w.(jsWriter); ok {
@@ -306,7 +309,7 @@ func rwExtension(dst jsWriter, src *Reader) (n int, err error) {
 
 	// registered extensions can override
 	// the JSON encoding
-	if j, ok := extensionReg[et]; ok {
+	if j, ok := src.Extensions().Lookup(et); ok {
 		var bts []byte
 		e := j()
 		err = src.ReadExtension(e)
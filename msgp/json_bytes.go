@@ -9,12 +9,12 @@ import (
 	"time"
 )
 
-var unfuns [_maxtype]func(jsWriter, []byte, []byte, int) ([]byte, []byte, error)
+var unfuns [_maxtype]func(jsWriter, []byte, []byte, int, *ExtensionRegistry) ([]byte, []byte, error)
 
 func init() {
 	// NOTE(pmh): this is best expressed as a jump table,
 	// but gc doesn't do that yet. revisit post-go1.5.
-	unfuns = [_maxtype]func(jsWriter, []byte, []byte, int) ([]byte, []byte, error){
+	unfuns = [_maxtype]func(jsWriter, []byte, []byte, int, *ExtensionRegistry) ([]byte, []byte, error){
 		StrType:        rwStringBytes,
 		BinType:        rwBytesBytes,
 		MapType:        rwMapBytes,
@@ -36,8 +36,15 @@ func init() {
 // it as JSON to 'w'. If an error is returned, the
 // bytes not translated will also be returned. If
 // no errors are encountered, the length of the returned
-// slice will be zero.
+// slice will be zero. Extensions are converted with the
+// types registered in DefaultExtensions.
 func UnmarshalAsJSON(w io.Writer, msg []byte) ([]byte, error) {
+	return DefaultExtensions.UnmarshalAsJSON(w, msg)
+}
+
+// UnmarshalAsJSON is like the package-level UnmarshalAsJSON,
+// but it converts extensions with the types registered in 'x'.
+func (x *ExtensionRegistry) UnmarshalAsJSON(w io.Writer, msg []byte) ([]byte, error) {
 	var (
 		scratch []byte
 		cast    bool
@@ -51,7 +58,7 @@ func UnmarshalAsJSON(w io.Writer, msg []byte) ([]byte, error) {
 		dst = bufio.NewWriterSize(w, 512)
 	}
 	for len(msg) > 0 && err == nil {
-		msg, scratch, err = writeNext(dst, msg, scratch, 0)
+		msg, scratch, err = writeNext(dst, msg, scratch, 0, x)
 	}
 	if !cast && err == nil {
 		err = dst.(*bufio.Writer).Flush()
@@ -59,7 +66,7 @@ func UnmarshalAsJSON(w io.Writer, msg []byte) ([]byte, error) {
 	return msg, err
 }
 
-func writeNext(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func writeNext(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	if len(msg) < 1 {
 		return msg, scratch, ErrShortBytes
 	}
@@ -76,10 +83,10 @@ func writeNext(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byt
 			t = TimeType
 		}
 	}
-	return unfuns[t](w, msg, scratch, depth)
+	return unfuns[t](w, msg, scratch, depth, x)
 }
 
-func rwArrayBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwArrayBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	if depth >= recursionLimit {
 		return msg, scratch, ErrRecursion
 	}
@@ -98,7 +105,7 @@ func rwArrayBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []
 				return msg, scratch, err
 			}
 		}
-		msg, scratch, err = writeNext(w, msg, scratch, depth+1)
+		msg, scratch, err = writeNext(w, msg, scratch, depth+1, x)
 		if err != nil {
 			return msg, scratch, err
 		}
@@ -107,7 +114,7 @@ func rwArrayBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []
 	return msg, scratch, err
 }
 
-func rwMapBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwMapBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	if depth >= recursionLimit {
 		return msg, scratch, ErrRecursion
 	}
@@ -126,7 +133,7 @@ func rwMapBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []by
 				return msg, scratch, err
 			}
 		}
-		msg, scratch, err = rwMapKeyBytes(w, msg, scratch, depth)
+		msg, scratch, err = rwMapKeyBytes(w, msg, scratch, depth, x)
 		if err != nil {
 			return msg, scratch, err
 		}
@@ -134,7 +141,7 @@ func rwMapBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []by
 		if err != nil {
 			return msg, scratch, err
 		}
-		msg, scratch, err = writeNext(w, msg, scratch, depth+1)
+		msg, scratch, err = writeNext(w, msg, scratch, depth+1, x)
 		if err != nil {
 			return msg, scratch, err
 		}
@@ -143,7 +150,7 @@ func rwMapBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []by
 	return msg, scratch, err
 }
 
-func rwMapKeyBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwMapKeyBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	if len(msg) < 1 {
 		return msg, scratch, ErrShortBytes
 	}
@@ -165,16 +172,16 @@ func rwMapKeyBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, [
 		_, err = rwquoted(w, scratch)
 		return msg, scratch, err
 	}
-	msg, scratch, err := rwStringBytes(w, msg, scratch, depth)
+	msg, scratch, err := rwStringBytes(w, msg, scratch, depth, x)
 	if err != nil {
 		if tperr, ok := err.(TypeError); ok && tperr.Encoded == BinType {
-			return rwBytesBytes(w, msg, scratch, depth)
+			return rwBytesBytes(w, msg, scratch, depth, x)
 		}
 	}
 	return msg, scratch, err
 }
 
-func rwStringBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwStringBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	str, msg, err := ReadStringZC(msg)
 	if err != nil {
 		return msg, scratch, err
@@ -183,7 +190,7 @@ func rwStringBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, [
 	return msg, scratch, err
 }
 
-func rwBytesBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwBytesBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	bts, msg, err := ReadBytesZC(msg)
 	if err != nil {
 		return msg, scratch, err
@@ -207,7 +214,7 @@ func rwBytesBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []
 	return msg, scratch, err
 }
 
-func rwNullBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwNullBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	msg, err := ReadNilBytes(msg)
 	if err != nil {
 		return msg, scratch, err
@@ -216,7 +223,7 @@ func rwNullBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []b
 	return msg, scratch, err
 }
 
-func rwBoolBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwBoolBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	b, msg, err := ReadBoolBytes(msg)
 	if err != nil {
 		return msg, scratch, err
@@ -229,7 +236,7 @@ func rwBoolBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []b
 	return msg, scratch, err
 }
 
-func rwIntBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwIntBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	i, msg, err := ReadInt64Bytes(msg)
 	if err != nil {
 		return msg, scratch, err
@@ -239,7 +246,7 @@ func rwIntBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []by
 	return msg, scratch, err
 }
 
-func rwUintBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwUintBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	u, msg, err := ReadUint64Bytes(msg)
 	if err != nil {
 		return msg, scratch, err
@@ -249,7 +256,7 @@ func rwUintBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []b
 	return msg, scratch, err
 }
 
-func rwFloat32Bytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwFloat32Bytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	var f float32
 	var err error
 	f, msg, err = ReadFloat32Bytes(msg)
@@ -261,7 +268,7 @@ func rwFloat32Bytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte,
 	return msg, scratch, err
 }
 
-func rwFloat64Bytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwFloat64Bytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	var f float64
 	var err error
 	f, msg, err = ReadFloat64Bytes(msg)
@@ -273,7 +280,7 @@ func rwFloat64Bytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte,
 	return msg, scratch, err
 }
 
-func rwTimeBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwTimeBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	var t time.Time
 	var err error
 	t, msg, err = ReadTimeBytes(msg)
@@ -288,7 +295,7 @@ func rwTimeBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []b
 	return msg, scratch, err
 }
 
-func rwExtensionBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte, []byte, error) {
+func rwExtensionBytes(w jsWriter, msg []byte, scratch []byte, depth int, x *ExtensionRegistry) ([]byte, []byte, error) {
 	var err error
 	var et int8
 	et, err = peekExtension(msg)
@@ -313,7 +320,7 @@ func rwExtensionBytes(w jsWriter, msg []byte, scratch []byte, depth int) ([]byte
 
 	// if the extension is registered,
 	// use its canonical JSON form
-	if f, ok := extensionReg[et]; ok {
+	if f, ok := x.Lookup(et); ok {
 		e := f()
 		msg, err = ReadExtensionBytes(msg, e)
 		if err != nil {
@@ -0,0 +1,243 @@
+package msgp
+
+import (
+	"io"
+	"math"
+	"unicode/utf8"
+)
+
+// Limits describes the bounds that untrusted
+// MessagePack data must stay within.
+// The zero value of each field means "no limit",
+// except for MaxDepth, where it selects the default
+// recursion limit of 100000.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of maps and arrays.
+	MaxDepth int
+
+	// MaxElements is the maximum number of elements in a map, array,
+	// 'bin' or extension payload. Maps are counted by key/value pairs.
+	MaxElements uint32
+
+	// MaxStringLength is the maximum number of bytes in a 'str'.
+	MaxStringLength uint64
+
+	// MaxTotalBytes is the budget for a whole input.
+	// Every 'str', 'bin' and extension is charged its length,
+	// and every map and array is charged 16 bytes per entry.
+	MaxTotalBytes uint64
+
+	// ValidateUTF8 requires every 'str' to be valid UTF-8.
+	// It is only enforced by validation and ReadStringBytesLimits,
+	// since other decoding methods never inspect string contents.
+	ValidateUTF8 bool
+}
+
+func (l *Limits) maxDepth() int {
+	if l.MaxDepth <= 0 {
+		return recursionLimit
+	}
+	return l.MaxDepth
+}
+
+func (l *Limits) maxElements() uint32 {
+	if l.MaxElements == 0 {
+		return math.MaxUint32
+	}
+	return l.MaxElements
+}
+
+func (l *Limits) maxTotalBytes() uint64 {
+	if l.MaxTotalBytes == 0 {
+		return math.MaxUint64
+	}
+	return l.MaxTotalBytes
+}
+
+func (l *Limits) maxStringLength() uint64 {
+	if l.MaxStringLength == 0 {
+		return math.MaxUint64
+	}
+	return l.MaxStringLength
+}
+
+// elementCost is the number of bytes charged
+// to the total budget for each map entry or
+// array element, since decoding them usually
+// allocates, even if they are encoded in one byte.
+const elementCost = 16
+
+// UntrustedLimits returns the limits set by NewReaderUntrusted.
+// Each call returns a new copy, which the caller may modify.
+func UntrustedLimits() Limits {
+	return Limits{
+		MaxDepth:        100,
+		MaxElements:     1 << 20,
+		MaxStringLength: 1 << 20,
+		MaxTotalBytes:   64 << 20,
+	}
+}
+
+// NewReaderUntrusted returns a *Reader like NewReader,
+// with UntrustedLimits applied. It should be used to
+// decode input that may have been crafted to exhaust
+// memory; see also SetMaxTotalBytes.
+//
+// The MaxTotalBytes budget covers everything that the
+// Reader decodes until it is refilled, so a Reader that
+// decodes a stream of messages should call ResetTotalBytes
+// before each one; otherwise the stream fails with
+// ErrLimitExceeded once enough valid messages have
+// been decoded.
+func NewReaderUntrusted(r io.Reader) *Reader {
+	m := NewReader(r)
+	m.SetLimits(UntrustedLimits())
+	return m
+}
+
+// SetLimits sets all of the limits of the Reader at once.
+// It is equivalent to calling SetMaxRecursionDepth, SetMaxElements,
+// SetMaxStringLength and SetMaxTotalBytes with the corresponding
+// fields of 'l'.
+func (m *Reader) SetLimits(l Limits) {
+	m.maxRecursionDepth = l.MaxDepth
+	m.maxElements = l.MaxElements
+	m.maxStrLen = l.MaxStringLength
+	m.SetMaxTotalBytes(l.MaxTotalBytes)
+	m.validateUTF8 = l.ValidateUTF8
+}
+
+// SetMaxTotalBytes sets a budget for the data decoded by the Reader,
+// so that a message can't make it allocate too much memory in total,
+// even if each string or array is within the other limits.
+//
+// Reading a 'str', 'bin' or extension charges its length
+// to the budget, and reading a map or array header charges
+// 16 bytes for each entry. This includes the reads made by
+// ReadIntf and by generated DecodeMsg methods. Once the budget
+// is exhausted, every charge fails with ErrLimitExceeded.
+//
+// The budget covers the Reader's lifetime, not a single message:
+// setting it (or calling Reset or ResetTotalBytes) refills it.
+// Setting it to 0 removes it.
+func (m *Reader) SetMaxTotalBytes(n uint64) {
+	m.maxTotal = n
+	m.total = 0
+}
+
+// ResetTotalBytes refills the budget set by SetMaxTotalBytes
+// without changing its size. To apply the budget to each
+// message in a stream rather than to the whole stream,
+// call it before decoding each message.
+func (m *Reader) ResetTotalBytes() { m.total = 0 }
+
+// TotalBytes returns the number of bytes charged to the
+// budget set by SetMaxTotalBytes so far, or 0 if there is none.
+func (m *Reader) TotalBytes() uint64 { return m.total }
+
+// charge charges 'n' bytes to the total budget
+func (m *Reader) charge(n uint64) error {
+	if m.maxTotal == 0 {
+		return nil
+	}
+	m.total += n
+	if m.total > m.maxTotal {
+		return ErrLimitExceeded
+	}
+	return nil
+}
+
+func (m *Reader) chargeElements(n uint32) error {
+	return m.charge(uint64(n) * elementCost)
+}
+
+// Limits returns the limits currently set on the Reader.
+func (m *Reader) Limits() Limits {
+	return Limits{
+		MaxDepth:        m.maxRecursionDepth,
+		MaxElements:     m.maxElements,
+		MaxStringLength: m.maxStrLen,
+		MaxTotalBytes:   m.maxTotal,
+		ValidateUTF8:    m.validateUTF8,
+	}
+}
+
+// UnmarshalWithLimits unmarshals the first object in 'b' into 'u',
+// after checking that it is well-formed and within the limits in 'l'.
+// It gives generated UnmarshalMsg methods the same protection against
+// untrusted input that a Reader with SetLimits gives DecodeMsg, without
+// having to regenerate code to change the limits.
+//
+// Objects that exceed the limits are rejected with a *ValidationError
+// before 'u' is modified. The check does not allocate.
+func UnmarshalWithLimits(u Unmarshaler, b []byte, l Limits) (o []byte, err error) {
+	if _, err = Validate(b, l); err != nil {
+		return b, err
+	}
+	return u.UnmarshalMsg(b)
+}
+
+// ReadIntfBytesLimits is like ReadIntfBytes,
+// but it first checks that the object is
+// within the limits in 'l'. See UnmarshalWithLimits.
+func ReadIntfBytesLimits(b []byte, l Limits) (i any, o []byte, err error) {
+	if _, err = Validate(b, l); err != nil {
+		return nil, b, err
+	}
+	return ReadIntfBytes(b)
+}
+
+// ReadMapHeaderBytesLimits is like ReadMapHeaderBytes,
+// but it returns ErrLimitExceeded if the map has more
+// than l.MaxElements entries.
+func ReadMapHeaderBytesLimits(b []byte, l Limits) (sz uint32, o []byte, err error) {
+	sz, o, err = ReadMapHeaderBytes(b)
+	if err == nil && sz > l.maxElements() {
+		return 0, b, ErrLimitExceeded
+	}
+	return sz, o, err
+}
+
+// ReadArrayHeaderBytesLimits is like ReadArrayHeaderBytes,
+// but it returns ErrLimitExceeded if the array has more
+// than l.MaxElements elements.
+func ReadArrayHeaderBytesLimits(b []byte, l Limits) (sz uint32, o []byte, err error) {
+	sz, o, err = ReadArrayHeaderBytes(b)
+	if err == nil && sz > l.maxElements() {
+		return 0, b, ErrLimitExceeded
+	}
+	return sz, o, err
+}
+
+// ReadBytesBytesLimits is like ReadBytesBytes, but it
+// returns ErrLimitExceeded without copying anything
+// if the 'bin' is longer than l.MaxElements bytes.
+func ReadBytesBytesLimits(b []byte, scratch []byte, l Limits) (v []byte, o []byte, err error) {
+	sz, _, err := ReadBytesHeader(b)
+	if err != nil {
+		return nil, b, err
+	}
+	if sz > l.maxElements() {
+		return nil, b, ErrLimitExceeded
+	}
+	return ReadBytesBytes(b, scratch)
+}
+
+// ReadStringBytesLimits is like ReadStringBytes, but it
+// returns ErrLimitExceeded without allocating if the
+// 'str' is longer than l.MaxStringLength bytes.
+// If l.ValidateUTF8 is set, it also returns ErrInvalidUTF8
+// if the string is not valid UTF-8.
+func ReadStringBytesLimits(b []byte, l Limits) (s string, o []byte, err error) {
+	v, o, err := ReadStringZC(b)
+	if err != nil {
+		return "", b, err
+	}
+	if uint64(len(v)) > l.maxStringLength() {
+		return "", b, ErrLimitExceeded
+	}
+	if l.ValidateUTF8 && !utf8.Valid(v) {
+		return "", b, ErrInvalidUTF8
+	}
+	return string(v), o, nil
+}
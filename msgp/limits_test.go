@@ -0,0 +1,142 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalWithLimits(t *testing.T) {
+	raw := AppendArrayHeader(nil, 3)
+	raw = AppendString(raw, "abcd")
+	raw = AppendArrayHeader(raw, 1)
+	raw = AppendArrayHeader(raw, 0)
+	raw = AppendNil(raw)
+	rest := AppendInt(nil, 1)
+	in := append(raw, rest...)
+
+	var r Raw
+	o, err := UnmarshalWithLimits(&r, in, Limits{MaxElements: 3, MaxStringLength: 4, MaxDepth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, raw) || !bytes.Equal(o, rest) {
+		t.Errorf("got %x, rest %x", []byte(r), o)
+	}
+
+	for _, l := range []Limits{
+		{MaxElements: 2},
+		{MaxStringLength: 3},
+		{MaxDepth: 2},
+	} {
+		r = nil
+		o, err := UnmarshalWithLimits(&r, in, l)
+		if !errors.Is(err, ErrLimitExceeded) && !errors.Is(err, ErrRecursion) {
+			t.Errorf("%+v: got %v", l, err)
+		}
+		if r != nil || !bytes.Equal(o, in) {
+			t.Errorf("%+v: input was consumed", l)
+		}
+		_, o, err = ReadIntfBytesLimits(in, l)
+		if err == nil || !bytes.Equal(o, in) {
+			t.Errorf("%+v: ReadIntfBytesLimits: got %v", l, err)
+		}
+	}
+}
+
+func TestReadBytesLimits(t *testing.T) {
+	l := Limits{MaxElements: 2, MaxStringLength: 2, ValidateUTF8: true}
+	tests := []struct {
+		name string
+		ok   []byte
+		bad  []byte
+		read func([]byte) ([]byte, error)
+	}{
+		{"map", AppendMapHeader(nil, 2), AppendMapHeader(nil, 3), func(b []byte) ([]byte, error) {
+			_, o, err := ReadMapHeaderBytesLimits(b, l)
+			return o, err
+		}},
+		{"array", AppendArrayHeader(nil, 2), AppendArrayHeader(nil, 3), func(b []byte) ([]byte, error) {
+			_, o, err := ReadArrayHeaderBytesLimits(b, l)
+			return o, err
+		}},
+		{"bin", AppendBytes(nil, []byte("ab")), AppendBytes(nil, []byte("abc")), func(b []byte) ([]byte, error) {
+			_, o, err := ReadBytesBytesLimits(b, nil, l)
+			return o, err
+		}},
+		{"str", AppendString(nil, "ab"), AppendString(nil, "abc"), func(b []byte) ([]byte, error) {
+			_, o, err := ReadStringBytesLimits(b, l)
+			return o, err
+		}},
+	}
+	for _, tt := range tests {
+		if o, err := tt.read(tt.ok); err != nil || len(o) != 0 {
+			t.Errorf("%s: got %v, rest %x", tt.name, err, o)
+		}
+		if o, err := tt.read(tt.bad); err != ErrLimitExceeded || !bytes.Equal(o, tt.bad) {
+			t.Errorf("%s: got %v, rest %x; wanted %v", tt.name, err, o, ErrLimitExceeded)
+		}
+	}
+
+	bad := AppendStringFromBytes(nil, []byte{0xff})
+	if _, _, err := ReadStringBytesLimits(bad, l); err != ErrInvalidUTF8 {
+		t.Errorf("got %v; wanted %v", err, ErrInvalidUTF8)
+	}
+}
+
+func TestMaxTotalBytes(t *testing.T) {
+	// each string is within the per-item limits,
+	// but there are too many of them
+	raw := AppendArrayHeader(nil, 10)
+	for range 10 {
+		raw = AppendString(raw, strings.Repeat("x", 100))
+	}
+	l := Limits{MaxStringLength: 100, MaxTotalBytes: 500}
+
+	r := NewReader(bytes.NewReader(raw))
+	r.SetLimits(l)
+	_, err := r.ReadIntf()
+	if err != ErrLimitExceeded {
+		t.Errorf("got %v; wanted %v", err, ErrLimitExceeded)
+	}
+	if Resumable(err) {
+		t.Error("budget error is resumable")
+	}
+	// the budget stays exhausted
+	if err := r.charge(1); err != ErrLimitExceeded {
+		t.Errorf("got %v; wanted %v", err, ErrLimitExceeded)
+	}
+
+	r.Reset(bytes.NewReader(raw))
+	r.SetMaxTotalBytes(10*100 + 10*elementCost)
+	if _, err := r.ReadIntf(); err != nil {
+		t.Fatal(err)
+	}
+	if r.TotalBytes() != 10*100+10*elementCost {
+		t.Errorf("got %d bytes charged", r.TotalBytes())
+	}
+
+	// a stream of messages that each fit the budget
+	r.Reset(bytes.NewReader(bytes.Repeat(raw, 3)))
+	for i := range 3 {
+		r.ResetTotalBytes()
+		if _, err := r.ReadIntf(); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	r.Reset(bytes.NewReader(bytes.Repeat(raw, 2)))
+	r.ReadIntf()
+	if _, err := r.ReadIntf(); err != ErrLimitExceeded {
+		t.Errorf("got %v; wanted %v without ResetTotalBytes", err, ErrLimitExceeded)
+	}
+
+	if _, err := Validate(raw, l); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Validate: got %v; wanted %v", err, ErrLimitExceeded)
+	}
+
+	r = NewReaderUntrusted(bytes.NewReader(bytes.Repeat([]byte{0x91}, 200)))
+	if _, err := r.ReadIntf(); err != ErrRecursion {
+		t.Errorf("got %v; wanted %v", err, ErrRecursion)
+	}
+}
@@ -0,0 +1,161 @@
+// Package msgphttp provides helpers for HTTP request
+// and response bodies encoded as MessagePack.
+package msgphttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// ContentType is the media type of MessagePack bodies.
+const ContentType = "application/msgpack"
+
+// the media types accepted for MessagePack,
+// including ones that predate the registration
+var contentTypes = []string{ContentType, "application/x-msgpack", "application/vnd.msgpack"}
+
+var (
+	// ErrUnsupportedMediaType is returned by DecodeRequest when
+	// the Content-Type of the request isn't MessagePack. Handlers
+	// usually respond with http.StatusUnsupportedMediaType.
+	ErrUnsupportedMediaType = errors.New("msgphttp: request body is not MessagePack")
+
+	// ErrTrailingData is returned by DecodeRequest when
+	// the request body holds more than one object.
+	ErrTrailingData = errors.New("msgphttp: trailing data after request body")
+)
+
+var (
+	readers = sync.Pool{New: func() any { return msgp.NewReader(nil) }}
+	writers = sync.Pool{New: func() any { return msgp.NewWriter(nil) }}
+)
+
+// isMsgpack reports whether 'mediaType' is one of contentTypes
+func isMsgpack(mediaType string) bool {
+	for _, t := range contentTypes {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeRequest decodes the body of 'r' into 'v', which must be the
+// only object in it. The Content-Type of the request must be MessagePack,
+// or else ErrUnsupportedMediaType is returned. The body is decoded within
+// 'limits' (see msgp.Limits); the zero value selects msgp.UntrustedLimits(),
+// since request bodies are untrusted. The body isn't closed.
+func DecodeRequest(r *http.Request, v msgp.Decodable, limits msgp.Limits) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !isMsgpack(mediaType) {
+		return ErrUnsupportedMediaType
+	}
+	if limits == (msgp.Limits{}) {
+		limits = msgp.UntrustedLimits()
+	}
+	mr := readers.Get().(*msgp.Reader)
+	mr.Reset(r.Body)
+	mr.SetLimits(limits)
+	err = v.DecodeMsg(mr)
+	if err == nil {
+		if _, perr := mr.R.Peek(1); perr != io.EOF {
+			err = ErrTrailingData
+			if perr != nil {
+				err = perr
+			}
+		}
+	}
+	mr.Reset(nil)
+	readers.Put(mr)
+	return err
+}
+
+// WriteResponse writes 'v' as the body of a response with
+// the given status code. Since the body is written as it is
+// encoded, an error from EncodeMsg leaves it incomplete.
+func WriteResponse(w http.ResponseWriter, status int, v msgp.Encodable) error {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	mw := writers.Get().(*msgp.Writer)
+	mw.Reset(w)
+	err := v.EncodeMsg(mw)
+	if err == nil {
+		err = mw.Flush()
+	}
+	mw.Reset(nil)
+	writers.Put(mw)
+	return err
+}
+
+// Negotiate returns the media type of the response to 'r', according
+// to its Accept header: ContentType, or "application/json" if the client
+// prefers JSON or doesn't accept MessagePack. MessagePack wins ties,
+// and it is also chosen if the client accepts neither.
+func Negotiate(r *http.Request) string {
+	accept := r.Header.Values("Accept")
+	if len(accept) == 0 {
+		return ContentType
+	}
+	var qmsgp, qjson float64
+	for _, h := range accept {
+		for _, rng := range strings.Split(h, ",") {
+			mediaType, params, err := mime.ParseMediaType(rng)
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(s, 64); err != nil {
+					continue
+				}
+			}
+			switch {
+			case isMsgpack(mediaType):
+				qmsgp = max(qmsgp, q)
+			case strings.EqualFold(mediaType, "application/json"):
+				qjson = max(qjson, q)
+			case mediaType == "*/*" || strings.EqualFold(mediaType, "application/*"):
+				qmsgp = max(qmsgp, q)
+				qjson = max(qjson, q)
+			}
+		}
+	}
+	if qjson > qmsgp {
+		return "application/json"
+	}
+	return ContentType
+}
+
+// Respond writes 'v' as the body of a response to 'r' with the given
+// status code, as MessagePack or as JSON, depending on Negotiate.
+// JSON is translated from MessagePack with msgp.CopyToJSON, so it
+// is only written once 'v' has been encoded successfully.
+func Respond(w http.ResponseWriter, r *http.Request, status int, v msgp.Encodable) error {
+	if Negotiate(r) == ContentType {
+		return WriteResponse(w, status, v)
+	}
+	var buf bytes.Buffer
+	mw := writers.Get().(*msgp.Writer)
+	mw.Reset(&buf)
+	err := v.EncodeMsg(mw)
+	if err == nil {
+		err = mw.Flush()
+	}
+	mw.Reset(nil)
+	writers.Put(mw)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = msgp.CopyToJSON(w, &buf)
+	return err
+}
@@ -0,0 +1,148 @@
+package msgphttp
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// item has hand-written methods, in place of generated ones
+type item struct {
+	Name string
+	Tags []string
+}
+
+func (it *item) DecodeMsg(r *msgp.Reader) error {
+	sz, err := r.ReadMapHeader()
+	if err != nil {
+		return err
+	}
+	for range sz {
+		key, err := r.ReadString()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "name":
+			it.Name, err = r.ReadString()
+		case "tags":
+			var n uint32
+			if n, err = r.ReadArrayHeader(); err != nil {
+				return err
+			}
+			it.Tags = make([]string, n)
+			for i := range it.Tags {
+				if it.Tags[i], err = r.ReadString(); err != nil {
+					return err
+				}
+			}
+		default:
+			err = r.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (it *item) EncodeMsg(w *msgp.Writer) error {
+	w.WriteMapHeader(2)
+	w.WriteString("name")
+	w.WriteString(it.Name)
+	w.WriteString("tags")
+	w.WriteArrayHeader(uint32(len(it.Tags)))
+	for _, t := range it.Tags {
+		if err := w.WriteString(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encode(t *testing.T, v msgp.Encodable) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := msgp.Encode(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeRequest(t *testing.T) {
+	body := encode(t, &item{Name: "x", Tags: []string{"a", "b"}})
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		limits      msgp.Limits
+		want        error
+	}{
+		{"ok", ContentType, body, msgp.Limits{}, nil},
+		{"with params", "application/x-msgpack; charset=binary", body, msgp.Limits{}, nil},
+		{"json", "application/json", []byte(`{"name":"x"}`), msgp.Limits{}, ErrUnsupportedMediaType},
+		{"no type", "", body, msgp.Limits{}, ErrUnsupportedMediaType},
+		{"trailing", ContentType, append(body, 0xc0), msgp.Limits{}, ErrTrailingData},
+		{"over budget", ContentType, body, msgp.Limits{MaxTotalBytes: 20}, msgp.ErrLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			var it item
+			err := DecodeRequest(r, &it, tt.limits)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v; wanted %v", err, tt.want)
+			}
+			if err == nil && (it.Name != "x" || len(it.Tags) != 2) {
+				t.Errorf("got %+v", it)
+			}
+		})
+	}
+}
+
+func TestRespond(t *testing.T) {
+	it := &item{Name: "x", Tags: []string{"a"}}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ContentType},
+		{"*/*", ContentType},
+		{"application/json", "application/json"},
+		{"application/msgpack, application/json", ContentType},
+		{"application/msgpack;q=0.5, application/json", "application/json"},
+		{"text/html", ContentType},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		if err := Respond(w, r, http.StatusCreated, it); err != nil {
+			t.Fatal(err)
+		}
+		res := w.Result()
+		if res.StatusCode != http.StatusCreated {
+			t.Errorf("%q: got status %d", tt.accept, res.StatusCode)
+		}
+		if got := res.Header.Get("Content-Type"); got != tt.want {
+			t.Errorf("%q: got %s; wanted %s", tt.accept, got, tt.want)
+			continue
+		}
+		want := encode(t, it)
+		if tt.want != ContentType {
+			want = []byte(`{"name":"x","tags":["a"]}`)
+		}
+		if !bytes.Equal(w.Body.Bytes(), want) {
+			t.Errorf("%q: got body %q; wanted %q", tt.accept, w.Body.Bytes(), want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package msgp
+
+// Path is a sequence of map keys that selects a value
+// inside of a MessagePack object, starting at the outermost map.
+// Arrays encountered along the way are transparent: the
+// remainder of the path is applied to each of their elements.
+type Path []string
+
+// Project appends a copy of the first object in 'raw' to 'dst' that
+// contains only the map fields selected by 'paths', and returns
+// the extended slice.
+//
+// A field is kept when its key, along with the keys of its enclosing
+// maps, matches a path or a prefix of a path. Fields matched by a
+// complete path are copied verbatim; fields matched by a prefix are
+// projected recursively. Map headers are recomputed to reflect the
+// number of kept fields, while arrays keep all of their elements.
+// Values that are neither maps nor arrays but are matched by a
+// prefix of a path are replaced with 'nil'. An empty path selects
+// the whole object.
+//
+// Keys may be encoded as either 'str' or 'bin'; fields with other
+// key types are never selected.
+//
+// Possible errors:
+//
+//   - [ErrShortBytes] (not enough bytes in 'raw')
+//   - [InvalidPrefixError] (bad encoding)
+//   - [ErrRecursion] (too deeply nested data)
+func Project(dst, raw []byte, paths ...Path) ([]byte, error) {
+	var p projector
+	out, _, err := p.project(dst, raw, paths, 0, 0)
+	return out, err
+}
+
+// ProjectStream reads the next object from 'src' and writes
+// its projection onto 'paths' to 'dst', following the rules
+// of [Project]. The object is buffered in memory before it is
+// projected, since map headers can only be written once the
+// number of kept fields is known.
+func ProjectStream(dst *Writer, src *Reader, paths ...Path) error {
+	raw := bytesPool.Get().([]byte)
+	defer func() { bytesPool.Put(raw[:0]) }() //nolint:staticcheck
+	err := appendNext(src, &raw)
+	if err != nil {
+		return err
+	}
+	var p projector
+	out := bytesPool.Get().([]byte)
+	defer func() { bytesPool.Put(out[:0]) }() //nolint:staticcheck
+	out, _, err = p.project(out[:0], raw, paths, 0, 0)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(out)
+	return err
+}
+
+// projector holds the per-level scratch
+// space for the paths that are still active
+type projector struct {
+	active [][]Path
+}
+
+// sel returns the (empty) scratch slice for level 'lvl'
+func (p *projector) sel(lvl int) []Path {
+	for len(p.active) <= lvl {
+		p.active = append(p.active, nil)
+	}
+	return p.active[lvl][:0]
+}
+
+// project appends the projection of the next object in 'raw'
+// onto the paths in 'act', all of which have matched the
+// first 'lvl' keys of the enclosing maps
+func (p *projector) project(dst, raw []byte, act []Path, lvl, depth int) ([]byte, []byte, error) {
+	if depth >= recursionLimit {
+		return dst, raw, ErrRecursion
+	}
+	for _, path := range act {
+		if len(path) == lvl {
+			rest, err := Skip(raw)
+			if err != nil {
+				return dst, raw, err
+			}
+			return append(dst, raw[:len(raw)-len(rest)]...), rest, nil
+		}
+	}
+	if len(raw) == 0 {
+		return dst, raw, ErrShortBytes
+	}
+
+	switch getType(raw[0]) {
+	case MapType:
+		sz, bts, err := ReadMapHeaderBytes(raw)
+		if err != nil {
+			return dst, raw, err
+		}
+		// reserve space for the largest
+		// header and fix it up afterwards
+		hdr := len(dst)
+		dst = append(dst, 0, 0, 0, 0, 0)
+		var kept uint32
+		for range sz {
+			keyStart := bts
+			key, val, err := ReadMapKeyZC(bts)
+			if err != nil {
+				if _, ok := err.(TypeError); !ok {
+					return dst, raw, err
+				}
+				// not a str or bin key, so it can't be matched
+				if val, err = Skip(bts); err != nil {
+					return dst, raw, err
+				}
+				if bts, err = Skip(val); err != nil {
+					return dst, raw, err
+				}
+				continue
+			}
+			next := p.sel(lvl + 1)
+			for _, path := range act {
+				if len(path) > lvl && path[lvl] == UnsafeString(key) {
+					next = append(next, path)
+				}
+			}
+			p.active[lvl+1] = next
+			if len(next) == 0 {
+				if bts, err = Skip(val); err != nil {
+					return dst, raw, err
+				}
+				continue
+			}
+			dst = append(dst, keyStart[:len(keyStart)-len(val)]...)
+			dst, bts, err = p.project(dst, val, next, lvl+1, depth+1)
+			if err != nil {
+				return dst, raw, err
+			}
+			kept++
+		}
+		var tmp [5]byte
+		h := AppendMapHeader(tmp[:0], kept)
+		copy(dst[hdr+len(h):], dst[hdr+5:])
+		copy(dst[hdr:], h)
+		return dst[:len(dst)-(5-len(h))], bts, nil
+
+	case ArrayType:
+		sz, bts, err := ReadArrayHeaderBytes(raw)
+		if err != nil {
+			return dst, raw, err
+		}
+		dst = AppendArrayHeader(dst, sz)
+		for range sz {
+			dst, bts, err = p.project(dst, bts, act, lvl, depth+1)
+			if err != nil {
+				return dst, raw, err
+			}
+		}
+		return dst, bts, nil
+
+	default:
+		rest, err := Skip(raw)
+		if err != nil {
+			return dst, raw, err
+		}
+		return AppendNil(dst), rest, nil
+	}
+}
@@ -0,0 +1,163 @@
+package msgp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	src := map[string]any{
+		"id":   int64(7),
+		"name": "event",
+		"user": map[string]any{
+			"name":   "alice",
+			"secret": "hunter2",
+			"tags":   []any{"a", "b"},
+		},
+		"items": []any{
+			map[string]any{"sku": "x1", "price": 1.5},
+			map[string]any{"sku": "x2", "price": 2.5},
+			int64(3),
+		},
+		"blob": []byte("hidden"),
+	}
+	raw, err := AppendIntf(nil, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		paths []Path
+		want  any
+	}{
+		{
+			name:  "top-level",
+			paths: []Path{{"id"}, {"name"}},
+			want:  map[string]any{"id": int64(7), "name": "event"},
+		},
+		{
+			name:  "nested",
+			paths: []Path{{"user", "name"}, {"user", "tags"}},
+			want: map[string]any{
+				"user": map[string]any{"name": "alice", "tags": []any{"a", "b"}},
+			},
+		},
+		{
+			name:  "through arrays",
+			paths: []Path{{"items", "sku"}},
+			want: map[string]any{
+				"items": []any{
+					map[string]any{"sku": "x1"},
+					map[string]any{"sku": "x2"},
+					nil,
+				},
+			},
+		},
+		{
+			name:  "prefix of scalar",
+			paths: []Path{{"id", "nope"}},
+			want:  map[string]any{"id": nil},
+		},
+		{
+			name:  "missing",
+			paths: []Path{{"nope"}, {"user", "nope"}},
+			want:  map[string]any{"user": map[string]any{}},
+		},
+		{
+			name:  "empty path",
+			paths: []Path{{}},
+			want:  src,
+		},
+		{
+			name: "no paths",
+			want: map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Project(nil, append(raw, 0xc3), tt.paths...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, rest, err := ReadIntfBytes(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rest) != 0 {
+				t.Errorf("%d trailing bytes after projection", len(rest))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v; wanted %v", got, tt.want)
+			}
+
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			err = ProjectStream(w, NewReader(bytes.NewReader(raw)), tt.paths...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Flush()
+			if !bytes.Equal(buf.Bytes(), out) {
+				t.Errorf("ProjectStream: got %x; wanted %x", buf.Bytes(), out)
+			}
+		})
+	}
+}
+
+func TestProjectLargeMap(t *testing.T) {
+	// a 20-field map projected onto 16 fields needs a map16 header,
+	// while the same map projected onto 2 fields needs a fixmap.
+	raw := AppendMapHeader(nil, 20)
+	var paths []Path
+	for i := range 20 {
+		key := string(rune('a' + i))
+		raw = AppendString(raw, key)
+		raw = AppendInt(raw, i)
+		if i < 16 {
+			paths = append(paths, Path{key})
+		}
+	}
+	out, err := Project(nil, raw, paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[0] != mmap16 {
+		t.Errorf("got header 0x%x; wanted 0x%x", out[0], mmap16)
+	}
+	m, _, err := ReadMapStrIntfBytes(out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 16 {
+		t.Errorf("got %d fields; wanted 16", len(m))
+	}
+
+	out, err = Project(out[:0], raw, paths[3:5]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AppendMapHeader(nil, 2)
+	want = AppendInt(AppendString(want, "d"), 3)
+	want = AppendInt(AppendString(want, "e"), 4)
+	if !bytes.Equal(out, want) {
+		t.Errorf("got %x; wanted %x", out, want)
+	}
+}
+
+func TestProjectErrors(t *testing.T) {
+	raw := AppendMapHeader(nil, 2)
+	raw = AppendString(raw, "a")
+	raw = AppendString(raw, "b")
+	for i := range raw {
+		_, err := Project(nil, raw[:i], Path{"a"})
+		if err != ErrShortBytes {
+			t.Errorf("len %d: got error %v; wanted %v", i, err, ErrShortBytes)
+		}
+	}
+	_, err := Project(nil, []byte{0xc1}, Path{"a"})
+	if _, ok := err.(InvalidPrefixError); !ok {
+		t.Errorf("got error %v; wanted InvalidPrefixError", err)
+	}
+}
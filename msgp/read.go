@@ -88,6 +88,11 @@ func (t Type) String() string {
 }
 
 func freeR(m *Reader) {
+	// don't hand out a Reader with the settings of its last user
+	m.SetLimits(Limits{})
+	m.recursionDepth = 0
+	m.ext = nil
+	m.payload = nil
 	readerPool.Put(m)
 }
 
@@ -97,6 +102,8 @@ func freeR(m *Reader) {
 // UnmarshalMsg unmarshals the object
 // from binary, returing any leftover
 // bytes and any errors encountered.
+// Generated UnmarshalMsg methods return
+// their input as the leftover bytes on error.
 type Unmarshaler interface {
 	UnmarshalMsg([]byte) ([]byte, error)
 }
@@ -158,16 +165,29 @@ type Reader struct {
 	maxRecursionDepth int    // maximum recursion depth
 	maxElements       uint32 // maximum number of elements in arrays and maps
 	maxStrLen         uint64 // maximum number of bytes in any string
+	maxTotal          uint64 // maximum number of bytes charged to the budget
+	total             uint64 // number of bytes charged to the budget so far
+	validateUTF8      bool   // require valid UTF-8 strings in Validate
+
+	ext *ExtensionRegistry // used by ReadIntf; nil means DefaultExtensions
+
+	payload *payloadReader // the contents returned by BytesReader, if unread
 }
 
 // Read implements `io.Reader`
 func (m *Reader) Read(p []byte) (int, error) {
+	if err := m.skipPayload(); err != nil {
+		return 0, err
+	}
 	return m.R.Read(p)
 }
 
 // CopyNext reads the next object from m without decoding it and writes it to w.
 // It avoids unnecessary copies internally.
 func (m *Reader) CopyNext(w io.Writer) (int64, error) {
+	if err := m.skipPayload(); err != nil {
+		return 0, err
+	}
 	sz, o, err := getNextSize(m.R)
 	if err != nil {
 		return 0, err
@@ -277,11 +297,19 @@ func (m *Reader) recursiveCall() (done func(), err error) {
 
 // ReadFull implements `io.ReadFull`
 func (m *Reader) ReadFull(p []byte) (int, error) {
+	if err := m.skipPayload(); err != nil {
+		return 0, err
+	}
 	return m.R.ReadFull(p)
 }
 
 // Reset resets the underlying reader.
-func (m *Reader) Reset(r io.Reader) { m.R.Reset(r) }
+// It also refills the budget set by SetMaxTotalBytes.
+func (m *Reader) Reset(r io.Reader) {
+	m.R.Reset(r)
+	m.total = 0
+	m.payload = nil
+}
 
 // Buffered returns the number of bytes currently in the read buffer.
 func (m *Reader) Buffered() int { return m.R.Buffered() }
@@ -291,6 +319,9 @@ func (m *Reader) BufferSize() int { return m.R.BufferSize() }
 
 // NextType returns the next object type to be decoded.
 func (m *Reader) NextType() (Type, error) {
+	if err := m.skipPayload(); err != nil {
+		return InvalidType, err
+	}
 	next, err := m.R.PeekByte()
 	if err != nil {
 		return InvalidType, err
@@ -319,6 +350,9 @@ func (m *Reader) NextType() (Type, error) {
 // IsNil returns whether or not
 // the next byte is a null messagepack byte
 func (m *Reader) IsNil() bool {
+	if m.skipPayload() != nil {
+		return false
+	}
 	p, err := m.R.PeekByte()
 	return err == nil && p == mnil
 }
@@ -371,6 +405,9 @@ func getNextSize(r *fwd.Reader) (uintptr, uintptr, error) {
 // its type. If it is an array or map, the whole array
 // or map will be skipped.
 func (m *Reader) Skip() error {
+	if err := m.skipPayload(); err != nil {
+		return err
+	}
 	var (
 		v   uintptr // bytes
 		o   uintptr // objects
@@ -425,6 +462,9 @@ func (m *Reader) Skip() error {
 // It will return a TypeError{} if the next
 // object is not a map.
 func (m *Reader) ReadMapHeader() (sz uint32, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	var lead byte
 	lead, err = m.R.PeekByte()
@@ -433,7 +473,10 @@ func (m *Reader) ReadMapHeader() (sz uint32, err error) {
 	}
 	if isfixmap(lead) {
 		sz = uint32(rfixmap(lead))
-		_, err = m.R.Skip(1)
+		if _, err = m.R.Skip(1); err != nil {
+			return
+		}
+		err = m.chargeElements(sz)
 		return
 	}
 	switch lead {
@@ -443,18 +486,18 @@ func (m *Reader) ReadMapHeader() (sz uint32, err error) {
 			return
 		}
 		sz = uint32(big.Uint16(p[1:]))
-		return
 	case mmap32:
 		p, err = m.R.Next(5)
 		if err != nil {
 			return
 		}
 		sz = big.Uint32(p[1:])
-		return
 	default:
 		err = badPrefix(MapType, lead)
 		return
 	}
+	err = m.chargeElements(sz)
+	return
 }
 
 // ReadMapKey reads either a 'str' or 'bin' field from
@@ -484,6 +527,9 @@ func (m *Reader) ReadMapKey(scratch []byte) ([]byte, error) {
 // method; writing into the returned slice may
 // corrupt future reads.
 func (m *Reader) ReadMapKeyPtr() ([]byte, error) {
+	if err := m.skipPayload(); err != nil {
+		return nil, err
+	}
 	lead, err := m.R.PeekByte()
 	if err != nil {
 		return nil, err
@@ -531,13 +577,19 @@ fill:
 // array header and returns the size of the array
 // and the number of bytes read.
 func (m *Reader) ReadArrayHeader() (sz uint32, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	lead, err := m.R.PeekByte()
 	if err != nil {
 		return
 	}
 	if isfixarray(lead) {
 		sz = uint32(rfixarray(lead))
-		_, err = m.R.Skip(1)
+		if _, err = m.R.Skip(1); err != nil {
+			return
+		}
+		err = m.chargeElements(sz)
 		return
 	}
 	var p []byte
@@ -548,7 +600,6 @@ func (m *Reader) ReadArrayHeader() (sz uint32, err error) {
 			return
 		}
 		sz = uint32(big.Uint16(p[1:]))
-		return
 
 	case marray32:
 		p, err = m.R.Next(5)
@@ -556,16 +607,20 @@ func (m *Reader) ReadArrayHeader() (sz uint32, err error) {
 			return
 		}
 		sz = big.Uint32(p[1:])
-		return
 
 	default:
 		err = badPrefix(ArrayType, lead)
 		return
 	}
+	err = m.chargeElements(sz)
+	return
 }
 
 // ReadNil reads a 'nil' MessagePack byte from the reader
 func (m *Reader) ReadNil() error {
+	if err := m.skipPayload(); err != nil {
+		return err
+	}
 	p, err := m.R.PeekByte()
 	if err != nil {
 		return err
@@ -581,6 +636,9 @@ func (m *Reader) ReadNil() error {
 // (If the value on the wire is encoded as a float32,
 // it will be up-cast to a float64.)
 func (m *Reader) ReadFloat64() (f float64, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	p, err = m.R.Peek(9)
 	if err != nil {
@@ -608,6 +666,9 @@ func (m *Reader) ReadFloat64() (f float64, err error) {
 
 // ReadFloat32 reads a float32 from the reader
 func (m *Reader) ReadFloat32() (f float32, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	p, err = m.R.Peek(5)
 	if err != nil {
@@ -624,6 +685,9 @@ func (m *Reader) ReadFloat32() (f float32, err error) {
 
 // ReadBool reads a bool from the reader
 func (m *Reader) ReadBool() (b bool, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p byte
 	p, err = m.R.PeekByte()
 	if err != nil {
@@ -649,6 +713,9 @@ func (m *Reader) ReadDuration() (d time.Duration, err error) {
 
 // ReadInt64 reads an int64 from the reader
 func (m *Reader) ReadInt64() (i int64, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	lead, err := m.R.PeekByte()
 	if err != nil {
@@ -793,6 +860,9 @@ func (m *Reader) ReadInt() (i int, err error) {
 
 // ReadUint64 reads a uint64 from the reader
 func (m *Reader) ReadUint64() (u uint64, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	lead, err := m.R.PeekByte()
 	if err != nil {
@@ -968,6 +1038,9 @@ func (m *Reader) ReadByte() (b byte, err error) {
 // from the reader and returns its value. It may
 // use 'scratch' for storage if it is non-nil.
 func (m *Reader) ReadBytes(scratch []byte) (b []byte, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	var lead byte
 	p, err = m.R.Peek(2)
@@ -996,11 +1069,14 @@ func (m *Reader) ReadBytes(scratch []byte) (b []byte, err error) {
 		err = badPrefix(BinType, lead)
 		return
 	}
+	if int64(cap(scratch)) < read && read > int64(m.GetMaxElements()) {
+		err = ErrLimitExceeded
+		return
+	}
+	if err = m.charge(uint64(read)); err != nil {
+		return
+	}
 	if int64(cap(scratch)) < read {
-		if read > int64(m.GetMaxElements()) {
-			err = ErrLimitExceeded
-			return
-		}
 		b = make([]byte, read)
 	} else {
 		b = scratch[0:read]
@@ -1009,6 +1085,114 @@ func (m *Reader) ReadBytes(scratch []byte) (b []byte, err error) {
 	return
 }
 
+// BytesReader reads the header of a MessagePack 'bin'
+// or 'str' object, and returns a reader over its contents
+// and their size. The contents are read straight from the
+// underlying stream, without being buffered in full. If anything
+// else is read from m before the returned reader is read to the
+// end, the rest of the contents are skipped first, and the
+// returned reader reports io.EOF from then on.
+//
+// The limits on the lengths of objects and on the total
+// size of the input don't apply to the contents. The
+// returned reader reports io.ErrUnexpectedEOF if
+// the stream ends before the contents do.
+func (m *Reader) BytesReader() (r io.Reader, sz uint32, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
+	lead, err := m.R.PeekByte()
+	if err != nil {
+		return nil, 0, err
+	}
+	spec := getBytespec(lead)
+	if spec.typ != BinType && spec.typ != StrType {
+		return nil, 0, badPrefix(BinType, lead)
+	}
+	plen := int(spec.size)
+	if spec.extra == constsize {
+		plen = 1 // fixstr
+	}
+	p, err := m.R.Peek(plen)
+	if err != nil {
+		return nil, 0, err
+	}
+	hdr, n := header(spec, p)
+	if _, err = m.R.Skip(hdr); err != nil {
+		return nil, 0, err
+	}
+	pr := &payloadReader{m: m, n: int64(n)}
+	if n > 0 {
+		m.payload = pr
+	}
+	return pr, uint32(n), nil
+}
+
+// skipPayload skips the rest of the contents
+// returned by BytesReader, if there are any
+func (m *Reader) skipPayload() error {
+	if m.payload == nil {
+		return nil
+	}
+	return m.payload.skip()
+}
+
+// payloadReader reads the next 'n' bytes of m.R
+type payloadReader struct {
+	m *Reader
+	n int64
+}
+
+// done is called once the contents are
+// read, or can't be read any further
+func (p *payloadReader) done() {
+	p.n = 0
+	if p.m.payload == p {
+		p.m.payload = nil
+	}
+}
+
+func (p *payloadReader) Read(b []byte) (int, error) {
+	if p.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > p.n {
+		b = b[:p.n]
+	}
+	n, err := p.m.R.Read(b)
+	p.n -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if p.n == 0 || err != nil {
+		p.done()
+	}
+	return n, err
+}
+
+// WriteTo implements io.WriterTo
+func (p *payloadReader) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.CopyN(w, p.m.R, p.n)
+	p.n -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if p.n == 0 || err == io.ErrUnexpectedEOF {
+		p.done()
+	}
+	return n, err
+}
+
+// skip skips the rest of the contents
+func (p *payloadReader) skip() error {
+	_, err := io.CopyN(io.Discard, p.m.R, p.n)
+	p.done()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
 // ReadBytesLimit reads a MessagePack 'bin' object
 // from the reader and returns its value. It may
 // use 'scratch' for storage if it is non-nil.
@@ -1017,6 +1201,9 @@ func (m *Reader) ReadBytes(scratch []byte) (b []byte, err error) {
 // If SetMaxElements has been used on the Reader,
 // that will only be checked if the scratch is too small.
 func (m *Reader) ReadBytesLimit(scratch []byte, n int64) (b []byte, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	var lead byte
 	p, err = m.R.Peek(2)
@@ -1052,6 +1239,9 @@ func (m *Reader) ReadBytesLimit(scratch []byte, n int64) (b []byte, err error) {
 		err = ErrLimitExceeded
 		return
 	}
+	if err = m.charge(uint64(read)); err != nil {
+		return
+	}
 	if int64(cap(scratch)) < read {
 		b = make([]byte, read)
 		if read > int64(m.GetMaxElements()) {
@@ -1071,6 +1261,9 @@ func (m *Reader) ReadBytesLimit(scratch []byte, n int64) (b []byte, err error) {
 // 'sz' bytes from the reader in an application-specific
 // way.
 func (m *Reader) ReadBytesHeader() (sz uint32, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	lead, err := m.R.PeekByte()
 	if err != nil {
@@ -1109,6 +1302,9 @@ func (m *Reader) ReadBytesHeader() (sz uint32, err error) {
 // ArrayError will be returned if the object is not
 // exactly the length of the input slice.
 func (m *Reader) ReadExactBytes(into []byte) error {
+	if err := m.skipPayload(); err != nil {
+		return err
+	}
 	p, err := m.R.Peek(2)
 	if err != nil {
 		return err
@@ -1149,6 +1345,9 @@ func (m *Reader) ReadExactBytes(into []byte) error {
 // and returns its value as bytes. It may use 'scratch' for storage
 // if it is non-nil.
 func (m *Reader) ReadStringAsBytes(scratch []byte) (b []byte, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	lead, err := m.R.PeekByte()
 	if err != nil {
@@ -1190,6 +1389,9 @@ fill:
 		err = ErrLimitExceeded
 		return
 	}
+	if err = m.charge(uint64(read)); err != nil {
+		return
+	}
 	if int64(cap(scratch)) < read {
 		b = make([]byte, read)
 	} else {
@@ -1204,6 +1406,9 @@ fill:
 // for dealing with the next 'sz' bytes from
 // the reader in an application-specific manner.
 func (m *Reader) ReadStringHeader() (sz uint32, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	lead, err := m.R.PeekByte()
 	if err != nil {
 		return
@@ -1244,6 +1449,9 @@ func (m *Reader) ReadStringHeader() (sz uint32, err error) {
 
 // ReadString reads a utf-8 string from the reader
 func (m *Reader) ReadString() (s string, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var read int64
 	lead, err := m.R.PeekByte()
 	if err != nil {
@@ -1289,6 +1497,9 @@ fill:
 		err = ErrLimitExceeded
 		return
 	}
+	if err = m.charge(uint64(read)); err != nil {
+		return
+	}
 
 	// reading into the memory
 	// that will become the string
@@ -1318,6 +1529,9 @@ fill:
 
 // ReadComplex64 reads a complex64 from the reader
 func (m *Reader) ReadComplex64() (f complex64, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	p, err = m.R.Peek(10)
 	if err != nil {
@@ -1339,6 +1553,9 @@ func (m *Reader) ReadComplex64() (f complex64, err error) {
 
 // ReadComplex128 reads a complex128 from the reader
 func (m *Reader) ReadComplex128() (f complex128, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	var p []byte
 	p, err = m.R.Peek(18)
 	if err != nil {
@@ -1399,6 +1616,9 @@ func (m *Reader) ReadTimeUTC() (t time.Time, err error) {
 // ReadTime reads a time.Time object from the reader.
 // The returned time's location will be set to time.Local.
 func (m *Reader) ReadTime() (t time.Time, err error) {
+	if err = m.skipPayload(); err != nil {
+		return
+	}
 	offset, length, extType, err := m.peekExtensionHeader()
 	if err != nil {
 		return t, err
@@ -1554,7 +1774,7 @@ func (m *Reader) ReadIntf() (i any, err error) {
 		if err != nil {
 			return
 		}
-		f, ok := extensionReg[t]
+		f, ok := m.Extensions().Lookup(t)
 		if ok {
 			e := f()
 			err = m.ReadExtension(e)
@@ -161,6 +161,7 @@ func (r *Raw) MarshalJSON() ([]byte, error) {
 //   - [ErrShortBytes] (too few bytes)
 //   - [TypeError] (not a map)
 func ReadMapHeaderBytes(b []byte) (sz uint32, o []byte, err error) {
+	o = b
 	l := len(b)
 	if l < 1 {
 		err = ErrShortBytes
@@ -227,8 +228,9 @@ func ReadMapKeyZC(b []byte) ([]byte, []byte, error) {
 //   - [ErrShortBytes] (too few bytes)
 //   - [TypeError] (not an array)
 func ReadArrayHeaderBytes(b []byte) (sz uint32, o []byte, err error) {
+	o = b
 	if len(b) < 1 {
-		return 0, nil, ErrShortBytes
+		return 0, b, ErrShortBytes
 	}
 	lead := b[0]
 	b = b[1:]
@@ -271,8 +273,9 @@ func ReadArrayHeaderBytes(b []byte) (sz uint32, o []byte, err error) {
 //   - [ErrShortBytes] (too few bytes)
 //   - [TypeError] (not a bin object)
 func ReadBytesHeader(b []byte) (sz uint32, o []byte, err error) {
+	o = b
 	if len(b) < 1 {
-		return 0, nil, ErrShortBytes
+		return 0, b, ErrShortBytes
 	}
 	switch b[0] {
 	case mbin8:
@@ -331,6 +334,7 @@ func ReadNilBytes(b []byte) ([]byte, error) {
 //   - [ErrShortBytes] (too few bytes)
 //   - [TypeError] (not a float64)
 func ReadFloat64Bytes(b []byte) (f float64, o []byte, err error) {
+	o = b
 	if len(b) < 9 {
 		if len(b) >= 5 && b[0] == mfloat32 {
 			var tf float32
@@ -366,6 +370,7 @@ func ReadFloat64Bytes(b []byte) (f float64, o []byte, err error) {
 //   - [ErrShortBytes] (too few bytes)
 //   - [TypeError] (not a float32)
 func ReadFloat32Bytes(b []byte) (f float32, o []byte, err error) {
+	o = b
 	if len(b) < 5 {
 		err = ErrShortBytes
 		return
@@ -422,8 +427,9 @@ func ReadDurationBytes(b []byte) (d time.Duration, o []byte, err error) {
 //   - [ErrShortBytes] (too few bytes)
 //   - [TypeError] (not a int)
 func ReadInt64Bytes(b []byte) (i int64, o []byte, err error) {
+	o = b
 	if len(b) < 1 {
-		return 0, nil, ErrShortBytes
+		return 0, b, ErrShortBytes
 	}
 
 	lead := b[0]
@@ -509,12 +515,12 @@ func ReadInt64Bytes(b []byte) (i int64, o []byte, err error) {
 			return
 		}
 		u := big.Uint64(b)
+		o = b[8:]
 		if u > math.MaxInt64 {
 			err = UintOverflow{Value: u, FailedBitsize: 64}
 			return
 		}
 		i = int64(u)
-		o = b[8:]
 		return
 
 	default:
@@ -596,8 +602,9 @@ func ReadIntBytes(b []byte) (int, []byte, error) {
 //   - [ErrShortBytes] (too few bytes)
 //   - [TypeError] (not a uint)
 func ReadUint64Bytes(b []byte) (u uint64, o []byte, err error) {
+	o = b
 	if len(b) < 1 {
-		return 0, nil, ErrShortBytes
+		return 0, b, ErrShortBytes
 	}
 
 	lead := b[0]
@@ -615,12 +622,12 @@ func ReadUint64Bytes(b []byte) (u uint64, o []byte, err error) {
 			return
 		}
 		v := int64(int8(b[0]))
+		o = b[1:]
 		if v < 0 {
 			err = UintBelowZero{Value: v}
 			return
 		}
 		u = uint64(v)
-		o = b[1:]
 		return
 
 	case muint8:
@@ -638,12 +645,12 @@ func ReadUint64Bytes(b []byte) (u uint64, o []byte, err error) {
 			return
 		}
 		v := int64((int16(b[0]) << 8) | int16(b[1]))
+		o = b[2:]
 		if v < 0 {
 			err = UintBelowZero{Value: v}
 			return
 		}
 		u = uint64(v)
-		o = b[2:]
 		return
 
 	case muint16:
@@ -661,12 +668,12 @@ func ReadUint64Bytes(b []byte) (u uint64, o []byte, err error) {
 			return
 		}
 		v := int64(int32(big.Uint32(b)))
+		o = b[4:]
 		if v < 0 {
 			err = UintBelowZero{Value: v}
 			return
 		}
 		u = uint64(v)
-		o = b[4:]
 		return
 
 	case muint32:
@@ -684,12 +691,12 @@ func ReadUint64Bytes(b []byte) (u uint64, o []byte, err error) {
 			return
 		}
 		v := int64(big.Uint64(b))
+		o = b[8:]
 		if v < 0 {
 			err = UintBelowZero{Value: v}
 			return
 		}
 		u = uint64(v)
-		o = b[8:]
 		return
 
 	case muint64:
@@ -703,6 +710,7 @@ func ReadUint64Bytes(b []byte) (u uint64, o []byte, err error) {
 
 	default:
 		if isnfixint(lead) {
+			o = b
 			err = UintBelowZero{Value: int64(rnfixint(lead))}
 		} else {
 			err = badPrefix(UintType, lead)
@@ -722,7 +730,7 @@ func ReadUint64Bytes(b []byte) (u uint64, o []byte, err error) {
 func ReadUint32Bytes(b []byte) (uint32, []byte, error) {
 	v, o, err := ReadUint64Bytes(b)
 	if v > math.MaxUint32 {
-		return 0, nil, UintOverflow{Value: v, FailedBitsize: 32}
+		return 0, o, UintOverflow{Value: v, FailedBitsize: 32}
 	}
 	return uint32(v), o, err
 }
@@ -738,7 +746,7 @@ func ReadUint32Bytes(b []byte) (uint32, []byte, error) {
 func ReadUint16Bytes(b []byte) (uint16, []byte, error) {
 	v, o, err := ReadUint64Bytes(b)
 	if v > math.MaxUint16 {
-		return 0, nil, UintOverflow{Value: v, FailedBitsize: 16}
+		return 0, o, UintOverflow{Value: v, FailedBitsize: 16}
 	}
 	return uint16(v), o, err
 }
@@ -754,7 +762,7 @@ func ReadUint16Bytes(b []byte) (uint16, []byte, error) {
 func ReadUint8Bytes(b []byte) (uint8, []byte, error) {
 	v, o, err := ReadUint64Bytes(b)
 	if v > math.MaxUint8 {
-		return 0, nil, UintOverflow{Value: v, FailedBitsize: 8}
+		return 0, o, UintOverflow{Value: v, FailedBitsize: 8}
 	}
 	return uint8(v), o, err
 }
@@ -794,9 +802,10 @@ func ReadBytesBytes(b []byte, scratch []byte) (v []byte, o []byte, err error) {
 }
 
 func readBytesBytes(b []byte, scratch []byte, zc bool) (v []byte, o []byte, err error) {
+	o = b
 	l := len(b)
 	if l < 1 {
-		return nil, nil, ErrShortBytes
+		return nil, b, ErrShortBytes
 	}
 
 	lead := b[0]
@@ -867,7 +876,17 @@ func ReadBytesZC(b []byte) (v []byte, o []byte, err error) {
 	return readBytesBytes(b, nil, true)
 }
 
+// ReadExactBytes reads a 'bin' object of exactly
+// len(into) bytes from 'b' into 'into', and
+// returns the remaining bytes.
+//
+// Possible errors:
+//
+//   - [ErrShortBytes] (too few bytes)
+//   - [TypeError] (not a 'bin' object)
+//   - [ArrayError] (the length isn't len(into))
 func ReadExactBytes(b []byte, into []byte) (o []byte, err error) {
+	o = b
 	if len(b) < 1 {
 		err = ErrShortBytes
 		return
@@ -925,8 +944,9 @@ func ReadExactBytes(b []byte, into []byte) (o []byte, err error) {
 //   - [ErrShortBytes] (b not long enough)
 //   - [TypeError] (object not 'str')
 func ReadStringZC(b []byte) (v []byte, o []byte, err error) {
+	o = b
 	if len(b) < 1 {
-		return nil, nil, ErrShortBytes
+		return nil, b, ErrShortBytes
 	}
 
 	lead := b[0]
@@ -1020,6 +1040,7 @@ func ReadStringAsBytes(b []byte, scratch []byte) (v []byte, o []byte, err error)
 //   - [InvalidPrefixError]
 //   - [ExtensionTypeError] (object an extension of the correct size, but not a complex128)
 func ReadComplex128Bytes(b []byte) (c complex128, o []byte, err error) {
+	o = b
 	if len(b) < 18 {
 		err = ErrShortBytes
 		return
@@ -1048,6 +1069,7 @@ func ReadComplex128Bytes(b []byte) (c complex128, o []byte, err error) {
 //   - [TypeError] (object not a complex64)
 //   - [ExtensionTypeError] (object an extension of the correct size, but not a complex64)
 func ReadComplex64Bytes(b []byte) (c complex64, o []byte, err error) {
+	o = b
 	if len(b) < 10 {
 		err = ErrShortBytes
 		return
@@ -1083,30 +1105,29 @@ func ReadTimeUTCBytes(b []byte) (t time.Time, o []byte, err error) {
 //   - [TypeError] (object not a time extension 5 or -1)
 //   - [ExtensionTypeError] (object an extension of the correct size, but not a time.Time)
 func ReadTimeBytes(b []byte) (t time.Time, o []byte, err error) {
+	o = b
 	if len(b) < 6 {
 		err = ErrShortBytes
 		return
 	}
-	typ, o, b, err := readExt(b)
+	typ, rest, data, err := readExt(b)
 	if err != nil {
 		return
 	}
 	switch typ {
 	case TimeExtension:
-		if len(b) != 12 {
+		if len(data) != 12 {
 			err = ErrShortBytes
 			return
 		}
-		sec, nsec := getUnix(b)
+		sec, nsec := getUnix(data)
 		t = time.Unix(sec, int64(nsec)).Local()
-		return
 	case MsgTimeExtension:
-		switch len(b) {
+		switch len(data) {
 		case 4:
-			t = time.Unix(int64(binary.BigEndian.Uint32(b)), 0).Local()
-			return
+			t = time.Unix(int64(binary.BigEndian.Uint32(data)), 0).Local()
 		case 8:
-			v := binary.BigEndian.Uint64(b)
+			v := binary.BigEndian.Uint64(data)
 			nanos := int64(v >> 34)
 			if nanos > 999999999 {
 				// In timestamp 64 and timestamp 96 formats, nanoseconds must not be larger than 999999999.
@@ -1114,35 +1135,45 @@ func ReadTimeBytes(b []byte) (t time.Time, o []byte, err error) {
 				return
 			}
 			t = time.Unix(int64(v&(1<<34-1)), nanos).Local()
-			return
 		case 12:
-			nanos := int64(binary.BigEndian.Uint32(b))
+			nanos := int64(binary.BigEndian.Uint32(data))
 			if nanos > 999999999 {
 				// In timestamp 64 and timestamp 96 formats, nanoseconds must not be larger than 999999999.
 				err = InvalidTimestamp{Nanos: nanos}
 				return
 			}
-			ux := int64(binary.BigEndian.Uint64(b[4:]))
+			ux := int64(binary.BigEndian.Uint64(data[4:]))
 			t = time.Unix(ux, nanos).Local()
-			return
 		default:
-			err = InvalidTimestamp{FieldLength: len(b)}
+			err = InvalidTimestamp{FieldLength: len(data)}
 			return
 		}
 	default:
 		err = errExt(typ, TimeExtension)
 		return
 	}
+	o = rest
+	return
 }
 
 // ReadMapStrIntfBytes reads a map[string]interface{}
 // out of 'b' and returns the map and remaining bytes.
 // If 'old' is non-nil, the values will be read into that map.
 func ReadMapStrIntfBytes(b []byte, old map[string]any) (v map[string]any, o []byte, err error) {
-	return readMapStrIntfBytesDepth(b, old, 0)
+	return DefaultExtensions.ReadMapStrIntfBytes(b, old)
 }
 
-func readMapStrIntfBytesDepth(b []byte, old map[string]any, depth int) (v map[string]any, o []byte, err error) {
+// ReadMapStrIntfBytes is like the package-level ReadMapStrIntfBytes,
+// but it decodes extensions with the types registered in 'x'.
+func (x *ExtensionRegistry) ReadMapStrIntfBytes(b []byte, old map[string]any) (v map[string]any, o []byte, err error) {
+	v, o, err = readMapStrIntfBytesDepth(b, old, 0, x)
+	if err != nil {
+		o = b
+	}
+	return
+}
+
+func readMapStrIntfBytesDepth(b []byte, old map[string]any, depth int, x *ExtensionRegistry) (v map[string]any, o []byte, err error) {
 	if depth >= recursionLimit {
 		err = ErrRecursion
 		return
@@ -1180,7 +1211,7 @@ func readMapStrIntfBytesDepth(b []byte, old map[string]any, depth int) (v map[st
 			return
 		}
 		var val any
-		val, o, err = readIntfBytesDepth(o, depth)
+		val, o, err = readIntfBytesDepth(o, depth, x)
 		if err != nil {
 			return
 		}
@@ -1192,11 +1223,24 @@ func readMapStrIntfBytesDepth(b []byte, old map[string]any, depth int) (v map[st
 // ReadIntfBytes attempts to read
 // the next object out of 'b' as a raw interface{} and
 // return the remaining bytes.
+//
+// Extensions are decoded with the types
+// registered in DefaultExtensions.
 func ReadIntfBytes(b []byte) (i any, o []byte, err error) {
-	return readIntfBytesDepth(b, 0)
+	return DefaultExtensions.ReadIntfBytes(b)
+}
+
+// ReadIntfBytes is like the package-level ReadIntfBytes,
+// but it decodes extensions with the types registered in 'x'.
+func (x *ExtensionRegistry) ReadIntfBytes(b []byte) (i any, o []byte, err error) {
+	i, o, err = readIntfBytesDepth(b, 0, x)
+	if err != nil {
+		o = b
+	}
+	return
 }
 
-func readIntfBytesDepth(b []byte, depth int) (i any, o []byte, err error) {
+func readIntfBytesDepth(b []byte, depth int, x *ExtensionRegistry) (i any, o []byte, err error) {
 	if depth >= recursionLimit {
 		err = ErrRecursion
 		return
@@ -1210,7 +1254,7 @@ func readIntfBytesDepth(b []byte, depth int) (i any, o []byte, err error) {
 
 	switch k {
 	case MapType:
-		i, o, err = readMapStrIntfBytesDepth(b, nil, depth+1)
+		i, o, err = readMapStrIntfBytesDepth(b, nil, depth+1, x)
 		return
 
 	case ArrayType:
@@ -1227,7 +1271,7 @@ func readIntfBytesDepth(b []byte, depth int) (i any, o []byte, err error) {
 		j := make([]any, int(sz))
 		i = j
 		for d := range j {
-			j[d], o, err = readIntfBytesDepth(o, depth+1)
+			j[d], o, err = readIntfBytesDepth(o, depth+1, x)
 			if err != nil {
 				return
 			}
@@ -1274,7 +1318,7 @@ func readIntfBytesDepth(b []byte, depth int) (i any, o []byte, err error) {
 		}
 		// use a user-defined extension,
 		// if it's been registered
-		f, ok := extensionReg[t]
+		f, ok := x.Lookup(t)
 		if ok {
 			e := f()
 			o, err = ReadExtensionBytes(b, e)
@@ -1317,7 +1361,11 @@ func readIntfBytesDepth(b []byte, depth int) (i any, o []byte, err error) {
 //   - [InvalidPrefixError] (bad encoding)
 //   - [ErrRecursion] (too deeply nested data)
 func Skip(b []byte) ([]byte, error) {
-	return skipDepth(b, 0)
+	o, err := skipDepth(b, 0)
+	if err != nil {
+		return b, err
+	}
+	return o, nil
 }
 
 func skipDepth(b []byte, depth int) ([]byte, error) {
@@ -1389,7 +1437,7 @@ func getSize(b []byte) (uintptr, uintptr, error) {
 //   - TypeError (not a number (int/float))
 func ReadJSONNumberBytes(b []byte) (number json.Number, o []byte, err error) {
 	if len(b) < 1 {
-		return "", nil, ErrShortBytes
+		return "", b, ErrShortBytes
 	}
 	if i, o, err := ReadInt64Bytes(b); err == nil {
 		return json.Number(strconv.FormatInt(i, 10)), o, nil
@@ -1398,5 +1446,5 @@ func ReadJSONNumberBytes(b []byte) (number json.Number, o []byte, err error) {
 	if err == nil {
 		return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), o, nil
 	}
-	return "", nil, TypeError{Method: NumberType, Encoded: getType(b[0])}
+	return "", b, TypeError{Method: NumberType, Encoded: getType(b[0])}
 }
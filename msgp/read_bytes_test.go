@@ -759,3 +759,80 @@ func BenchmarkSkipBytes(b *testing.B) {
 		}
 	}
 }
+
+func TestReadBytesErrorRemaining(t *testing.T) {
+	type readFn func([]byte) ([]byte, error)
+	wrap := func(f func([]byte) (any, []byte, error)) readFn {
+		return func(b []byte) ([]byte, error) { _, o, err := f(b); return o, err }
+	}
+	fns := map[string]readFn{
+		"ArrayHeader": wrap(func(b []byte) (any, []byte, error) { return ReadArrayHeaderBytes(b) }),
+		"MapHeader":   wrap(func(b []byte) (any, []byte, error) { return ReadMapHeaderBytes(b) }),
+		"MapKeyZC":    wrap(func(b []byte) (any, []byte, error) { return ReadMapKeyZC(b) }),
+		"BytesHeader": wrap(func(b []byte) (any, []byte, error) { return ReadBytesHeader(b) }),
+		"Nil":         ReadNilBytes,
+		"Bool":        wrap(func(b []byte) (any, []byte, error) { return ReadBoolBytes(b) }),
+		"Byte":        wrap(func(b []byte) (any, []byte, error) { return ReadByteBytes(b) }),
+		"Float64":     wrap(func(b []byte) (any, []byte, error) { return ReadFloat64Bytes(b) }),
+		"Float32":     wrap(func(b []byte) (any, []byte, error) { return ReadFloat32Bytes(b) }),
+		"Duration":    wrap(func(b []byte) (any, []byte, error) { return ReadDurationBytes(b) }),
+		"Int64":       wrap(func(b []byte) (any, []byte, error) { return ReadInt64Bytes(b) }),
+		"Int32":       wrap(func(b []byte) (any, []byte, error) { return ReadInt32Bytes(b) }),
+		"Int16":       wrap(func(b []byte) (any, []byte, error) { return ReadInt16Bytes(b) }),
+		"Int8":        wrap(func(b []byte) (any, []byte, error) { return ReadInt8Bytes(b) }),
+		"Int":         wrap(func(b []byte) (any, []byte, error) { return ReadIntBytes(b) }),
+		"Uint64":      wrap(func(b []byte) (any, []byte, error) { return ReadUint64Bytes(b) }),
+		"Uint32":      wrap(func(b []byte) (any, []byte, error) { return ReadUint32Bytes(b) }),
+		"Uint16":      wrap(func(b []byte) (any, []byte, error) { return ReadUint16Bytes(b) }),
+		"Uint8":       wrap(func(b []byte) (any, []byte, error) { return ReadUint8Bytes(b) }),
+		"Uint":        wrap(func(b []byte) (any, []byte, error) { return ReadUintBytes(b) }),
+		"BytesBytes":  wrap(func(b []byte) (any, []byte, error) { return ReadBytesBytes(b, nil) }),
+		"BytesZC":     wrap(func(b []byte) (any, []byte, error) { return ReadBytesZC(b) }),
+		"Exact":       func(b []byte) ([]byte, error) { return ReadExactBytes(b, make([]byte, 4)) },
+		"StringZC":    wrap(func(b []byte) (any, []byte, error) { return ReadStringZC(b) }),
+		"String":      wrap(func(b []byte) (any, []byte, error) { return ReadStringBytes(b) }),
+		"StringAs":    wrap(func(b []byte) (any, []byte, error) { return ReadStringAsBytes(b, nil) }),
+		"Complex128":  wrap(func(b []byte) (any, []byte, error) { return ReadComplex128Bytes(b) }),
+		"Complex64":   wrap(func(b []byte) (any, []byte, error) { return ReadComplex64Bytes(b) }),
+		"Time":        wrap(func(b []byte) (any, []byte, error) { return ReadTimeBytes(b) }),
+		"TimeUTC":     wrap(func(b []byte) (any, []byte, error) { return ReadTimeUTCBytes(b) }),
+		"MapStrIntf":  wrap(func(b []byte) (any, []byte, error) { return ReadMapStrIntfBytes(b, nil) }),
+		"Intf":        wrap(func(b []byte) (any, []byte, error) { return ReadIntfBytes(b) }),
+		"JSONNumber":  wrap(func(b []byte) (any, []byte, error) { return ReadJSONNumberBytes(b) }),
+		"Extension":   func(b []byte) ([]byte, error) { return ReadExtensionBytes(b, &RawExtension{Type: 9}) },
+		"Skip":        Skip,
+		"ArrayLim":    wrap(func(b []byte) (any, []byte, error) { return ReadArrayHeaderBytesLimits(b, UntrustedLimits()) }),
+		"MapLim":      wrap(func(b []byte) (any, []byte, error) { return ReadMapHeaderBytesLimits(b, UntrustedLimits()) }),
+		"StrLim":      wrap(func(b []byte) (any, []byte, error) { return ReadStringBytesLimits(b, UntrustedLimits()) }),
+		"BinLim":      wrap(func(b []byte) (any, []byte, error) { return ReadBytesBytesLimits(b, nil, UntrustedLimits()) }),
+		"IntfLim":     wrap(func(b []byte) (any, []byte, error) { return ReadIntfBytesLimits(b, UntrustedLimits()) }),
+	}
+	inputs := [][]byte{
+		{},
+		{mstr8, 10, 'a'},
+		{mmap16, 0},
+		{0x91},
+		AppendMapHeader(AppendString(AppendMapHeader(nil, 2), "a"), 1),
+		AppendUint64(nil, 1<<40),
+		AppendInt64(nil, -1<<40),
+		{0xc1},
+		AppendFloat64(nil, 1)[:5],
+	}
+	for name, f := range fns {
+		for _, in := range inputs {
+			o, err := f(in)
+			switch err.(type) {
+			case nil:
+			case IntOverflow, UintOverflow, UintBelowZero:
+				// the value was read, so it is skipped
+				if len(o) != 0 {
+					t.Errorf("%s(%x): got %x, %v", name, in, o, err)
+				}
+			default:
+				if len(o) != len(in) || (len(in) > 0 && &o[0] != &in[0]) {
+					t.Errorf("%s(%x): got %x, %v", name, in, o, err)
+				}
+			}
+		}
+	}
+}
@@ -713,6 +713,83 @@ func TestReadBytes(t *testing.T) {
 	}
 }
 
+func TestBytesReader(t *testing.T) {
+	big := RandBytes(100000)
+	var raw []byte
+	raw = AppendBytes(raw, big)
+	raw = AppendString(raw, "short")
+	raw = AppendBytes(raw, nil)
+	raw = AppendString(raw, string(big[:300]))
+	raw = AppendInt(raw, 7)
+
+	rd := NewReaderSize(bytes.NewReader(raw), 64)
+	for i, want := range [][]byte{big, []byte("short"), {}, big[:300]} {
+		r, sz, err := rd.BytesReader()
+		if err != nil {
+			t.Fatalf("object %d: %v", i, err)
+		}
+		if int(sz) != len(want) {
+			t.Errorf("object %d: got size %d; wanted %d", i, sz, len(want))
+		}
+		var got []byte
+		if i%2 == 0 {
+			got, err = io.ReadAll(r)
+		} else {
+			var buf bytes.Buffer
+			_, err = io.Copy(&buf, r)
+			got = buf.Bytes()
+		}
+		if err != nil {
+			t.Fatalf("object %d: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("object %d: contents differ", i)
+		}
+	}
+	// the stream continues after the contents
+	if _, _, err := rd.BytesReader(); !errors.As(err, new(TypeError)) {
+		t.Errorf("got %v; wanted a TypeError", err)
+	}
+	if i, err := rd.ReadInt(); err != nil || i != 7 {
+		t.Errorf("got %d, %v", i, err)
+	}
+
+	// contents left unread are skipped by the next read
+	rd = NewReaderSize(bytes.NewReader(raw), 64)
+	r, _, err := rd.BytesReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r, make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := rd.ReadString(); err != nil || s != "short" {
+		t.Errorf("got %q, %v; wanted %q", s, err, "short")
+	}
+	if n, err := r.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Errorf("got %d, %v from a skipped reader", n, err)
+	}
+	if _, _, err := rd.BytesReader(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rd.BytesReader(); err != nil {
+		t.Fatal(err)
+	}
+	if i, err := rd.ReadInt(); err != nil || i != 7 {
+		t.Errorf("got %d, %v", i, err)
+	}
+
+	// a truncated stream
+	rd = NewReader(bytes.NewReader(raw[:1000]))
+	r, _, err = rd.BytesReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, r); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v; wanted %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
 func benchBytes(size uint32, b *testing.B) {
 	data := make([]byte, 0, size+5)
 	data = AppendBytes(data, RandBytes(int(size)))
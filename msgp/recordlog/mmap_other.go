@@ -0,0 +1,20 @@
+//go:build !((linux || darwin || dragonfly || freebsd || illumos || netbsd || openbsd) && !appengine && !tinygo)
+
+package recordlog
+
+import (
+	"io"
+	"os"
+)
+
+// mmap reads the first 'size' bytes of 'f',
+// since memory mappings aren't available
+func mmap(f *os.File, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+func munmap(data []byte) error { return nil }
@@ -0,0 +1,132 @@
+package recordlog
+
+import (
+	"iter"
+	"os"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Options configures a Reader.
+type Options struct {
+	// IndexInterval is the number of records between the
+	// entries of a sparse index of record offsets, which
+	// is built when the log is opened. Finding a record takes
+	// time proportional to IndexInterval, or to the number of
+	// records before it if IndexInterval is 0 (no index).
+	IndexInterval int
+}
+
+// Reader reads the records of a log file through
+// a read-only memory mapping. Records appended after
+// the log is opened aren't visible, and a torn record
+// at the end is ignored. A Reader is safe for concurrent
+// use, apart from Close.
+type Reader struct {
+	data  []byte // the valid records
+	mem   []byte // the whole mapping
+	n     int
+	every int
+	index []int64
+}
+
+// Open opens the log file 'name' for reading.
+//
+// Once it returns, the Reader only touches the valid records,
+// which a Writer never truncates. While it is scanning the log,
+// though, it reads the tail of the file, and a Writer truncating
+// that tail (see Recover) can make the access fault with SIGBUS.
+// A log must not be opened by a Reader while a Writer is opening
+// it, or while a Writer's failed Append is removing its record.
+func Open(name string, opts Options) (*Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := mmap(f, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{mem: data, every: opts.IndexInterval}
+	end, err := scan(data, func(n int, off int64) {
+		if r.every > 0 && n%r.every == 0 {
+			r.index = append(r.index, off)
+		}
+		r.n = n + 1
+	})
+	if err != nil {
+		munmap(data)
+		return nil, err
+	}
+	r.data = data[:end]
+	return r, nil
+}
+
+// Len returns the number of records in the log.
+func (r *Reader) Len() int { return r.n }
+
+// Record returns record number 'i'. The returned slice
+// points into the mapping of the file, so it must not be
+// modified, and it is only valid until the Reader is closed.
+func (r *Reader) Record(i int) ([]byte, error) {
+	if r.data == nil {
+		return nil, ErrClosed
+	}
+	if i < 0 || i >= r.n {
+		return nil, ErrNotFound
+	}
+	off := int64(len(magic))
+	skip := i
+	if r.every > 0 {
+		off = r.index[i/r.every]
+		skip = i % r.every
+	}
+	for range skip {
+		off += frameSize + int64(be.Uint32(r.data[off:]))
+	}
+	sz := int64(be.Uint32(r.data[off:]))
+	return r.data[off+frameSize : off+frameSize+sz], nil
+}
+
+// Unmarshal unmarshals record number 'i' into 'u'.
+func (r *Reader) Unmarshal(i int, u msgp.Unmarshaler) error {
+	rec, err := r.Record(i)
+	if err != nil {
+		return err
+	}
+	_, err = u.UnmarshalMsg(rec)
+	return err
+}
+
+// All returns an iterator over the numbers
+// and contents of the records in the log.
+func (r *Reader) All() iter.Seq2[int, []byte] {
+	return func(yield func(int, []byte) bool) {
+		if r.data == nil {
+			return
+		}
+		off := int64(len(magic))
+		for i := range r.n {
+			sz := int64(be.Uint32(r.data[off:]))
+			if !yield(i, r.data[off+frameSize:off+frameSize+sz]) {
+				return
+			}
+			off += frameSize + sz
+		}
+	}
+}
+
+// Close releases the mapping of the file.
+func (r *Reader) Close() error {
+	if r.data == nil {
+		return ErrClosed
+	}
+	err := munmap(r.mem)
+	r.data, r.mem = nil, nil
+	return err
+}
@@ -0,0 +1,136 @@
+// Package recordlog stores streams of MessagePack records in append-only files.
+//
+// A log file starts with an 8-byte header, followed by records. Each record
+// is framed by its length and the CRC-32 (Castagnoli) checksum of its contents,
+// both as big-endian uint32s, and holds exactly one MessagePack object.
+//
+// A Writer appends records to a log, and a Reader reads them through a
+// read-only memory mapping, with random access by record number. A process
+// that crashes while appending can leave a torn record at the end of the log;
+// Readers ignore it, and Writers truncate it when the log is opened.
+//
+// Readers map the file shared, so a Reader that touches bytes removed by a
+// truncation faults with SIGBUS. An open Reader only touches the valid
+// records, which are never truncated, but a Reader must not be opened on a
+// log while a Writer is opening it or recovering from a failed Append.
+package recordlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// magic is the file header: a signature and a version
+const magic = "msgplog\x01"
+
+const frameSize = 8 // length and checksum
+
+var (
+	// ErrNotLog is returned when a file
+	// doesn't start with the log header.
+	ErrNotLog = errors.New("recordlog: not a record log")
+
+	// ErrNotFound is returned when a
+	// record number is out of range.
+	ErrNotFound = errors.New("recordlog: record not found")
+
+	// ErrClosed is returned when a closed
+	// Reader or Writer is used.
+	ErrClosed = errors.New("recordlog: closed")
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+	be       = binary.BigEndian
+)
+
+// next returns the length of the valid record at the start
+// of 'data', including its frame, or 0 if there isn't one
+func next(data []byte) int {
+	if len(data) < frameSize {
+		return 0
+	}
+	sz := uint64(be.Uint32(data))
+	if sz == 0 || sz > uint64(len(data)-frameSize) {
+		return 0
+	}
+	rec := data[frameSize : frameSize+sz]
+	if crc32.Checksum(rec, crcTable) != be.Uint32(data[4:]) {
+		return 0
+	}
+	return frameSize + int(sz)
+}
+
+// scan calls fn with the offset of every valid record
+// in a log, and returns the offset of the end of the last one
+func scan(data []byte, fn func(n int, off int64)) (end int64, err error) {
+	if len(data) < len(magic) || string(data[:len(magic)]) != magic {
+		return 0, ErrNotLog
+	}
+	off := len(magic)
+	for n := 0; ; n++ {
+		sz := next(data[off:])
+		if sz == 0 {
+			return int64(off), nil
+		}
+		if fn != nil {
+			fn(n, int64(off))
+		}
+		off += sz
+	}
+}
+
+// Recover checks every record in the log file 'f' and truncates
+// the file after the last valid one, removing a torn or corrupt
+// tail left behind by a crash. It returns the number of valid records.
+// An empty file is given a header. No Reader may be opening
+// the log at the same time. (See Open.)
+func Recover(f *os.File) (n int, err error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if stat.Size() == 0 {
+		_, err = f.WriteAt([]byte(magic), 0)
+		return 0, err
+	}
+	data, err := mmap(f, stat.Size())
+	if err != nil {
+		return 0, err
+	}
+	end, err := scan(data, func(int, int64) { n++ })
+	if uerr := munmap(data); err == nil {
+		err = uerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if end < stat.Size() {
+		err = f.Truncate(end)
+	}
+	return n, err
+}
+
+// putFrame fills in the frame at the start of
+// 'b' for the record that follows it
+func putFrame(b []byte) {
+	rec := b[frameSize:]
+	be.PutUint32(b, uint32(len(rec)))
+	be.PutUint32(b[4:], crc32.Checksum(rec, crcTable))
+}
+
+// validate checks that 'rec' holds one MessagePack object
+func validate(rec []byte) error {
+	rest, err := msgp.Skip(rec)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("recordlog: record holds more than one object")
+	}
+	return nil
+}
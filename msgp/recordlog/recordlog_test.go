@@ -0,0 +1,192 @@
+package recordlog
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+func writeLog(t *testing.T, name string, from, to int) {
+	t.Helper()
+	w, err := OpenWriter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := from; i < to; i++ {
+		n, err := w.AppendRaw(msgp.AppendString(nil, "record "+strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != i {
+			t.Fatalf("got record number %d; wanted %d", n, i)
+		}
+	}
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkLog(t *testing.T, name string, n int) {
+	t.Helper()
+	for _, every := range []int{0, 1, 7} {
+		r, err := Open(name, Options{IndexInterval: every})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Len() != n {
+			t.Fatalf("got %d records; wanted %d", r.Len(), n)
+		}
+		// random access, in no particular order
+		for i := n - 1; i >= 0; i -= 3 {
+			var s msgp.Raw
+			if err := r.Unmarshal(i, &s); err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := msgp.ReadStringBytes(s)
+			if err != nil || got != "record "+strconv.Itoa(i) {
+				t.Errorf("record %d: got %q, %v", i, got, err)
+			}
+		}
+		if _, err := r.Record(n); err != ErrNotFound {
+			t.Errorf("got %v; wanted %v", err, ErrNotFound)
+		}
+		var count int
+		for i, rec := range r.All() {
+			if i != count {
+				t.Errorf("got record number %d; wanted %d", i, count)
+			}
+			if got, _, _ := msgp.ReadStringBytes(rec); got != "record "+strconv.Itoa(i) {
+				t.Errorf("record %d: got %q", i, got)
+			}
+			count++
+		}
+		if count != n {
+			t.Errorf("iterated over %d records; wanted %d", count, n)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Record(0); err != ErrClosed {
+			t.Errorf("got %v; wanted %v", err, ErrClosed)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log")
+	writeLog(t, name, 0, 50)
+	checkLog(t, name, 50)
+	// reopening appends
+	writeLog(t, name, 50, 60)
+	checkLog(t, name, 60)
+
+	w, err := OpenWriter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.AppendRaw([]byte{0x92, 0x01}); err == nil {
+		t.Error("appended an incomplete object")
+	}
+	if _, err := w.AppendRaw([]byte{0x01, 0x02}); err == nil {
+		t.Error("appended two objects")
+	}
+	if w.Len() != 60 {
+		t.Errorf("got %d records", w.Len())
+	}
+}
+
+func TestRecover(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log")
+	writeLog(t, name, 0, 10)
+	stat, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := stat.Size()
+
+	tails := map[string][]byte{
+		"short frame":  {0, 0, 0},
+		"short record": {0, 0, 0, 10, 1, 2, 3, 4, 0xa1},
+		"checksum":     {0, 0, 0, 1, 1, 2, 3, 4, 0xc0},
+	}
+	for name2, tail := range tails {
+		t.Run(name2, func(t *testing.T) {
+			f, err := os.OpenFile(name, os.O_RDWR|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write(tail); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			// readers ignore the tail
+			checkLog(t, name, 10)
+
+			f, err = os.OpenFile(name, os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := Recover(f)
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 10 {
+				t.Errorf("recovered %d records; wanted 10", n)
+			}
+			stat, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.Size() != size {
+				t.Errorf("got size %d after recovery; wanted %d", stat.Size(), size)
+			}
+		})
+	}
+
+	// not a log
+	other := filepath.Join(t.TempDir(), "other")
+	if err := os.WriteFile(other, []byte("hello, world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(other, Options{}); !errors.Is(err, ErrNotLog) {
+		t.Errorf("got %v; wanted %v", err, ErrNotLog)
+	}
+	if _, err := OpenWriter(other); !errors.Is(err, ErrNotLog) {
+		t.Errorf("got %v; wanted %v", err, ErrNotLog)
+	}
+}
+
+// TestCrossCompile checks that the build constraints of the
+// mmap files cover every platform, including those without mmap.
+func TestCrossCompile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cross compilation in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	targets := []string{
+		"linux/amd64", "darwin/arm64", "windows/amd64",
+		"js/wasm", "wasip1/wasm", "plan9/amd64", "solaris/amd64", "aix/ppc64",
+	}
+	for _, target := range targets {
+		goos, goarch, _ := strings.Cut(target, "/")
+		cmd := exec.Command("go", "build", ".")
+		cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("%s: %v\n%s", target, err, out)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package recordlog
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Writer appends records to a log file.
+// A Writer is not safe for concurrent use.
+type Writer struct {
+	f   *os.File
+	n   int   // number of records
+	off int64 // end of the last record
+	buf []byte
+}
+
+// OpenWriter opens the log file 'name' for appending,
+// creating it if it doesn't exist. The log is recovered
+// first, so a torn record at the end is removed. (See Recover.)
+func OpenWriter(name string) (*Writer, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	n, err := Recover(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	off, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Writer{f: f, n: n, off: off}, nil
+}
+
+// Len returns the number of records in the log.
+func (w *Writer) Len() int { return w.n }
+
+// Append appends 'm' to the log as a record,
+// and returns the number of the record.
+func (w *Writer) Append(m msgp.Marshaler) (int, error) {
+	if w.f == nil {
+		return 0, ErrClosed
+	}
+	var err error
+	w.buf = append(w.buf[:0], make([]byte, frameSize)...)
+	w.buf, err = m.MarshalMsg(w.buf)
+	if err != nil {
+		return 0, err
+	}
+	return w.write()
+}
+
+// AppendRaw appends 'rec', which must hold exactly
+// one MessagePack object, to the log as a record,
+// and returns the number of the record.
+func (w *Writer) AppendRaw(rec []byte) (int, error) {
+	if w.f == nil {
+		return 0, ErrClosed
+	}
+	if err := validate(rec); err != nil {
+		return 0, err
+	}
+	w.buf = append(w.buf[:0], make([]byte, frameSize)...)
+	w.buf = append(w.buf, rec...)
+	return w.write()
+}
+
+// write writes the record in w.buf
+func (w *Writer) write() (int, error) {
+	if len(w.buf)-frameSize > math.MaxUint32 {
+		return 0, errors.New("recordlog: record too large")
+	}
+	putFrame(w.buf)
+	if _, err := w.f.Write(w.buf); err != nil {
+		// don't leave a torn record behind
+		// for the next one to follow
+		if terr := w.f.Truncate(w.off); terr == nil {
+			w.f.Seek(w.off, io.SeekStart)
+		}
+		return 0, err
+	}
+	w.off += int64(len(w.buf))
+	w.n++
+	return w.n - 1, nil
+}
+
+// Sync commits the log to stable storage.
+func (w *Writer) Sync() error {
+	if w.f == nil {
+		return ErrClosed
+	}
+	return w.f.Sync()
+}
+
+// Close closes the log file. It doesn't sync it.
+func (w *Writer) Close() error {
+	if w.f == nil {
+		return ErrClosed
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
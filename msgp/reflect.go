@@ -0,0 +1,622 @@
+package msgp
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MarshalReflect appends the MessagePack encoding of 'v' to 'b',
+// using reflection for types that don't have generated methods.
+// It encodes values the same way that generated code would:
+//
+//   - Types that implement Marshaler or Extension use those methods,
+//     unless a struct only has them because they are promoted from
+//     an embedded field, since they would encode only that field.
+//     (Reflection can't tell a promoted method from one that the struct
+//     declares in the same method set as the embedded field, so the
+//     struct is encoded field by field in that case too.)
+//   - Structs are encoded as maps, following the same 'msg' and
+//     'msgpack' tag rules as the code generator: a tag name replaces the
+//     field name, "-" skips the field, and the "omitempty", "omitzero"
+//     and "flatten" options are supported. Unexported fields are skipped.
+//     Flattened fields may be structs or pointers to structs; the fields
+//     behind a nil pointer are omitted.
+//     With "omitempty", named structs are omitted if they are equal to
+//     their zero value, and arrays are never omitted.
+//   - []byte and [N]byte are encoded as 'bin'.
+//   - Nil slices and maps are encoded as empty arrays and maps,
+//     and nil pointers and interfaces are encoded as 'nil'.
+//   - time.Time is encoded as a timestamp extension
+//     and time.Duration as an integer.
+//
+// Map keys are encoded with the same rules as values.
+// Channels, functions and unsafe pointers are not supported.
+func MarshalReflect(b []byte, v any) ([]byte, error) {
+	return appendReflect(b, reflect.ValueOf(v), 0)
+}
+
+// UnmarshalReflect decodes the first object in 'b' into the value that
+// 'v' points to, and returns the remaining bytes. It is the inverse of
+// MarshalReflect: types that implement Unmarshaler or Extension use those
+// methods, and map keys that don't match a struct field are skipped.
+// Pointers, maps and slices are allocated as needed, and 'nil' sets
+// them to nil. Existing maps are cleared before they are filled.
+func UnmarshalReflect(b []byte, v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return b, errors.New("msgp: UnmarshalReflect requires a non-nil pointer")
+	}
+	return readReflect(b, rv.Elem(), 0)
+}
+
+var (
+	marshalerType   = reflect.TypeFor[Marshaler]()
+	unmarshalerType = reflect.TypeFor[Unmarshaler]()
+	extensionType   = reflect.TypeFor[Extension]()
+	isZeroerType    = reflect.TypeFor[interface{ IsZero() bool }]()
+	timeType        = reflect.TypeFor[time.Time]()
+	durationType    = reflect.TypeFor[time.Duration]()
+	jsonNumberType  = reflect.TypeFor[json.Number]()
+)
+
+// reflectField is a struct field that is encoded
+type reflectField struct {
+	name      string // encoded name
+	goName    string // for errors
+	index     []int
+	omitEmpty bool
+	omitZero  bool
+}
+
+// reflectStruct is the encoding of a struct type
+type reflectStruct struct {
+	fields []reflectField
+	byName map[string]int
+}
+
+var reflectStructs sync.Map // reflect.Type -> *reflectStruct
+
+func structFields(t reflect.Type) *reflectStruct {
+	if rs, ok := reflectStructs.Load(t); ok {
+		return rs.(*reflectStruct)
+	}
+	rs := &reflectStruct{byName: make(map[string]int)}
+	rs.fields = appendFields(rs.fields, t, nil)
+	for i := range rs.fields {
+		if _, ok := rs.byName[rs.fields[i].name]; !ok {
+			rs.byName[rs.fields[i].name] = i
+		}
+	}
+	actual, _ := reflectStructs.LoadOrStore(t, rs)
+	return actual.(*reflectStruct)
+}
+
+// appendFields applies the tag rules in parse/getast.go
+func appendFields(out []reflectField, t reflect.Type, index []int) []reflectField {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		body := f.Tag.Get("msg")
+		if body == "" {
+			body = f.Tag.Get("msgpack")
+		}
+		tags := strings.Split(body, ",")
+		if tags[0] == "-" {
+			continue
+		}
+		fi := reflectField{
+			name:   tags[0],
+			goName: f.Name,
+			index:  append(index[:len(index):len(index)], i),
+		}
+		flatten := false
+		for _, tag := range tags[1:] {
+			switch tag {
+			case "omitempty":
+				fi.omitEmpty = true
+			case "omitzero":
+				fi.omitZero = true
+			case "flatten":
+				flatten = true
+			}
+		}
+		if f.Anonymous && flatten {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				out = appendFields(out, ft, fi.index)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if fi.name == "" {
+			fi.name = f.Name
+		}
+		out = append(out, fi)
+	}
+	return out
+}
+
+var implementsCache sync.Map // [2]reflect.Type -> bool
+
+// implements returns whether 't' implements 'iface' with methods
+// declared on the type itself, ignoring methods that a struct gets
+// from embedded fields, since those would encode only the embedded part
+func implements(t, iface reflect.Type) bool {
+	if !t.Implements(iface) {
+		return false
+	}
+	st := t
+	if st.Kind() == reflect.Pointer {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return true
+	}
+	key := [2]reflect.Type{t, iface}
+	if ok, found := implementsCache.Load(key); found {
+		return ok.(bool)
+	}
+	ok := true
+	for i := range iface.NumMethod() {
+		name := iface.Method(i).Name
+		if !declared(st, name, false) && !declared(reflect.PointerTo(st), name, true) {
+			ok = false
+			break
+		}
+	}
+	implementsCache.Store(key, ok)
+	return ok
+}
+
+// declared returns whether 't', which is the struct 'st' or *st,
+// has the method 'name' without getting it from an embedded field
+// of 'st'. A promoted method has the same signature as a method
+// that the struct declares to replace it, so if an embedded field
+// has the method in the same method set, it is taken to be promoted.
+func declared(t reflect.Type, name string, ptr bool) bool {
+	if _, ok := t.MethodByName(name); !ok {
+		return false
+	}
+	st := t
+	if ptr {
+		st = t.Elem()
+	}
+	for i := range st.NumField() {
+		f := st.Field(i)
+		if !f.Anonymous {
+			continue
+		}
+		ft := f.Type
+		// *st can call the pointer methods of embedded values
+		if ptr && ft.Kind() != reflect.Pointer && ft.Kind() != reflect.Interface {
+			ft = reflect.PointerTo(ft)
+		}
+		if _, ok := ft.MethodByName(name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldByIndex is like v.FieldByIndex, but it returns an invalid
+// Value for a field behind a nil embedded pointer, unless 'alloc'
+// is set, in which case it allocates the pointer
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, nil
+				}
+				if !v.CanSet() {
+					return v, errors.New("msgp: cannot set embedded pointer to unexported struct " + v.Type().Elem().String())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// omit returns whether a field should be omitted,
+// following the rules of generated code
+func (f *reflectField) omit(v reflect.Value) bool {
+	if f.omitZero {
+		if !v.Type().Implements(isZeroerType) && v.CanAddr() && reflect.PointerTo(v.Type()).Implements(isZeroerType) {
+			v = v.Addr()
+		}
+		if v.Type().Implements(isZeroerType) {
+			if v.Kind() == reflect.Pointer && v.IsNil() {
+				return true
+			}
+			return v.Interface().(interface{ IsZero() bool }).IsZero()
+		}
+		return v.IsZero()
+	}
+	if f.omitEmpty {
+		switch v.Kind() {
+		case reflect.Array:
+			return false
+		case reflect.Struct:
+			// only named structs can be compared to their zero value
+			if v.Type().Name() == "" {
+				return false
+			}
+		case reflect.Slice, reflect.Map, reflect.Pointer, reflect.Interface:
+			return v.IsNil()
+		}
+		return v.IsZero()
+	}
+	return false
+}
+
+func appendReflect(b []byte, v reflect.Value, depth int) (o []byte, err error) {
+	if !v.IsValid() {
+		return AppendNil(b), nil
+	}
+	if depth >= recursionLimit {
+		return b, ErrRecursion
+	}
+	t := v.Type()
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return AppendNil(b), nil
+		}
+	}
+	if !implements(t, marshalerType) && !implements(t, extensionType) {
+		// generated methods usually have pointer receivers
+		if pt := reflect.PointerTo(t); implements(pt, marshalerType) || implements(pt, extensionType) {
+			if !v.CanAddr() {
+				tmp := reflect.New(t).Elem()
+				tmp.Set(v)
+				v = tmp
+			}
+			v = v.Addr()
+			t = pt
+		}
+	}
+	if implements(t, marshalerType) {
+		return v.Interface().(Marshaler).MarshalMsg(b)
+	}
+	if implements(t, extensionType) {
+		return AppendExtension(b, v.Interface().(Extension))
+	}
+	switch t {
+	case timeType:
+		return AppendTime(b, v.Interface().(time.Time)), nil
+	case durationType:
+		return AppendDuration(b, time.Duration(v.Int())), nil
+	case jsonNumberType:
+		return AppendJSONNumber(b, json.Number(v.String()))
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return AppendBool(b, v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return AppendInt64(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return AppendUint64(b, v.Uint()), nil
+	case reflect.Float32:
+		return AppendFloat32(b, float32(v.Float())), nil
+	case reflect.Float64:
+		return AppendFloat64(b, v.Float()), nil
+	case reflect.Complex64:
+		return AppendComplex64(b, complex64(v.Complex())), nil
+	case reflect.Complex128:
+		return AppendComplex128(b, v.Complex()), nil
+	case reflect.String:
+		return AppendString(b, v.String()), nil
+	case reflect.Pointer, reflect.Interface:
+		return appendReflect(b, v.Elem(), depth+1)
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Slice {
+				return AppendBytes(b, v.Bytes()), nil
+			}
+			if !v.CanAddr() {
+				tmp := reflect.New(t).Elem()
+				tmp.Set(v)
+				v = tmp
+			}
+			return AppendBytes(b, v.Slice(0, v.Len()).Bytes()), nil
+		}
+		b = AppendArrayHeader(b, uint32(v.Len()))
+		for i := range v.Len() {
+			if b, err = appendReflect(b, v.Index(i), depth+1); err != nil {
+				return b, WrapError(err, i)
+			}
+		}
+		return b, nil
+
+	case reflect.Map:
+		b = AppendMapHeader(b, uint32(v.Len()))
+		iter := v.MapRange()
+		for iter.Next() {
+			if b, err = appendReflect(b, iter.Key(), depth+1); err != nil {
+				return b, err
+			}
+			if b, err = appendReflect(b, iter.Value(), depth+1); err != nil {
+				return b, WrapError(err, reflectCtx(iter.Key()))
+			}
+		}
+		return b, nil
+
+	case reflect.Struct:
+		rs := structFields(t)
+		n := 0
+		for i := range rs.fields {
+			fv, _ := fieldByIndex(v, rs.fields[i].index, false)
+			if fv.IsValid() && !rs.fields[i].omit(fv) {
+				n++
+			}
+		}
+		b = AppendMapHeader(b, uint32(n))
+		for i := range rs.fields {
+			f := &rs.fields[i]
+			fv, _ := fieldByIndex(v, f.index, false)
+			if !fv.IsValid() || f.omit(fv) {
+				continue
+			}
+			b = AppendString(b, f.name)
+			if b, err = appendReflect(b, fv, depth+1); err != nil {
+				return b, WrapError(err, f.goName)
+			}
+		}
+		return b, nil
+	}
+	return b, &ErrUnsupportedType{T: t}
+}
+
+// reflectCtx is the error context for a map key
+func reflectCtx(k reflect.Value) any {
+	switch k.Kind() {
+	case reflect.String:
+		return k.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return k.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return k.Uint()
+	}
+	return k.Type().String()
+}
+
+// readReflect decodes into 'v', which must be settable,
+// and returns the input on error
+func readReflect(b []byte, v reflect.Value, depth int) (o []byte, err error) {
+	if depth >= recursionLimit {
+		return b, ErrRecursion
+	}
+	t := v.Type()
+	if IsNil(b) {
+		switch v.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+			v.SetZero()
+			return b[1:], nil
+		}
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		if !implements(t, unmarshalerType) && !implements(t, extensionType) {
+			return readReflect(b, v.Elem(), depth+1)
+		}
+	} else if pt := reflect.PointerTo(t); implements(pt, unmarshalerType) || implements(pt, extensionType) {
+		v = v.Addr()
+		t = pt
+	}
+	if implements(t, unmarshalerType) {
+		return v.Interface().(Unmarshaler).UnmarshalMsg(b)
+	}
+	if implements(t, extensionType) {
+		return ReadExtensionBytes(b, v.Interface().(Extension))
+	}
+	switch t {
+	case timeType:
+		var tm time.Time
+		tm, o, err = ReadTimeBytes(b)
+		if err == nil {
+			v.Set(reflect.ValueOf(tm))
+		}
+		return o, err
+	case jsonNumberType:
+		var n json.Number
+		n, o, err = ReadJSONNumberBytes(b)
+		v.SetString(string(n))
+		return o, err
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		var x bool
+		x, o, err = ReadBoolBytes(b)
+		v.SetBool(x)
+		return o, err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, o, err = ReadInt64Bytes(b); err != nil {
+			return b, err
+		}
+		if v.OverflowInt(i) {
+			return b, IntOverflow{Value: i, FailedBitsize: t.Bits()}
+		}
+		v.SetInt(i)
+		return o, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		if u, o, err = ReadUint64Bytes(b); err != nil {
+			return b, err
+		}
+		if v.OverflowUint(u) {
+			return b, UintOverflow{Value: u, FailedBitsize: t.Bits()}
+		}
+		v.SetUint(u)
+		return o, nil
+	case reflect.Float32:
+		var f float32
+		f, o, err = ReadFloat32Bytes(b)
+		v.SetFloat(float64(f))
+		return o, err
+	case reflect.Float64:
+		var f float64
+		f, o, err = ReadFloat64Bytes(b)
+		v.SetFloat(f)
+		return o, err
+	case reflect.Complex64:
+		var c complex64
+		c, o, err = ReadComplex64Bytes(b)
+		v.SetComplex(complex128(c))
+		return o, err
+	case reflect.Complex128:
+		var c complex128
+		c, o, err = ReadComplex128Bytes(b)
+		v.SetComplex(c)
+		return o, err
+	case reflect.String:
+		var s string
+		s, o, err = ReadStringBytes(b)
+		v.SetString(s)
+		return o, err
+
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			break
+		}
+		var i any
+		if i, o, err = ReadIntfBytes(b); err != nil {
+			return b, err
+		}
+		if i == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(i))
+		}
+		return o, nil
+
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			var p []byte
+			if p, o, err = ReadBytesBytes(b, v.Bytes()); err != nil {
+				return b, err
+			}
+			v.SetBytes(p)
+			return o, nil
+		}
+		var sz uint32
+		if sz, o, err = ReadArrayHeaderBytes(b); err != nil {
+			return b, err
+		}
+		// every element is at least one byte
+		if uint64(len(o)) < uint64(sz) {
+			return b, ErrShortBytes
+		}
+		if v.Cap() >= int(sz) {
+			v.SetLen(int(sz))
+		} else {
+			v.Set(reflect.MakeSlice(t, int(sz), int(sz)))
+		}
+		for i := range int(sz) {
+			if o, err = readReflect(o, v.Index(i), depth+1); err != nil {
+				return b, WrapErrorBytes(err, b, o, i)
+			}
+		}
+		return o, nil
+
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return ReadExactBytes(b, v.Slice(0, v.Len()).Bytes())
+		}
+		var sz uint32
+		if sz, o, err = ReadArrayHeaderBytes(b); err != nil {
+			return b, err
+		}
+		if int(sz) != v.Len() {
+			return b, ArrayError{Wanted: uint32(v.Len()), Got: sz}
+		}
+		for i := range v.Len() {
+			if o, err = readReflect(o, v.Index(i), depth+1); err != nil {
+				return b, WrapErrorBytes(err, b, o, i)
+			}
+		}
+		return o, nil
+
+	case reflect.Map:
+		var sz uint32
+		if sz, o, err = ReadMapHeaderBytes(b); err != nil {
+			return b, err
+		}
+		// every key and value is at least one byte
+		if uint64(len(o)) < 2*uint64(sz) {
+			return b, ErrShortBytes
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(t, int(sz)))
+		} else {
+			v.Clear()
+		}
+		kt, vt := t.Key(), t.Elem()
+		for range sz {
+			key := reflect.New(kt).Elem()
+			if kt.Kind() == reflect.String {
+				// accept 'bin' keys, like generated code
+				var k []byte
+				if k, o, err = ReadMapKeyZC(o); err == nil {
+					key.SetString(string(k))
+				}
+			} else {
+				o, err = readReflect(o, key, depth+1)
+			}
+			if err != nil {
+				return b, WrapErrorBytes(err, b, o)
+			}
+			val := reflect.New(vt).Elem()
+			if o, err = readReflect(o, val, depth+1); err != nil {
+				return b, WrapErrorBytes(err, b, o, reflectCtx(key))
+			}
+			v.SetMapIndex(key, val)
+		}
+		return o, nil
+
+	case reflect.Struct:
+		rs := structFields(t)
+		var sz uint32
+		if sz, o, err = ReadMapHeaderBytes(b); err != nil {
+			return b, err
+		}
+		for range sz {
+			var k []byte
+			if k, o, err = ReadMapKeyZC(o); err != nil {
+				return b, WrapErrorBytes(err, b, o)
+			}
+			i, ok := rs.byName[UnsafeString(k)]
+			if !ok {
+				if o, err = Skip(o); err != nil {
+					return b, WrapErrorBytes(err, b, o)
+				}
+				continue
+			}
+			f := &rs.fields[i]
+			fv, err := fieldByIndex(v, f.index, true)
+			if err != nil {
+				return b, WrapErrorBytes(err, b, o, FieldKey(f.goName, f.name))
+			}
+			if o, err = readReflect(o, fv, depth+1); err != nil {
+				return b, WrapErrorBytes(err, b, o, FieldKey(f.goName, f.name))
+			}
+		}
+		return o, nil
+	}
+	return b, &ErrUnsupportedType{T: t}
+}
@@ -0,0 +1,255 @@
+package msgp
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type reflectInner struct {
+	X int    `msg:"x"`
+	Y string `msgpack:"y,omitempty"`
+}
+
+type ReflectEmbed struct {
+	E int
+}
+
+type reflectFlat struct {
+	F1 int `msg:"f1"`
+}
+
+type reflectZeroer struct{ N int }
+
+func (z reflectZeroer) IsZero() bool { return z.N < 0 }
+
+type reflectOuter struct {
+	reflectFlat `msg:",flatten"`
+	ReflectEmbed
+	reflectInner // unexported, so skipped
+
+	Name    string            `msg:"name"`
+	Skip    int               `msg:"-"`
+	Empty   []int             `msg:"empty,omitempty"`
+	Zero    reflectZeroer     `msg:"zero,omitzero"`
+	Ptr     *reflectInner     `msg:"ptr"`
+	Slice   []reflectInner    `msg:"slice"`
+	Map     map[string]uint16 `msg:"map"`
+	IntKeys map[int]bool      `msg:"int_keys"`
+	Bin     []byte            `msg:"bin"`
+	Fixed   [4]byte           `msg:"fixed"`
+	Arr     [2]float32        `msg:"arr"`
+	Time    time.Time         `msg:"time"`
+	Dur     time.Duration     `msg:"dur"`
+	Any     any               `msg:"any"`
+	Raw     Raw               `msg:"raw"`
+	private int
+}
+
+func TestReflectRoundTrip(t *testing.T) {
+	in := reflectOuter{
+		reflectFlat:  reflectFlat{F1: 1},
+		ReflectEmbed: ReflectEmbed{E: 2},
+		Name:         "name",
+		Skip:         3,
+		Zero:         reflectZeroer{N: -1},
+		Ptr:          &reflectInner{X: 4, Y: "y"},
+		Slice:        []reflectInner{{X: 5}, {X: 6}},
+		Map:          map[string]uint16{"a": 7},
+		IntKeys:      map[int]bool{-8: true},
+		Bin:          []byte{9},
+		Fixed:        [4]byte{1, 2, 3, 4},
+		Arr:          [2]float32{1.5, 2.5},
+		Time:         time.Unix(1700000000, 0),
+		Dur:          time.Second,
+		Any:          "any",
+		Raw:          AppendInt(nil, 10),
+		private:      11,
+	}
+	raw, err := MarshalReflect(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check the field names
+	var v Value
+	if _, err := v.UnmarshalMsg(raw); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, e := range v.Entries() {
+		k, _ := e.Key.Str()
+		keys = append(keys, k)
+	}
+	want := []string{"f1", "ReflectEmbed", "name", "ptr", "slice", "map", "int_keys", "bin", "fixed", "arr", "time", "dur", "any", "raw"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("got keys %q; wanted %q", keys, want)
+	}
+	if f, _ := v.Get("fixed"); f.Type() != BinType {
+		t.Errorf("[4]byte encoded as %s", f.Type())
+	}
+	if r, _ := v.Get("raw"); r.Type() != IntType {
+		t.Errorf("Raw encoded as %s", r.Type())
+	}
+
+	var out reflectOuter
+	out.Map = map[string]uint16{"stale": 1}
+	rest, err := UnmarshalReflect(append(raw, 0xc0), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 {
+		t.Errorf("got %d bytes left", len(rest))
+	}
+	in.Skip, in.private, in.Zero = 0, 0, reflectZeroer{}
+	if !out.Time.Equal(in.Time) {
+		t.Errorf("got time %v; wanted %v", out.Time, in.Time)
+	}
+	out.Time = in.Time
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %+v; wanted %+v", out, in)
+	}
+
+	// value and pointer arguments encode the same way
+	raw, _ = MarshalReflect(nil, &in)
+	raw2, err := MarshalReflect(nil, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw2) != len(raw) {
+		t.Errorf("got %d bytes; wanted %d", len(raw2), len(raw))
+	}
+}
+
+func TestReflectErrors(t *testing.T) {
+	if _, err := MarshalReflect(nil, make(chan int)); err == nil {
+		t.Error("encoded a channel")
+	}
+	if _, err := UnmarshalReflect(AppendNil(nil), reflectInner{}); err == nil {
+		t.Error("decoded into a non-pointer")
+	}
+
+	raw, _ := MarshalReflect(nil, map[string]any{"slice": []any{1, 300}})
+	var dst struct {
+		Slice []int8 `msg:"slice"`
+	}
+	_, err := UnmarshalReflect(raw, &dst)
+	var lerr LocatedError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("got %v", err)
+	}
+	if got := pathString(lerr.Path()); got != "slice/1" {
+		t.Errorf("got path %q", got)
+	}
+	var ierr IntOverflow
+	if !errors.As(err, &ierr) || !strings.HasSuffix(err.Error(), " at Slice/1") {
+		t.Errorf("got %v; wanted IntOverflow at Slice/1", err)
+	}
+
+	var nested any
+	for range 3 {
+		nested = []any{nested}
+	}
+	raw, _ = MarshalReflect(nil, nested)
+	for i := 1; i < len(raw); i++ {
+		var out any
+		if _, err := UnmarshalReflect(raw[:i], &out); err == nil {
+			t.Errorf("len %d: no error", i)
+		}
+	}
+	if _, err := MarshalReflect(nil, []any{func() {}}); err == nil {
+		t.Error("encoded a func")
+	}
+}
+
+// ReflectGen has methods like generated ones
+type ReflectGen struct{ A int }
+
+func (g *ReflectGen) MarshalMsg(b []byte) ([]byte, error) { return AppendInt(b, g.A), nil }
+
+func (g *ReflectGen) UnmarshalMsg(b []byte) (o []byte, err error) {
+	g.A, o, err = ReadIntBytes(b)
+	return o, err
+}
+
+type reflectPromoted struct {
+	ReflectGen
+	B string
+}
+
+type reflectDeclared struct {
+	ReflectGen
+	B string
+}
+
+func (d reflectDeclared) MarshalMsg(b []byte) ([]byte, error) { return AppendString(b, d.B), nil }
+
+type reflectFlatPtr struct {
+	*ReflectEmbed `msg:",flatten"`
+	B             string
+}
+
+type reflectFlatPrivate struct {
+	*reflectFlat `msg:",flatten"`
+}
+
+func TestReflectEmbedded(t *testing.T) {
+	// promoted methods encode only the embedded field
+	in := reflectPromoted{ReflectGen{1}, "b"}
+	raw, err := MarshalReflect(nil, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := Diag(raw); s != `{"ReflectGen": 1, "B": "b"}` {
+		t.Errorf("got %s", s)
+	}
+	var out reflectPromoted
+	if _, err := UnmarshalReflect(raw, &out); err != nil || out != in {
+		t.Errorf("got %+v, %v; wanted %+v", out, err, in)
+	}
+
+	// including from embedded pointers
+	raw, err = MarshalReflect(nil, struct {
+		*ReflectGen
+		B string
+	}{&ReflectGen{1}, "b"})
+	if s := Diag(raw); err != nil || s != `{"ReflectGen": 1, "B": "b"}` {
+		t.Errorf("got %s, %v", s, err)
+	}
+
+	// declared methods are used
+	raw, err = MarshalReflect(nil, reflectDeclared{ReflectGen{1}, "b"})
+	if s, _, _ := ReadStringBytes(raw); err != nil || s != "b" {
+		t.Errorf("got %x, %v", raw, err)
+	}
+
+	// flattened pointers
+	raw, err = MarshalReflect(nil, reflectFlatPtr{B: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := Diag(raw); s != `{"B": "b"}` {
+		t.Errorf("nil pointer: got %s", s)
+	}
+	raw, err = MarshalReflect(nil, reflectFlatPtr{&ReflectEmbed{E: 2}, "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fp reflectFlatPtr
+	if _, err := UnmarshalReflect(raw, &fp); err != nil || fp.ReflectEmbed == nil || fp.E != 2 || fp.B != "b" {
+		t.Errorf("got %+v, %v", fp, err)
+	}
+
+	// like encoding/json, the pointer has to be settable
+	raw = AppendInt(AppendString(AppendMapHeader(nil, 1), "f1"), 1)
+	var priv reflectFlatPrivate
+	if _, err := UnmarshalReflect(raw, &priv); err == nil {
+		t.Error("no error for an unexported embedded pointer")
+	}
+	priv.reflectFlat = new(reflectFlat)
+	if _, err := UnmarshalReflect(raw, &priv); err != nil || priv.F1 != 1 {
+		t.Errorf("got %+v, %v", priv.reflectFlat, err)
+	}
+}
@@ -0,0 +1,187 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Client makes calls to a MessagePack-RPC server.
+// A Client is safe for concurrent use.
+type Client struct {
+	rwc io.ReadWriteCloser
+	out *sender
+
+	mu      sync.Mutex
+	seq     uint32
+	pending map[uint32]chan *message
+	err     error // set when the connection is done
+	closed  bool
+	done    chan struct{}
+}
+
+// NewClient returns a new Client that makes calls over 'rwc'.
+// Requests and notifications that the Client receives are ignored.
+func NewClient(rwc io.ReadWriteCloser) *Client {
+	c := &Client{
+		rwc:     rwc,
+		out:     newSender(rwc),
+		pending: make(map[uint32]chan *message),
+		done:    make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+// read delivers responses until the connection fails
+func (c *Client) read() {
+	r := msgp.NewReader(c.rwc)
+	var err error
+	for {
+		m := new(message)
+		if err = m.decode(r); err != nil {
+			break
+		}
+		if m.typ != typeResponse {
+			continue
+		}
+		c.mu.Lock()
+		ch := c.pending[m.id]
+		delete(c.pending, m.id)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- m
+		}
+	}
+	c.mu.Lock()
+	if c.err == nil {
+		if err == io.EOF {
+			err = ErrClosed
+		}
+		c.err = err
+	}
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// Call calls 'method' with 'params', which must encode an
+// array (nil stands for no params), and waits for the response,
+// which is decoded into 'result' unless it is nil (a nil result from
+// the method is decoded as a MessagePack nil). If the
+// method fails, the error is an *Error. If 'ctx' is done
+// before the response arrives, Call returns ctx.Err(),
+// and the response is discarded when it arrives.
+func (c *Client) Call(ctx context.Context, method string, params msgp.Encodable, result msgp.Decodable) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ch := make(chan *message, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	id := c.seq
+	c.seq++
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	err := c.out.send(func(w *msgp.Writer) error {
+		if err := w.WriteArrayHeader(4); err != nil {
+			return err
+		}
+		if err := w.WriteInt(typeRequest); err != nil {
+			return err
+		}
+		if err := w.WriteUint32(id); err != nil {
+			return err
+		}
+		if err := w.WriteString(method); err != nil {
+			return err
+		}
+		return writeParams(w, params)
+	})
+	if err != nil {
+		c.forget(id)
+		return err
+	}
+
+	select {
+	case m, ok := <-ch:
+		if !ok {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.err
+		}
+		if len(m.params) > 0 {
+			return &Error{Value: m.params}
+		}
+		if result == nil {
+			return nil
+		}
+		raw := m.result
+		if len(raw) == 0 {
+			// msgp.Raw decodes nil as empty
+			raw = msgp.AppendNil(nil)
+		}
+		return msgp.Decode(bytes.NewReader(raw), result)
+	case <-ctx.Done():
+		c.forget(id)
+		return ctx.Err()
+	}
+}
+
+// forget stops waiting for the response to call 'id'
+func (c *Client) forget(id uint32) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// Notify sends a notification of 'method' with 'params',
+// which must encode an array (nil stands for no params).
+func (c *Client) Notify(method string, params msgp.Encodable) error {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.out.send(func(w *msgp.Writer) error {
+		if err := w.WriteArrayHeader(3); err != nil {
+			return err
+		}
+		if err := w.WriteInt(typeNotification); err != nil {
+			return err
+		}
+		if err := w.WriteString(method); err != nil {
+			return err
+		}
+		return writeParams(w, params)
+	})
+}
+
+// Close closes the connection. Calls that
+// are in flight return ErrClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	if c.err == nil {
+		c.err = ErrClosed
+	}
+	c.mu.Unlock()
+	err := c.rwc.Close()
+	<-c.done
+	return err
+}
@@ -0,0 +1,148 @@
+// Package rpc implements the MessagePack-RPC protocol over any
+// io.ReadWriteCloser.
+//
+// Messages are arrays: a request is [0, msgid, method, params],
+// a response is [1, msgid, error, result], and a notification
+// is [2, method, params]. The params are always an array, so
+// the types that hold them are usually tuples (see the
+// msgp:tuple directive) or msgp.Raw.
+//
+// A Client sends requests and notifications, and can have any
+// number of calls in flight at once; responses are matched to
+// calls by msgid. A Server dispatches the requests and notifications
+// it receives to the methods registered with Register, each
+// in its own goroutine.
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// message types
+const (
+	typeRequest      = 0
+	typeResponse     = 1
+	typeNotification = 2
+)
+
+var (
+	// ErrClosed is returned by calls on
+	// a Client whose connection is closed.
+	ErrClosed = errors.New("rpc: connection closed")
+
+	// ErrServerClosed is returned by ServeConn after
+	// Shutdown, and sent in response to requests that
+	// arrive while the Server is shutting down.
+	ErrServerClosed = errors.New("rpc: server closed")
+)
+
+// Error is an error returned by the remote peer.
+// The error object can be anything, but it is usually
+// a string. A method can return an *Error to send
+// an error object other than its message.
+type Error struct {
+	Value msgp.Raw
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if s, rest, err := msgp.ReadStringBytes(e.Value); err == nil && len(rest) == 0 {
+		return s
+	}
+	return "rpc: remote error " + msgp.Diag(e.Value)
+}
+
+// EncodeMsg implements msgp.Encodable.
+func (e *Error) EncodeMsg(w *msgp.Writer) error { return e.Value.EncodeMsg(w) }
+
+// message is a request, a response, or a notification
+type message struct {
+	typ    int
+	id     uint32
+	method string
+	params msgp.Raw // the error of a response
+	result msgp.Raw
+}
+
+// decode reads the next message from 'r'
+func (m *message) decode(r *msgp.Reader) error {
+	sz, err := r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	if sz == 0 {
+		return errors.New("rpc: empty message")
+	}
+	if m.typ, err = r.ReadInt(); err != nil {
+		return err
+	}
+	switch {
+	case m.typ == typeRequest && sz == 4:
+		if m.id, err = r.ReadUint32(); err != nil {
+			return err
+		}
+		if m.method, err = r.ReadString(); err != nil {
+			return err
+		}
+		return m.params.DecodeMsg(r)
+	case m.typ == typeResponse && sz == 4:
+		if m.id, err = r.ReadUint32(); err != nil {
+			return err
+		}
+		if err = m.params.DecodeMsg(r); err != nil {
+			return err
+		}
+		return m.result.DecodeMsg(r)
+	case m.typ == typeNotification && sz == 3:
+		if m.method, err = r.ReadString(); err != nil {
+			return err
+		}
+		return m.params.DecodeMsg(r)
+	}
+	return errors.New("rpc: invalid message")
+}
+
+// writeParams writes 'params', or an empty array if it is nil
+func writeParams(w *msgp.Writer, params msgp.Encodable) error {
+	if params == nil {
+		return w.WriteArrayHeader(0)
+	}
+	return params.EncodeMsg(w)
+}
+
+// sender writes whole messages to a connection. Each message
+// is encoded before any of it is written, so a message that
+// fails to encode doesn't corrupt the stream.
+type sender struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf bytes.Buffer
+	enc *msgp.Writer
+}
+
+func newSender(w io.Writer) *sender {
+	s := &sender{w: w}
+	s.enc = msgp.NewWriter(&s.buf)
+	return s
+}
+
+// send writes the message encoded by 'fn'
+func (s *sender) send(fn func(w *msgp.Writer) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.Reset()
+	s.enc.Reset(&s.buf)
+	if err := fn(s.enc); err != nil {
+		return err
+	}
+	if err := s.enc.Flush(); err != nil {
+		return err
+	}
+	_, err := s.w.Write(s.buf.Bytes())
+	return err
+}
@@ -0,0 +1,237 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// pair is the params of "add", as a tuple
+type pair struct{ A, B int }
+
+func (p *pair) DecodeMsg(r *msgp.Reader) (err error) {
+	sz, err := r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	if sz != 2 {
+		return msgp.ArrayError{Wanted: 2, Got: sz}
+	}
+	if p.A, err = r.ReadInt(); err != nil {
+		return err
+	}
+	p.B, err = r.ReadInt()
+	return err
+}
+
+func (p *pair) EncodeMsg(w *msgp.Writer) error {
+	if err := w.WriteArrayHeader(2); err != nil {
+		return err
+	}
+	if err := w.WriteInt(p.A); err != nil {
+		return err
+	}
+	return w.WriteInt(p.B)
+}
+
+type number int
+
+func (n *number) DecodeMsg(r *msgp.Reader) (err error) {
+	*(*int)(n), err = r.ReadInt()
+	return err
+}
+
+func (n *number) EncodeMsg(w *msgp.Writer) error { return w.WriteInt(int(*n)) }
+
+func serve(t *testing.T, s *Server) (*Client, chan error) {
+	t.Helper()
+	cli, srv := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- s.ServeConn(context.Background(), srv) }()
+	c := NewClient(cli)
+	t.Cleanup(func() { c.Close() })
+	return c, done
+}
+
+func TestCall(t *testing.T) {
+	s := NewServer()
+	Register(s, "add", func(ctx context.Context, p *pair) (*number, error) {
+		n := number(p.A + p.B)
+		return &n, nil
+	})
+	Register(s, "fail", func(ctx context.Context, p *msgp.Raw) (*number, error) {
+		return nil, errors.New("it failed")
+	})
+	Register(s, "fail object", func(ctx context.Context, p *msgp.Raw) (*number, error) {
+		return nil, &Error{Value: msgp.AppendInt(nil, 42)}
+	})
+	Register(s, "void", func(ctx context.Context, p *msgp.Raw) (*number, error) {
+		return nil, nil
+	})
+	Register(s, "panic", func(ctx context.Context, p *msgp.Raw) (*number, error) {
+		panic("oops")
+	})
+	c, _ := serve(t, s)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var n number
+			if err := c.Call(ctx, "add", &pair{i, 100}, &n); err != nil {
+				t.Error(err)
+				return
+			}
+			if int(n) != i+100 {
+				t.Errorf("got %d; wanted %d", n, i+100)
+			}
+		}()
+	}
+	wg.Wait()
+
+	errs := map[string]string{
+		"fail":        "it failed",
+		"fail object": "rpc: remote error 42",
+		"missing":     "rpc: method not found: missing",
+		"panic":       "rpc: method panic panicked: oops",
+	}
+	for method, want := range errs {
+		err := c.Call(ctx, method, nil, nil)
+		var rerr *Error
+		if !errors.As(err, &rerr) || err.Error() != want {
+			t.Errorf("%s: got %v; wanted %q", method, err, want)
+		}
+	}
+
+	// a nil pointer result is sent as nil
+	res := msgp.Raw{1}
+	if err := c.Call(ctx, "void", nil, &res); err != nil || len(res) != 0 {
+		t.Errorf("got %x, %v; wanted nil", res, err)
+	}
+	var n number
+	var terr msgp.TypeError
+	if err := c.Call(ctx, "void", nil, &n); !errors.As(err, &terr) {
+		t.Errorf("got %v; wanted a TypeError", err)
+	}
+
+	// the params don't fit
+	params := msgp.AppendArrayHeader(nil, 3)
+	for i := range 3 {
+		params = msgp.AppendInt(params, i)
+	}
+	if err := c.Call(ctx, "add", msgp.Raw(params), nil); err == nil {
+		t.Error("no error for bad params")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	s := NewServer()
+	got := make(chan int, 1)
+	Register(s, "log", func(ctx context.Context, p *pair) (*number, error) {
+		got <- p.A
+		return nil, nil
+	})
+	c, _ := serve(t, s)
+	if err := c.Notify("log", &pair{7, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-got; n != 7 {
+		t.Errorf("got %d; wanted 7", n)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s := NewServer()
+	release, block := make(chan struct{}), make(chan struct{})
+	Register(s, "wait", func(ctx context.Context, p *msgp.Raw) (*number, error) {
+		<-release
+		return new(number), nil
+	})
+	Register(s, "block", func(ctx context.Context, p *msgp.Raw) (*number, error) {
+		<-block
+		return new(number), nil
+	})
+	c, _ := serve(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, "wait", nil, nil); err != context.DeadlineExceeded {
+		t.Fatalf("got %v; wanted %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+	// the late response is discarded
+	if err := c.Call(context.Background(), "wait", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing the client fails calls in flight
+	errc := make(chan error, 1)
+	go func() { errc <- c.Call(context.Background(), "block", nil, nil) }()
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+	if err := <-errc; err != ErrClosed {
+		t.Errorf("got %v; wanted %v", err, ErrClosed)
+	}
+	if err := c.Call(context.Background(), "wait", nil, nil); err != ErrClosed {
+		t.Errorf("got %v; wanted %v", err, ErrClosed)
+	}
+	close(block)
+}
+
+func TestShutdown(t *testing.T) {
+	s := NewServer()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	Register(s, "wait", func(ctx context.Context, p *msgp.Raw) (*number, error) {
+		close(started)
+		<-release
+		n := number(1)
+		return &n, nil
+	})
+	c, done := serve(t, s)
+
+	errc := make(chan error, 1)
+	var n number
+	go func() { errc <- c.Call(context.Background(), "wait", nil, &n) }()
+	<-started
+	shut := make(chan error, 1)
+	go func() { shut <- s.Shutdown(context.Background()) }()
+
+	// the call in flight finishes before the connection closes
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := <-errc; err != nil || n != 1 {
+		t.Errorf("got %d, %v; wanted 1, nil", n, err)
+	}
+	if err := <-shut; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("ServeConn: got %v; wanted %v", err, ErrServerClosed)
+	}
+
+	// a forced shutdown cancels the calls in flight
+	s = NewServer()
+	Register(s, "wait", func(ctx context.Context, p *msgp.Raw) (*number, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	c, done = serve(t, s)
+	go c.Call(context.Background(), "wait", nil, nil)
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Shutdown(ctx); err != context.Canceled {
+		t.Errorf("got %v; wanted %v", err, context.Canceled)
+	}
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("ServeConn: got %v; wanted %v", err, ErrServerClosed)
+	}
+}
@@ -0,0 +1,238 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// handler runs a method with its encoded params
+type handler func(ctx context.Context, params msgp.Raw) (msgp.Encodable, error)
+
+// Server serves MessagePack-RPC methods.
+// A Server is safe for concurrent use.
+type Server struct {
+	mu       sync.Mutex
+	methods  map[string]handler
+	conns    map[*serverConn]struct{}
+	shutdown bool
+}
+
+// NewServer returns a new Server with no methods.
+func NewServer() *Server {
+	return &Server{
+		methods: make(map[string]handler),
+		conns:   make(map[*serverConn]struct{}),
+	}
+}
+
+// Register registers 'fn' as the method 'name' of 's', replacing
+// any method already registered with the name. The params of each
+// call are decoded into a new P, so P usually holds a tuple. If 'fn'
+// returns an error, the error object sent to the caller is the error
+// itself if it is msgp.Encodable (such as an *Error), or else its message.
+// A nil result, including a nil pointer, is sent as nil. If 'fn' panics,
+// the panic is recovered and the caller gets an error.
+func Register[P any, PP msgp.DecodePtr[P], R msgp.Encodable](s *Server, name string, fn func(ctx context.Context, params PP) (R, error)) {
+	h := func(ctx context.Context, raw msgp.Raw) (msgp.Encodable, error) {
+		params := PP(new(P))
+		if err := msgp.Decode(bytes.NewReader(raw), params); err != nil {
+			return nil, err
+		}
+		return fn(ctx, params)
+	}
+	s.mu.Lock()
+	s.methods[name] = h
+	s.mu.Unlock()
+}
+
+// serverConn is a connection served by a Server
+type serverConn struct {
+	rwc     io.ReadWriteCloser
+	out     *sender
+	calls   sync.WaitGroup
+	closing atomic.Bool
+	cancel  context.CancelFunc
+}
+
+// close closes the connection on purpose
+func (c *serverConn) close() {
+	c.closing.Store(true)
+	c.rwc.Close()
+}
+
+// ServeConn serves the requests and notifications received over 'rwc'
+// until it fails or is closed, or until 'ctx' is done, and then closes it.
+// The contexts passed to methods are derived from 'ctx'. ServeConn waits for
+// the calls in flight to finish before it returns, and it returns nil if
+// the peer closed the connection or 'ctx' is done.
+func (s *Server) ServeConn(ctx context.Context, rwc io.ReadWriteCloser) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := &serverConn{rwc: rwc, out: newSender(rwc), cancel: cancel}
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		rwc.Close()
+		return ErrServerClosed
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	stop := context.AfterFunc(ctx, c.close)
+	defer stop()
+
+	err := s.serve(ctx, c)
+	c.calls.Wait()
+	c.close()
+
+	s.mu.Lock()
+	delete(s.conns, c)
+	shutdown := s.shutdown
+	s.mu.Unlock()
+	switch {
+	case err == io.EOF || c.closing.Load() && !shutdown:
+		return nil
+	case c.closing.Load():
+		return ErrServerClosed
+	}
+	return err
+}
+
+// serve reads messages until the connection fails
+func (s *Server) serve(ctx context.Context, c *serverConn) error {
+	r := msgp.NewReader(c.rwc)
+	for {
+		m := new(message)
+		if err := m.decode(r); err != nil {
+			return err
+		}
+		if m.typ == typeResponse {
+			continue
+		}
+		s.mu.Lock()
+		h, ok := s.methods[m.method]
+		shutdown := s.shutdown
+		if !shutdown {
+			c.calls.Add(1)
+		}
+		s.mu.Unlock()
+		switch {
+		case shutdown:
+			if m.typ == typeRequest {
+				c.respond(m.id, nil, ErrServerClosed)
+			}
+		case !ok:
+			c.calls.Done()
+			if m.typ == typeRequest {
+				c.respond(m.id, nil, errors.New("rpc: method not found: "+m.method))
+			}
+		default:
+			go func() {
+				defer c.calls.Done()
+				res, err := call(ctx, h, m)
+				if m.typ == typeRequest {
+					c.respond(m.id, res, err)
+				}
+			}()
+		}
+	}
+}
+
+// call runs 'h' for 'm', turning a panic into an error
+func call(ctx context.Context, h handler, m *message) (res msgp.Encodable, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			res, err = nil, fmt.Errorf("rpc: method %s panicked: %v", m.method, v)
+		}
+	}()
+	return h(ctx, m.params)
+}
+
+// isNil reports whether 'res' is nil or a nil pointer
+func isNil(res msgp.Encodable) bool {
+	if res == nil {
+		return true
+	}
+	v := reflect.ValueOf(res)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// respond sends the response to request 'id'
+func (c *serverConn) respond(id uint32, res msgp.Encodable, err error) {
+	send := func(res msgp.Encodable, err error) error {
+		return c.out.send(func(w *msgp.Writer) error {
+			if err := w.WriteArrayHeader(4); err != nil {
+				return err
+			}
+			if err := w.WriteInt(typeResponse); err != nil {
+				return err
+			}
+			if err := w.WriteUint32(id); err != nil {
+				return err
+			}
+			var werr error
+			switch e := err.(type) {
+			case nil:
+				werr = w.WriteNil()
+			case msgp.Encodable:
+				werr = e.EncodeMsg(w)
+			default:
+				werr = w.WriteString(err.Error())
+			}
+			if werr != nil {
+				return werr
+			}
+			if err != nil || isNil(res) {
+				return w.WriteNil()
+			}
+			return res.EncodeMsg(w)
+		})
+	}
+	if serr := send(res, err); serr != nil && !c.closing.Load() {
+		// the response couldn't be encoded, so try
+		// to tell the caller why; if that fails too,
+		// the connection is broken
+		send(nil, errors.New("rpc: encoding response: "+serr.Error()))
+	}
+}
+
+// Shutdown shuts down the Server gracefully: it stops dispatching
+// new requests, which get ErrServerClosed in response, waits for the calls
+// in flight to finish, and then closes every connection. If 'ctx'
+// is done first, Shutdown cancels the contexts of the calls in flight,
+// closes the connections, and returns ctx.Err(). ServeConn returns
+// ErrServerClosed for connections closed by Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	conns := make([]*serverConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		for _, c := range conns {
+			c.calls.Wait()
+			c.close()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, c := range conns {
+			c.cancel()
+		}
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,183 @@
+// Package rpccodec implements MessagePack codecs for net/rpc.
+//
+// Each message is a header followed by a body. A request header is
+// the array [ServiceMethod, Seq], and a response header is the array
+// [ServiceMethod, Seq, Error]. Bodies that implement msgp.Encodable and
+// msgp.Decodable are encoded with their generated methods. Other bodies,
+// such as plain structs, are encoded with msgp.MarshalReflect, and
+// decoded with ReadIntf into an *any, or with msgp.UnmarshalReflect
+// otherwise, so the types of an existing service can be used as they are.
+//
+// To switch a net/rpc client or server from gob to MessagePack,
+// use NewClient in place of rpc.NewClient, and ServeConn in place of
+// rpc.ServeConn (or pass the codecs to NewClientWithCodec and ServeCodec).
+package rpccodec
+
+import (
+	"io"
+	"net/rpc"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// codec holds what the client and server codecs have in common
+type codec struct {
+	rwc     io.ReadWriteCloser
+	r       *msgp.Reader
+	w       *msgp.Writer
+	scratch []byte // for bodies encoded with reflection
+}
+
+func newCodec(rwc io.ReadWriteCloser) codec {
+	return codec{rwc: rwc, r: msgp.NewReader(rwc), w: msgp.NewWriter(rwc)}
+}
+
+// writeBody writes 'body' and flushes the message. If the body
+// can't be encoded after the header is written, the connection is
+// closed, because the peer can't make sense of what follows.
+func (c *codec) writeBody(body any) error {
+	var err error
+	switch b := body.(type) {
+	case nil:
+		err = c.w.WriteNil()
+	case msgp.Encodable:
+		err = b.EncodeMsg(c.w)
+	default:
+		c.scratch, err = msgp.MarshalReflect(c.scratch[:0], b)
+		if err == nil {
+			_, err = c.w.Write(c.scratch)
+		} else {
+			err = c.w.WriteIntf(b)
+		}
+	}
+	if err != nil {
+		c.rwc.Close()
+		return err
+	}
+	return c.w.Flush()
+}
+
+// readBody reads the next object into 'body',
+// or skips it if 'body' is nil
+func (c *codec) readBody(body any) error {
+	switch b := body.(type) {
+	case nil:
+		return c.r.Skip()
+	case msgp.Decodable:
+		return b.DecodeMsg(c.r)
+	case *any:
+		var err error
+		*b, err = c.r.ReadIntf()
+		return err
+	default:
+		var raw msgp.Raw
+		if err := raw.DecodeMsg(c.r); err != nil {
+			return err
+		}
+		if len(raw) == 0 {
+			raw = msgp.AppendNil(raw)
+		}
+		_, err := msgp.UnmarshalReflect(raw, b)
+		return err
+	}
+}
+
+func (c *codec) Close() error { return c.rwc.Close() }
+
+type clientCodec struct{ codec }
+
+// NewClientCodec returns a new rpc.ClientCodec
+// that uses MessagePack over 'conn'.
+func NewClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	return &clientCodec{newCodec(conn)}
+}
+
+// NewClient returns a new rpc.Client that
+// uses MessagePack over 'conn'.
+func NewClient(conn io.ReadWriteCloser) *rpc.Client {
+	return rpc.NewClientWithCodec(NewClientCodec(conn))
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, body any) error {
+	if err := c.w.WriteArrayHeader(2); err != nil {
+		return err
+	}
+	if err := c.w.WriteString(r.ServiceMethod); err != nil {
+		return err
+	}
+	if err := c.w.WriteUint64(r.Seq); err != nil {
+		return err
+	}
+	return c.writeBody(body)
+}
+
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	sz, err := c.r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	if sz != 3 {
+		return msgp.ArrayError{Wanted: 3, Got: sz}
+	}
+	if r.ServiceMethod, err = c.r.ReadString(); err != nil {
+		return err
+	}
+	if r.Seq, err = c.r.ReadUint64(); err != nil {
+		return err
+	}
+	r.Error, err = c.r.ReadString()
+	return err
+}
+
+func (c *clientCodec) ReadResponseBody(body any) error { return c.readBody(body) }
+
+type serverCodec struct{ codec }
+
+// NewServerCodec returns a new rpc.ServerCodec
+// that uses MessagePack over 'conn'.
+func NewServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return &serverCodec{newCodec(conn)}
+}
+
+// ServeConn serves the DefaultServer of net/rpc over 'conn',
+// using MessagePack. It blocks until the peer hangs up.
+func ServeConn(conn io.ReadWriteCloser) {
+	rpc.ServeCodec(NewServerCodec(conn))
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	sz, err := c.r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	if sz != 2 {
+		return msgp.ArrayError{Wanted: 2, Got: sz}
+	}
+	if r.ServiceMethod, err = c.r.ReadString(); err != nil {
+		return err
+	}
+	r.Seq, err = c.r.ReadUint64()
+	return err
+}
+
+func (c *serverCodec) ReadRequestBody(body any) error { return c.readBody(body) }
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, body any) error {
+	if err := c.w.WriteArrayHeader(3); err != nil {
+		return err
+	}
+	if err := c.w.WriteString(r.ServiceMethod); err != nil {
+		return err
+	}
+	if err := c.w.WriteUint64(r.Seq); err != nil {
+		return err
+	}
+	if err := c.w.WriteString(r.Error); err != nil {
+		return err
+	}
+	if r.Error != "" {
+		// the body is a placeholder
+		body = nil
+	}
+	return c.writeBody(body)
+}
@@ -0,0 +1,134 @@
+package rpccodec
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"reflect"
+	"testing"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Args has hand-written methods, in place of generated ones
+type Args struct{ A, B int }
+
+func (a *Args) DecodeMsg(r *msgp.Reader) (err error) {
+	sz, err := r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	if sz != 2 {
+		return msgp.ArrayError{Wanted: 2, Got: sz}
+	}
+	if a.A, err = r.ReadInt(); err != nil {
+		return err
+	}
+	a.B, err = r.ReadInt()
+	return err
+}
+
+func (a *Args) EncodeMsg(w *msgp.Writer) error {
+	if err := w.WriteArrayHeader(2); err != nil {
+		return err
+	}
+	if err := w.WriteInt(a.A); err != nil {
+		return err
+	}
+	return w.WriteInt(a.B)
+}
+
+type Arith struct{}
+
+func (Arith) Add(args *Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (Arith) Div(args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func (Arith) Split(args *Args, reply *[]string) error {
+	*reply = []string{"a", "b"}[:args.A]
+	return nil
+}
+
+func (Arith) Pair(args *Args, reply *Args) error {
+	*reply = Args{args.B, args.A}
+	return nil
+}
+
+func (Arith) Echo(args map[string]any, reply *any) error {
+	*reply = args
+	return nil
+}
+
+// PlainArgs and PlainReply don't have generated methods
+type PlainArgs struct {
+	A, B int
+	Note string `msg:"note"`
+}
+
+type PlainReply struct {
+	Product int
+	Notes   []string
+}
+
+func (Arith) Mul(args *PlainArgs, reply *PlainReply) error {
+	*reply = PlainReply{Product: args.A * args.B, Notes: []string{args.Note}}
+	return nil
+}
+
+func TestCodec(t *testing.T) {
+	srv := rpc.NewServer()
+	if err := srv.Register(Arith{}); err != nil {
+		t.Fatal(err)
+	}
+	cli, conn := net.Pipe()
+	go srv.ServeCodec(NewServerCodec(conn))
+	c := NewClient(cli)
+	defer c.Close()
+
+	var n int
+	if err := c.Call("Arith.Add", &Args{2, 3}, &n); err != nil || n != 5 {
+		t.Errorf("Add: got %d, %v", n, err)
+	}
+	err := c.Call("Arith.Div", &Args{1, 0}, &n)
+	if err == nil || err.Error() != "divide by zero" {
+		t.Errorf("Div: got %v", err)
+	}
+	if err := c.Call("Arith.Missing", &Args{}, &n); err == nil {
+		t.Error("no error for a missing method")
+	}
+	var s []string
+	if err := c.Call("Arith.Split", &Args{A: 2}, &s); err != nil || !reflect.DeepEqual(s, []string{"a", "b"}) {
+		t.Errorf("Split: got %q, %v", s, err)
+	}
+	if err := c.Call("Arith.Split", &Args{A: 0}, &s); err != nil || len(s) != 0 {
+		t.Errorf("Split: got %q, %v", s, err)
+	}
+	var p Args
+	if err := c.Call("Arith.Pair", &Args{1, 2}, &p); err != nil || p != (Args{2, 1}) {
+		t.Errorf("Pair: got %v, %v", p, err)
+	}
+
+	var r PlainReply
+	if err := c.Call("Arith.Mul", &PlainArgs{3, 4, "n"}, &r); err != nil || r.Product != 12 || !reflect.DeepEqual(r.Notes, []string{"n"}) {
+		t.Errorf("Mul: got %+v, %v", r, err)
+	}
+
+	// the calls are still in sync after all that
+	in := map[string]any{"x": int64(1), "y": []any{"z"}}
+	var out any
+	if err := c.Call("Arith.Echo", in, &out); err != nil || !reflect.DeepEqual(out, in) {
+		t.Errorf("Echo: got %v, %v", out, err)
+	}
+	if err := c.Call("Arith.Add", &Args{4, 5}, &n); err != nil || n != 9 {
+		t.Errorf("Add: got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,188 @@
+package msgp
+
+import (
+	"io"
+	"iter"
+)
+
+// MaxScanSize is the default maximum size
+// of an object returned by a Scanner.
+const MaxScanSize = 64 << 20
+
+const (
+	startScanSize = 4096
+	// the number of empty reads before
+	// a Scanner gives up, as in bufio
+	maxEmptyReads = 100
+)
+
+// Scanner splits a stream of concatenated MessagePack
+// objects into the raw bytes of each top-level object,
+// in the manner of bufio.Scanner. Objects are found
+// without decoding them, so a Scanner works with any
+// kind of message.
+//
+// Successive calls to Scan step through the objects,
+// and Bytes returns the current one. Scanning stops at
+// the end of the input, or at the first error, which is
+// returned by Err. An object that is larger than the
+// maximum size (MaxScanSize, unless set with Buffer)
+// stops the Scanner with ErrLimitExceeded.
+type Scanner struct {
+	r     io.Reader
+	buf   []byte
+	start int // start of the current object in buf
+	end   int // end of the data in buf
+	max   int
+	tok   []byte
+	err   error
+
+	// progress through the current object:
+	// 'off' bytes have been accounted for,
+	// and 'pending' objects are left to find
+	off     int
+	pending uint64
+	scanned bool
+	eof     bool
+}
+
+// NewScanner returns a new Scanner reading from 'r'.
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: r, max: MaxScanSize, pending: 1}
+}
+
+// Buffer sets the initial buffer used by the Scanner,
+// and the maximum size of an object. Buffer panics
+// if it is called after scanning has started.
+func (s *Scanner) Buffer(buf []byte, max int) {
+	if s.scanned {
+		panic("msgp: Buffer called after Scan")
+	}
+	s.buf = buf[0:cap(buf)]
+	s.max = max
+}
+
+// Bytes returns the raw bytes of the most recent object
+// found by Scan. The slice is only valid until the
+// next call to Scan, which may overwrite it.
+func (s *Scanner) Bytes() []byte { return s.tok }
+
+// Err returns the first error encountered by the
+// Scanner, or nil if it reached the end of the input.
+// An input that ends in the middle of an object
+// results in io.ErrUnexpectedEOF.
+func (s *Scanner) Err() error { return s.err }
+
+// Scan advances the Scanner to the next object,
+// which is then available through Bytes. It returns
+// false when there are no more objects, because of
+// the end of the input or an error.
+func (s *Scanner) Scan() bool {
+	s.scanned = true
+	s.tok = nil
+	if s.err != nil {
+		return false
+	}
+	empty := 0
+	for {
+		need, err := s.walk()
+		if err != nil {
+			s.err = err
+			return false
+		}
+		if s.pending == 0 {
+			s.tok = s.buf[s.start : s.start+s.off]
+			s.start += s.off
+			s.off, s.pending = 0, 1
+			return true
+		}
+		if s.eof {
+			if s.end > s.start {
+				s.err = io.ErrUnexpectedEOF
+			}
+			return false
+		}
+		// every pending object is at least one byte
+		if uint64(need) > uint64(s.max) || uint64(s.off)+s.pending > uint64(s.max) {
+			s.err = ErrLimitExceeded
+			return false
+		}
+		s.fill(need)
+		n, err := s.r.Read(s.buf[s.end:])
+		s.end += n
+		switch {
+		case err == io.EOF:
+			s.eof = true
+		case err != nil:
+			s.err = err
+			return false
+		case n > 0:
+			empty = 0
+		default:
+			if empty++; empty >= maxEmptyReads {
+				s.err = io.ErrNoProgress
+				return false
+			}
+		}
+	}
+}
+
+// walk finds the sizes of as many of the pending objects as
+// possible, and returns the number of bytes needed to make
+// progress if the current object is incomplete
+func (s *Scanner) walk() (need int, err error) {
+	for s.pending > 0 {
+		b := s.buf[s.start+s.off : s.end]
+		sz, objs, err := getSize(b)
+		if err == ErrShortBytes {
+			return len(b) + s.off + 1, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if uint64(sz) > uint64(len(b)) {
+			if uint64(sz) > uint64(s.max) {
+				return 0, ErrLimitExceeded
+			}
+			return s.off + int(sz), nil
+		}
+		s.off += int(sz)
+		s.pending += uint64(objs) - 1
+	}
+	return 0, nil
+}
+
+// fill makes room to read at least one more
+// byte, and enough to hold 'need' bytes of the
+// current object if possible
+func (s *Scanner) fill(need int) {
+	if s.start > 0 && (s.end == len(s.buf) || need > len(s.buf)-s.start) {
+		s.end = copy(s.buf, s.buf[s.start:s.end])
+		s.start = 0
+	}
+	if s.end < len(s.buf) && need <= len(s.buf) {
+		return
+	}
+	size := max(2*len(s.buf), need, startScanSize)
+	size = max(min(size, s.max), s.end+1)
+	buf := make([]byte, size)
+	s.end = copy(buf, s.buf[s.start:s.end])
+	s.start = 0
+	s.buf = buf
+}
+
+// All returns an iterator over the remaining
+// objects. If scanning stops because of an
+// error, the last pair holds the error.
+func (s *Scanner) All() iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		for s.Scan() {
+			if !yield(s.Bytes(), nil) {
+				return
+			}
+		}
+		if err := s.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestScanner(t *testing.T) {
+	var (
+		raw  []byte
+		want [][]byte
+	)
+	for _, v := range []any{
+		nil,
+		"hello",
+		map[string]any{"a": []any{1, 2.5, "x"}, "b": map[string]any{}},
+		bytes.Repeat([]byte{1}, 10000),
+		[]any{[]any{[]any{}}, int64(-1 << 40)},
+		uint8(7),
+	} {
+		start := len(raw)
+		var err error
+		raw, err = AppendIntf(raw, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, raw[start:])
+	}
+
+	readers := map[string]func() io.Reader{
+		"whole":    func() io.Reader { return bytes.NewReader(raw) },
+		"one byte": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(raw)) },
+		"data err": func() io.Reader { return iotest.DataErrReader(bytes.NewReader(raw)) },
+	}
+	for name, r := range readers {
+		t.Run(name, func(t *testing.T) {
+			s := NewScanner(r())
+			s.Buffer(make([]byte, 16), MaxScanSize)
+			var i int
+			for s.Scan() {
+				if i >= len(want) {
+					t.Fatalf("got too many objects")
+				}
+				if !bytes.Equal(s.Bytes(), want[i]) {
+					t.Errorf("object %d: got %x; wanted %x", i, s.Bytes(), want[i])
+				}
+				i++
+			}
+			if err := s.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if i != len(want) {
+				t.Errorf("got %d objects; wanted %d", i, len(want))
+			}
+		})
+	}
+
+	// All stops when the loop does
+	var n int
+	for b, err := range NewScanner(bytes.NewReader(raw)).All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, want[n]) {
+			t.Errorf("object %d: got %x; wanted %x", n, b, want[n])
+		}
+		if n++; n == 2 {
+			break
+		}
+	}
+	if n != 2 {
+		t.Errorf("got %d objects", n)
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		max  int
+		want error
+	}{
+		{"truncated", []byte{0x01, 0x92, 0x01}, MaxScanSize, io.ErrUnexpectedEOF},
+		{"truncated header", []byte{0x01, 0xdc, 0x00}, MaxScanSize, io.ErrUnexpectedEOF},
+		{"invalid", []byte{0x01, 0xc1}, MaxScanSize, InvalidPrefixError(0xc1)},
+		{"too large", append([]byte{0x01}, AppendBytes(nil, make([]byte, 100))...), 64, ErrLimitExceeded},
+		{"too many elements", []byte{0x01, 0xdd, 0xff, 0xff, 0xff, 0xff}, 1 << 20, ErrLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScanner(bytes.NewReader(tt.raw))
+			s.Buffer(nil, tt.max)
+			if !s.Scan() || !bytes.Equal(s.Bytes(), []byte{0x01}) {
+				t.Fatalf("didn't get the first object: %v", s.Err())
+			}
+			if s.Scan() {
+				t.Fatalf("got object %x", s.Bytes())
+			}
+			if !errors.Is(s.Err(), tt.want) {
+				t.Errorf("got %v; wanted %v", s.Err(), tt.want)
+			}
+			var got error
+			for _, err := range s.All() {
+				got = err
+			}
+			if got != s.Err() {
+				t.Errorf("All: got %v; wanted %v", got, s.Err())
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// Package slogmsgp provides a log/slog Handler that
+// writes records as MessagePack maps.
+package slogmsgp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Handler is a slog.Handler that writes each record to an
+// io.Writer as a MessagePack map, with a single call to Write.
+//
+// The keys of the map are those of slog.JSONHandler: "time", holding
+// a timestamp extension; "level", holding the name of the level; "msg";
+// "source", if requested; and then the attributes. Groups are nested
+// maps, and empty groups are omitted. Values that implement msgp.Marshaler
+// are appended with MarshalMsg, errors are written as their message, and
+// other values are written with msgp.MarshalReflect, or as text with
+// fmt.Sprint if they aren't supported.
+//
+// A Handler is safe for concurrent use, and so are the Handlers
+// derived from it with WithAttrs and WithGroup, which share its writer.
+type Handler struct {
+	opts   slog.HandlerOptions
+	groups []string // from WithGroup
+	pre    []byte   // attributes from WithAttrs
+	open   []int    // offsets in pre of the headers of the groups in it
+	mu     *sync.Mutex
+	w      io.Writer
+}
+
+// NewHandler returns a Handler that writes to 'w', using
+// the given options. A nil 'opts' uses the default options.
+func NewHandler(w io.Writer, opts *slog.HandlerOptions) *Handler {
+	h := &Handler{mu: new(sync.Mutex), w: w}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+// Enabled reports whether 'level' is at least the minimum level.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// WithAttrs returns a Handler whose records include 'attrs'.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := h.clone()
+	s := state{h: h2, buf: h2.pre, open: h2.open}
+	for _, a := range attrs {
+		s.appendAttr(a)
+	}
+	h2.pre, h2.open = s.buf, s.open
+	return h2
+}
+
+// WithGroup returns a Handler that puts the attributes
+// that follow in the group 'name'.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := h.clone()
+	h2.groups = append(h2.groups, name)
+	return h2
+}
+
+func (h *Handler) clone() *Handler {
+	h2 := *h
+	h2.groups = slices.Clip(h.groups)
+	h2.pre = slices.Clip(h.pre)
+	h2.open = slices.Clip(h.open)
+	return &h2
+}
+
+var bufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+// Handle writes 'r' as a MessagePack map.
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	p := bufPool.Get().(*[]byte)
+	buf, top := msgp.AppendBeginMap((*p)[:0])
+	s := state{h: h, buf: buf}
+	if !r.Time.IsZero() {
+		s.appendBuiltin(slog.Time(slog.TimeKey, r.Time))
+	}
+	s.appendBuiltin(slog.Any(slog.LevelKey, r.Level))
+	if h.opts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		s.appendBuiltin(slog.Any(slog.SourceKey, &slog.Source{
+			Function: frame.Function,
+			File:     frame.File,
+			Line:     frame.Line,
+		}))
+	}
+	s.appendBuiltin(slog.String(slog.MessageKey, r.Message))
+
+	// the groups already open in pre are
+	// opened again at their new offsets
+	base := len(s.buf)
+	s.buf = append(s.buf, h.pre...)
+	for _, off := range h.open {
+		s.open = append(s.open, base+off)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		s.appendAttr(a)
+		return true
+	})
+	for i := len(s.open) - 1; i >= 0; i-- {
+		s.buf, _ = msgp.AppendEnd(s.buf, s.open[i])
+	}
+	s.buf, _ = msgp.AppendEnd(s.buf, top)
+
+	h.mu.Lock()
+	_, err := h.w.Write(s.buf)
+	h.mu.Unlock()
+	// don't keep very large buffers around
+	if cap(s.buf) <= 64<<10 {
+		*p = s.buf
+		bufPool.Put(p)
+	}
+	return err
+}
+
+// state is the state of appending attributes
+type state struct {
+	h    *Handler
+	buf  []byte
+	open []int    // offsets of the headers of the open groups of h
+	sub  []string // groups within attributes
+}
+
+// appendBuiltin appends one of the attributes
+// that come before those of the record
+func (s *state) appendBuiltin(a slog.Attr) {
+	if rep := s.h.opts.ReplaceAttr; rep != nil {
+		a = rep(nil, a)
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) {
+			return
+		}
+	}
+	s.buf = msgp.AppendString(s.buf, a.Key)
+	s.buf = appendValue(s.buf, a.Value)
+}
+
+// openGroups opens the groups of h that aren't open yet
+func (s *state) openGroups() {
+	for _, g := range s.h.groups[len(s.open):] {
+		var off int
+		s.buf = msgp.AppendString(s.buf, g)
+		s.buf, off = msgp.AppendBeginMap(s.buf)
+		s.open = append(s.open, off)
+	}
+}
+
+func (s *state) appendAttr(a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if rep := s.h.opts.ReplaceAttr; rep != nil && a.Value.Kind() != slog.KindGroup {
+		var groups []string
+		if len(s.h.groups)+len(s.sub) > 0 {
+			groups = append(slices.Clip(s.h.groups), s.sub...)
+		}
+		a = rep(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() != slog.KindGroup {
+		s.openGroups()
+		s.buf = msgp.AppendString(s.buf, a.Key)
+		s.buf = appendValue(s.buf, a.Value)
+		return
+	}
+	attrs := a.Value.Group()
+	if len(attrs) == 0 {
+		return
+	}
+	if a.Key == "" {
+		// inline the group
+		for _, a := range attrs {
+			s.appendAttr(a)
+		}
+		return
+	}
+	s.openGroups()
+	s.buf = msgp.AppendString(s.buf, a.Key)
+	var off int
+	s.buf, off = msgp.AppendBeginMap(s.buf)
+	s.sub = append(s.sub, a.Key)
+	for _, a := range attrs {
+		s.appendAttr(a)
+	}
+	s.sub = s.sub[:len(s.sub)-1]
+	s.buf, _ = msgp.AppendEnd(s.buf, off)
+}
+
+func appendValue(b []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindString:
+		return msgp.AppendString(b, v.String())
+	case slog.KindInt64:
+		return msgp.AppendInt64(b, v.Int64())
+	case slog.KindUint64:
+		return msgp.AppendUint64(b, v.Uint64())
+	case slog.KindFloat64:
+		return msgp.AppendFloat64(b, v.Float64())
+	case slog.KindBool:
+		return msgp.AppendBool(b, v.Bool())
+	case slog.KindDuration:
+		return msgp.AppendDuration(b, v.Duration())
+	case slog.KindTime:
+		return msgp.AppendTimeExt(b, v.Time())
+	}
+	switch x := v.Any().(type) {
+	case nil:
+		return msgp.AppendNil(b)
+	case slog.Level:
+		return msgp.AppendString(b, x.String())
+	case *slog.Source:
+		b = msgp.AppendMapHeader(b, 3)
+		b = msgp.AppendString(b, "function")
+		b = msgp.AppendString(b, x.Function)
+		b = msgp.AppendString(b, "file")
+		b = msgp.AppendString(b, x.File)
+		b = msgp.AppendString(b, "line")
+		return msgp.AppendInt(b, x.Line)
+	case msgp.Marshaler:
+		if o, err := x.MarshalMsg(b); err == nil {
+			return o
+		}
+	case error:
+		return msgp.AppendString(b, x.Error())
+	default:
+		if o, err := msgp.MarshalReflect(b, x); err == nil {
+			return o
+		}
+	}
+	return msgp.AppendString(b, fmt.Sprint(v.Any()))
+}
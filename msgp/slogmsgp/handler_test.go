@@ -0,0 +1,132 @@
+package slogmsgp
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"testing/slogtest"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// parse splits the output into records
+func parse(t *testing.T, b []byte) []map[string]any {
+	t.Helper()
+	var ms []map[string]any
+	for len(b) > 0 {
+		v, rest, err := msgp.ReadIntfBytes(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, ok := v.(map[string]any)
+		if !ok {
+			t.Fatalf("record is a %T", v)
+		}
+		ms = append(ms, m)
+		b = rest
+	}
+	return ms
+}
+
+func TestSlogtest(t *testing.T) {
+	var buf bytes.Buffer
+	slogtest.Run(t, func(t *testing.T) slog.Handler {
+		buf.Reset()
+		return NewHandler(&buf, nil)
+	}, func(t *testing.T) map[string]any {
+		ms := parse(t, buf.Bytes())
+		if len(ms) != 1 {
+			t.Fatalf("got %d records", len(ms))
+		}
+		return ms[0]
+	})
+}
+
+// point has hand-written methods, in place of generated ones
+type point struct{ X, Y int }
+
+func (p point) MarshalMsg(b []byte) ([]byte, error) {
+	b = msgp.AppendArrayHeader(b, 2)
+	b = msgp.AppendInt(b, p.X)
+	return msgp.AppendInt(b, p.Y), nil
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "secret" && slices.Equal(groups, []string{"req", "empty", "user"}) {
+				return slog.String("secret", "xxx")
+			}
+			return a
+		},
+	})
+	when := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	l := slog.New(h).With("app", "test").WithGroup("req").With("id", 7).WithGroup("empty")
+	r := slog.NewRecord(when, slog.LevelDebug, "hi", 0)
+	r.AddAttrs(
+		slog.Any("pt", point{1, 2}),
+		slog.Any("err", errors.New("oops")),
+		slog.Duration("took", time.Second),
+		slog.Group("user", slog.String("secret", "hunter2")),
+	)
+	if err := l.Handler().Handle(t.Context(), r); err != nil {
+		t.Fatal(err)
+	}
+	// a record with no attributes leaves the groups empty
+	l.Info("bye")
+
+	ms := parse(t, buf.Bytes())
+	if len(ms) != 2 {
+		t.Fatalf("got %d records", len(ms))
+	}
+	m := ms[0]
+	if tm, ok := m["time"].(time.Time); !ok || !tm.Equal(when) {
+		t.Errorf("time: got %v", m["time"])
+	}
+	if m["level"] != "DEBUG" || m["msg"] != "hi" || m["app"] != "test" {
+		t.Errorf("got %v", m)
+	}
+	req := m["req"].(map[string]any)
+	if req["id"] != int64(7) {
+		t.Errorf("req: got %v", req)
+	}
+	got := req["empty"].(map[string]any)
+	if pt := got["pt"].([]any); pt[0] != int64(1) || pt[1] != int64(2) {
+		t.Errorf("pt: got %v", pt)
+	}
+	if got["err"] != "oops" || got["took"] != int64(time.Second) {
+		t.Errorf("got %v", got)
+	}
+	if user := got["user"].(map[string]any); user["secret"] != "xxx" {
+		t.Errorf("user: got %v", user)
+	}
+	if req := ms[1]["req"].(map[string]any); len(req) != 1 {
+		t.Errorf("req: got %v", req)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, nil))
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := l.With("g", i)
+			for range 50 {
+				l.Info("msg", "s", bytes.Repeat([]byte{'x'}, i*100))
+			}
+		}()
+	}
+	wg.Wait()
+	if ms := parse(t, buf.Bytes()); len(ms) != 1000 {
+		t.Errorf("got %d records", len(ms))
+	}
+}
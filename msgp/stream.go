@@ -0,0 +1,85 @@
+package msgp
+
+import (
+	"bytes"
+	"io"
+	"iter"
+	"runtime"
+)
+
+// DecodeStream returns an iterator over the objects in a stream of
+// concatenated MessagePack objects, which are unmarshaled in parallel.
+// A Scanner splits the stream into objects, and a pool of 'workers'
+// goroutines (GOMAXPROCS, if 'workers' is 0 or less) unmarshals each
+// of them into a new T, returned by 'newT'. The objects are yielded
+// in the order of the stream.
+//
+// An object that fails to unmarshal is yielded with the error, and
+// iteration continues. An error from the Scanner (such as
+// io.ErrUnexpectedEOF for a truncated stream) ends the iteration,
+// after the objects before it, with a zero T.
+//
+// If the loop stops early, the goroutines stop too, but a read from 'r'
+// that is in progress has to return first; 'r' isn't read any more.
+func DecodeStream[T Unmarshaler](r io.Reader, workers int, newT func() T) iter.Seq2[T, error] {
+	type result struct {
+		v   T
+		err error
+	}
+	type job struct {
+		raw  []byte
+		done chan result
+	}
+	return func(yield func(T, error) bool) {
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		// objects are queued for the workers and, in order, for
+		// the loop; the loop waits for each one to be unmarshaled
+		var (
+			jobs    = make(chan *job, workers)
+			order   = make(chan *job, 2*workers)
+			stop    = make(chan struct{})
+			scanErr error
+		)
+		defer close(stop)
+		go func() {
+			defer close(order)
+			defer close(jobs)
+			s := NewScanner(r)
+			for s.Scan() {
+				j := &job{raw: bytes.Clone(s.Bytes()), done: make(chan result, 1)}
+				select {
+				case order <- j:
+				case <-stop:
+					return
+				}
+				select {
+				case jobs <- j:
+				case <-stop:
+					return
+				}
+			}
+			scanErr = s.Err()
+		}()
+		for range workers {
+			go func() {
+				for j := range jobs {
+					v := newT()
+					_, err := v.UnmarshalMsg(j.raw)
+					j.done <- result{v: v, err: err}
+				}
+			}()
+		}
+		for j := range order {
+			res := <-j.done
+			if !yield(res.v, res.err) {
+				return
+			}
+		}
+		if scanErr != nil {
+			var zero T
+			yield(zero, scanErr)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// streamItem unmarshals an int
+type streamItem struct{ n int }
+
+func (s *streamItem) UnmarshalMsg(b []byte) ([]byte, error) {
+	var err error
+	s.n, b, err = ReadIntBytes(b)
+	return b, err
+}
+
+func TestDecodeStream(t *testing.T) {
+	var raw []byte
+	for i := range 10000 {
+		if i == 5000 {
+			raw = AppendString(raw, "not an int")
+			continue
+		}
+		raw = AppendInt(raw, i)
+	}
+	newItem := func() *streamItem { return new(streamItem) }
+
+	for _, workers := range []int{0, 1, 7} {
+		var i int
+		for v, err := range DecodeStream(bytes.NewReader(raw), workers, newItem) {
+			if i == 5000 {
+				var terr TypeError
+				if !errors.As(err, &terr) {
+					t.Fatalf("got %v; wanted a TypeError", err)
+				}
+			} else if err != nil || v.n != i {
+				t.Fatalf("object %d: got %d, %v", i, v.n, err)
+			}
+			i++
+		}
+		if i != 10000 {
+			t.Errorf("%d workers: got %d objects", workers, i)
+		}
+	}
+
+	// the loop can stop early
+	var n int
+	for range DecodeStream(bytes.NewReader(raw), 4, newItem) {
+		if n++; n == 10 {
+			break
+		}
+	}
+	if n != 10 {
+		t.Errorf("got %d objects", n)
+	}
+
+	// a truncated stream ends with an error
+	var last error
+	n = 0
+	for _, err := range DecodeStream(bytes.NewReader([]byte{0x01, 0x02, 0x92, 0x01}), 2, newItem) {
+		n++
+		last = err
+	}
+	if n != 3 || last != io.ErrUnexpectedEOF {
+		t.Errorf("got %d objects, ending with %v", n, last)
+	}
+}
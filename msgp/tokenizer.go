@@ -0,0 +1,418 @@
+package msgp
+
+import (
+	"io"
+	"time"
+)
+
+// TokenKind is the kind of a Token.
+type TokenKind uint8
+
+const (
+	InvalidToken TokenKind = iota
+
+	MapStartToken   // start of a map; Len is the number of entries
+	MapEndToken     // end of a map
+	ArrayStartToken // start of an array; Len is the number of elements
+	ArrayEndToken   // end of an array
+	KeyToken        // a 'str' or 'bin' map key in Bytes
+	StrToken        // a 'str' in Bytes
+	BinToken        // a 'bin' in Bytes
+	IntToken        // a signed integer in Int
+	UintToken       // an unsigned integer in Uint
+	FloatToken      // a float32 or float64 in Float
+	BoolToken       // a bool in Bool
+	NilToken        // nil
+	ExtToken        // an extension with type ExtType and data in Bytes
+	TimeToken       // a timestamp extension in Time
+)
+
+// String implements fmt.Stringer
+func (k TokenKind) String() string {
+	switch k {
+	case MapStartToken:
+		return "map start"
+	case MapEndToken:
+		return "map end"
+	case ArrayStartToken:
+		return "array start"
+	case ArrayEndToken:
+		return "array end"
+	case KeyToken:
+		return "key"
+	case StrToken:
+		return "str"
+	case BinToken:
+		return "bin"
+	case IntToken:
+		return "int"
+	case UintToken:
+		return "uint"
+	case FloatToken:
+		return "float"
+	case BoolToken:
+		return "bool"
+	case NilToken:
+		return "nil"
+	case ExtToken:
+		return "ext"
+	case TimeToken:
+		return "time"
+	default:
+		return "<invalid>"
+	}
+}
+
+// Token is a single element of a MessagePack
+// stream. Only the value field that corresponds
+// to Kind is set.
+type Token struct {
+	Kind   TokenKind
+	Depth  int   // number of enclosing maps and arrays
+	Offset int64 // position of the encoded token in the input
+
+	// Len is the number of entries in a map, the number
+	// of elements in an array, or the length of Bytes.
+	Len uint32
+
+	// Bytes holds the contents of keys, strings,
+	// binary and extensions. It is only valid
+	// until the next call to the Tokenizer.
+	Bytes []byte
+
+	Int     int64
+	Uint    uint64
+	Float   float64
+	Float32 bool // Float was encoded as a float32
+	Bool    bool
+	ExtType int8
+	Time    time.Time
+}
+
+// Tokenizer splits MessagePack into a flat sequence
+// of tokens, so that generic tools can process
+// objects without decoding them into Go values.
+//
+// Maps produce a MapStartToken, then alternating keys and
+// values, and then a MapEndToken. Keys that are 'str' or 'bin'
+// produce a KeyToken; other keys produce the same tokens that
+// they would as values. Arrays are bracketed by ArrayStartToken
+// and ArrayEndToken in the same way.
+//
+// Timestamp extensions are returned as TimeTokens.
+// All other extensions are returned as ExtTokens.
+type Tokenizer struct {
+	r       *Reader
+	b       []byte
+	size    int64 // original length of 'b'
+	stack   []tokenFrame
+	scratch []byte
+	err     error
+}
+
+// tokenFrame is an open map or array
+type tokenFrame struct {
+	isMap bool
+	left  uint64 // number of keys and values left
+}
+
+// NewTokenizer returns a Tokenizer that reads from 'r'.
+// The limits set on 'r' are respected, and token
+// offsets are relative to the start of its input.
+func NewTokenizer(r *Reader) *Tokenizer {
+	return &Tokenizer{r: r}
+}
+
+// NewBytesTokenizer returns a Tokenizer that
+// reads from 'b' without copying it.
+func NewBytesTokenizer(b []byte) *Tokenizer {
+	return &Tokenizer{b: b, size: int64(len(b))}
+}
+
+// Reset discards the state of the Tokenizer
+// and makes it read from 'b' instead.
+func (t *Tokenizer) Reset(b []byte) {
+	*t = Tokenizer{b: b, size: int64(len(b)), stack: t.stack[:0], scratch: t.scratch}
+}
+
+// Depth returns the number of maps and
+// arrays that are currently open.
+func (t *Tokenizer) Depth() int { return len(t.stack) }
+
+// Remaining returns the unread part of the
+// input of a Tokenizer created by NewBytesTokenizer.
+func (t *Tokenizer) Remaining() []byte { return t.b }
+
+func (t *Tokenizer) offset() int64 {
+	if t.r != nil {
+		return t.r.R.InputOffset()
+	}
+	return t.size - int64(len(t.b))
+}
+
+func (t *Tokenizer) maxDepth() int {
+	if t.r != nil {
+		return t.r.GetMaxRecursionDepth()
+	}
+	return recursionLimit
+}
+
+// fail makes 'err' sticky.
+// Running out of input in the middle
+// of an object is never io.EOF.
+func (t *Tokenizer) fail(err error) error {
+	if err == io.EOF && len(t.stack) > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	t.err = err
+	return err
+}
+
+// next advances the innermost frame,
+// returning whether the next value is a key
+// and whether the frame has ended
+func (t *Tokenizer) next() (isKey, end bool) {
+	if len(t.stack) == 0 {
+		return false, false
+	}
+	f := &t.stack[len(t.stack)-1]
+	if f.left == 0 {
+		return false, true
+	}
+	isKey = f.isMap && f.left%2 == 0
+	f.left--
+	return isKey, false
+}
+
+// Next returns the next token.
+// At the end of the input, Next returns io.EOF.
+// Errors are sticky.
+func (t *Tokenizer) Next() (tok Token, err error) {
+	if t.err != nil {
+		return tok, t.err
+	}
+	tok.Depth = len(t.stack)
+	tok.Offset = t.offset()
+	isKey, end := t.next()
+	if end {
+		tok.Depth--
+		tok.Kind = ArrayEndToken
+		if t.stack[tok.Depth].isMap {
+			tok.Kind = MapEndToken
+		}
+		t.stack = t.stack[:tok.Depth]
+		return tok, nil
+	}
+	if t.r != nil {
+		err = t.readNext(&tok, isKey)
+	} else {
+		err = t.readNextBytes(&tok, isKey)
+	}
+	if err != nil {
+		return Token{}, t.fail(err)
+	}
+	switch tok.Kind {
+	case MapStartToken, ArrayStartToken:
+		if tok.Depth >= t.maxDepth() {
+			return Token{}, t.fail(ErrRecursion)
+		}
+		f := tokenFrame{isMap: tok.Kind == MapStartToken, left: uint64(tok.Len)}
+		if f.isMap {
+			f.left *= 2
+		}
+		t.stack = append(t.stack, f)
+	}
+	return tok, nil
+}
+
+func (t *Tokenizer) readNext(tok *Token, isKey bool) (err error) {
+	m := t.r
+	if err = m.skipPayload(); err != nil {
+		return err
+	}
+	lead, err := m.R.PeekByte()
+	if err != nil {
+		return err
+	}
+	switch getType(lead) {
+	case MapType:
+		tok.Kind = MapStartToken
+		tok.Len, err = m.ReadMapHeader()
+	case ArrayType:
+		tok.Kind = ArrayStartToken
+		tok.Len, err = m.ReadArrayHeader()
+	case StrType:
+		tok.Kind = StrToken
+		t.scratch, err = m.ReadStringAsBytes(t.scratch[:0])
+		tok.Bytes = t.scratch
+	case BinType:
+		tok.Kind = BinToken
+		t.scratch, err = m.ReadBytes(t.scratch[:0])
+		tok.Bytes = t.scratch
+	case IntType:
+		tok.Kind = IntToken
+		tok.Int, err = m.ReadInt64()
+	case UintType:
+		tok.Kind = UintToken
+		tok.Uint, err = m.ReadUint64()
+	case Float32Type:
+		var f float32
+		f, err = m.ReadFloat32()
+		tok.Kind, tok.Float, tok.Float32 = FloatToken, float64(f), true
+	case Float64Type:
+		tok.Kind = FloatToken
+		tok.Float, err = m.ReadFloat64()
+	case BoolType:
+		tok.Kind = BoolToken
+		tok.Bool, err = m.ReadBool()
+	case NilType:
+		tok.Kind = NilToken
+		err = m.ReadNil()
+	case ExtensionType:
+		var typ int8
+		typ, err = m.peekExtensionType()
+		if err != nil {
+			return err
+		}
+		if typ == TimeExtension || typ == MsgTimeExtension {
+			tok.Kind = TimeToken
+			tok.Time, err = m.ReadTime()
+			return err
+		}
+		tok.Kind = ExtToken
+		tok.ExtType, tok.Bytes, err = m.ReadExtensionRaw()
+	default:
+		return InvalidPrefixError(lead)
+	}
+	t.finish(tok, isKey)
+	return err
+}
+
+func (t *Tokenizer) readNextBytes(tok *Token, isKey bool) (err error) {
+	if len(t.b) == 0 {
+		if len(t.stack) == 0 {
+			return io.EOF
+		}
+		return ErrShortBytes
+	}
+	var o []byte
+	switch getType(t.b[0]) {
+	case MapType:
+		tok.Kind = MapStartToken
+		tok.Len, o, err = ReadMapHeaderBytes(t.b)
+	case ArrayType:
+		tok.Kind = ArrayStartToken
+		tok.Len, o, err = ReadArrayHeaderBytes(t.b)
+	case StrType:
+		tok.Kind = StrToken
+		tok.Bytes, o, err = ReadStringZC(t.b)
+	case BinType:
+		tok.Kind = BinToken
+		tok.Bytes, o, err = ReadBytesZC(t.b)
+	case IntType:
+		tok.Kind = IntToken
+		tok.Int, o, err = ReadInt64Bytes(t.b)
+	case UintType:
+		tok.Kind = UintToken
+		tok.Uint, o, err = ReadUint64Bytes(t.b)
+	case Float32Type:
+		var f float32
+		f, o, err = ReadFloat32Bytes(t.b)
+		tok.Kind, tok.Float, tok.Float32 = FloatToken, float64(f), true
+	case Float64Type:
+		tok.Kind = FloatToken
+		tok.Float, o, err = ReadFloat64Bytes(t.b)
+	case BoolType:
+		tok.Kind = BoolToken
+		tok.Bool, o, err = ReadBoolBytes(t.b)
+	case NilType:
+		tok.Kind = NilToken
+		o, err = ReadNilBytes(t.b)
+	case ExtensionType:
+		var typ int8
+		typ, err = peekExtension(t.b)
+		if err != nil {
+			return err
+		}
+		if typ == TimeExtension || typ == MsgTimeExtension {
+			tok.Kind = TimeToken
+			tok.Time, o, err = ReadTimeBytes(t.b)
+		} else {
+			tok.Kind = ExtToken
+			tok.ExtType, o, tok.Bytes, err = readExt(t.b)
+		}
+	default:
+		return InvalidPrefixError(t.b[0])
+	}
+	if err != nil {
+		return err
+	}
+	t.b = o
+	t.finish(tok, isKey)
+	return nil
+}
+
+func (t *Tokenizer) finish(tok *Token, isKey bool) {
+	switch tok.Kind {
+	case StrToken, BinToken, ExtToken:
+		tok.Len = uint32(len(tok.Bytes))
+		if isKey && tok.Kind != ExtToken {
+			tok.Kind = KeyToken
+		}
+	}
+}
+
+// skipValue skips one complete object
+func (t *Tokenizer) skipValue() error {
+	if t.r != nil {
+		return t.r.Skip()
+	}
+	if len(t.b) == 0 && len(t.stack) == 0 {
+		return io.EOF
+	}
+	o, err := Skip(t.b)
+	if err != nil {
+		return err
+	}
+	t.b = o
+	return nil
+}
+
+// Skip discards the next token. If the token would
+// start a map or array, the whole map or array is skipped.
+func (t *Tokenizer) Skip() error {
+	if t.err != nil {
+		return t.err
+	}
+	_, end := t.next()
+	if end {
+		t.stack = t.stack[:len(t.stack)-1]
+		return nil
+	}
+	if err := t.skipValue(); err != nil {
+		return t.fail(err)
+	}
+	return nil
+}
+
+// SkipContainer discards the rest of the innermost
+// open map or array, including its end token.
+// It does nothing if no map or array is open.
+func (t *Tokenizer) SkipContainer() error {
+	if t.err != nil {
+		return t.err
+	}
+	if len(t.stack) == 0 {
+		return nil
+	}
+	for {
+		if _, end := t.next(); end {
+			break
+		}
+		if err := t.skipValue(); err != nil {
+			return t.fail(err)
+		}
+	}
+	t.stack = t.stack[:len(t.stack)-1]
+	return nil
+}
@@ -0,0 +1,227 @@
+package msgp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func tokenizers(raw []byte) map[string]*Tokenizer {
+	return map[string]*Tokenizer{
+		"bytes":  NewBytesTokenizer(raw),
+		"reader": NewTokenizer(NewReader(bytes.NewReader(raw))),
+	}
+}
+
+func TestTokenizer(t *testing.T) {
+	now := time.Unix(1700000000, 5).Local()
+	raw := AppendMapHeader(nil, 3)
+	raw = AppendString(raw, "a")
+	raw = AppendArrayHeader(raw, 4)
+	raw = AppendInt(raw, -1)
+	raw = AppendUint(raw, 300)
+	raw = AppendFloat32(raw, 1.5)
+	raw = AppendNil(raw)
+	raw = AppendInt(raw, 7) // non-str key
+	raw = AppendBytes(raw, []byte{1, 2})
+	raw = AppendString(raw, "t")
+	raw = AppendTime(raw, now)
+	raw, err := AppendExtension(raw, &RawExtension{Type: 9, Data: []byte("ext")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw = AppendBool(raw, true)
+
+	want := []Token{
+		{Kind: MapStartToken, Len: 3, Offset: 0},
+		{Kind: KeyToken, Depth: 1, Len: 1, Bytes: []byte("a"), Offset: 1},
+		{Kind: ArrayStartToken, Depth: 1, Len: 4, Offset: 3},
+		{Kind: IntToken, Depth: 2, Int: -1, Offset: 4},
+		{Kind: UintToken, Depth: 2, Uint: 300, Offset: 5},
+		{Kind: FloatToken, Depth: 2, Float: 1.5, Float32: true, Offset: 8},
+		{Kind: NilToken, Depth: 2, Offset: 13},
+		{Kind: ArrayEndToken, Depth: 1, Offset: 14},
+		{Kind: IntToken, Depth: 1, Int: 7, Offset: 14},
+		{Kind: BinToken, Depth: 1, Len: 2, Bytes: []byte{1, 2}, Offset: 15},
+		{Kind: KeyToken, Depth: 1, Len: 1, Bytes: []byte("t"), Offset: 19},
+		{Kind: TimeToken, Depth: 1, Time: now, Offset: 21},
+		{Kind: MapEndToken, Offset: 36},
+		{Kind: ExtToken, ExtType: 9, Len: 3, Bytes: []byte("ext"), Offset: 36},
+		{Kind: BoolToken, Bool: true, Offset: 42},
+	}
+	for name, tk := range tokenizers(raw) {
+		t.Run(name, func(t *testing.T) {
+			for i, w := range want {
+				got, err := tk.Next()
+				if err != nil {
+					t.Fatalf("token %d: %v", i, err)
+				}
+				if got.Kind != w.Kind || got.Depth != w.Depth || got.Offset != w.Offset ||
+					got.Len != w.Len || !bytes.Equal(got.Bytes, w.Bytes) ||
+					got.Int != w.Int || got.Uint != w.Uint || got.Float != w.Float ||
+					got.Float32 != w.Float32 || got.Bool != w.Bool ||
+					got.ExtType != w.ExtType || !got.Time.Equal(w.Time) {
+					t.Errorf("token %d: got %+v; wanted %+v", i, got, w)
+				}
+			}
+			if _, err := tk.Next(); err != io.EOF {
+				t.Errorf("got %v at end; wanted io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestTokenizerSkip(t *testing.T) {
+	// [{"x": [1, 2]}, 3, [4, 5, 6], 7]
+	raw := AppendArrayHeader(nil, 4)
+	raw = AppendMapHeader(raw, 1)
+	raw = AppendString(raw, "x")
+	raw = AppendArrayHeader(raw, 2)
+	raw = AppendInt(AppendInt(raw, 1), 2)
+	raw = AppendInt(raw, 3)
+	raw = AppendArrayHeader(raw, 3)
+	raw = AppendInt(AppendInt(AppendInt(raw, 4), 5), 6)
+	raw = AppendInt(raw, 7)
+
+	for name, tk := range tokenizers(raw) {
+		t.Run(name, func(t *testing.T) {
+			next := func(kind TokenKind) Token {
+				t.Helper()
+				tok, err := tk.Next()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tok.Kind != kind {
+					t.Fatalf("got %s; wanted %s", tok.Kind, kind)
+				}
+				return tok
+			}
+			next(ArrayStartToken)
+			if err := tk.Skip(); err != nil { // the whole map
+				t.Fatal(err)
+			}
+			if tok := next(IntToken); tok.Int != 3 {
+				t.Errorf("got %d; wanted 3", tok.Int)
+			}
+			next(ArrayStartToken)
+			next(IntToken)
+			if err := tk.SkipContainer(); err != nil {
+				t.Fatal(err)
+			}
+			if tk.Depth() != 1 {
+				t.Errorf("got depth %d; wanted 1", tk.Depth())
+			}
+			if tok := next(IntToken); tok.Int != 7 {
+				t.Errorf("got %d; wanted 7", tok.Int)
+			}
+			if err := tk.Skip(); err != nil { // the array end
+				t.Fatal(err)
+			}
+			if err := tk.Skip(); err != io.EOF {
+				t.Errorf("got %v; wanted io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestTokenizerErrors(t *testing.T) {
+	raw := AppendArrayHeader(nil, 2)
+	raw = AppendString(raw, "abc")
+	for i := 1; i < len(raw); i++ {
+		for name, tk := range tokenizers(raw[:i]) {
+			var err error
+			for err == nil {
+				_, err = tk.Next()
+			}
+			if err != ErrShortBytes && err != io.ErrUnexpectedEOF {
+				t.Errorf("%s: len %d: got %v", name, i, err)
+			}
+			if _, again := tk.Next(); again != err {
+				t.Errorf("%s: error is not sticky: got %v", name, again)
+			}
+		}
+	}
+
+	tk := NewBytesTokenizer([]byte{0xc1})
+	if _, err := tk.Next(); err != InvalidPrefixError(0xc1) {
+		t.Errorf("got %v; wanted %v", err, InvalidPrefixError(0xc1))
+	}
+
+	deep := bytes.Repeat([]byte{0x91}, 4)
+	r := NewReader(bytes.NewReader(deep))
+	r.SetMaxRecursionDepth(2)
+	tk = NewTokenizer(r)
+	var err error
+	for err == nil {
+		_, err = tk.Next()
+	}
+	if err != ErrRecursion {
+		t.Errorf("got %v; wanted %v", err, ErrRecursion)
+	}
+}
+
+func TestTokenizerAllocs(t *testing.T) {
+	raw := AppendArrayHeader(nil, 5)
+	raw = AppendInt(raw, -5)
+	raw = AppendFloat64(raw, 2.5)
+	raw = AppendString(raw, "str")
+	raw = AppendBytes(raw, []byte("bin"))
+	raw = AppendTime(raw, time.Now())
+
+	var (
+		tk  Tokenizer
+		br  bytes.Reader
+		r   = NewReader(&br)
+		err error
+	)
+	run := func() {
+		for err == nil {
+			_, err = tk.Next()
+		}
+		if err != io.EOF {
+			t.Fatal(err)
+		}
+	}
+	for _, src := range []string{"bytes", "reader"} {
+		allocs := testing.AllocsPerRun(100, func() {
+			if src == "bytes" {
+				tk.Reset(raw)
+			} else {
+				br.Reset(raw)
+				r.Reset(&br)
+				tk = Tokenizer{r: r, stack: tk.stack[:0], scratch: tk.scratch}
+			}
+			err = nil
+			run()
+		})
+		if allocs != 0 {
+			t.Errorf("%s: got %v allocs; wanted 0", src, allocs)
+		}
+	}
+}
+
+func BenchmarkTokenizer(b *testing.B) {
+	raw, err := AppendIntf(nil, map[string]any{
+		"id":    int64(7),
+		"name":  "event",
+		"items": []any{1.5, "x", []byte("y"), map[string]any{"z": nil}},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(raw)))
+	tk := NewBytesTokenizer(raw)
+	for i := 0; i < b.N; i++ {
+		tk.Reset(raw)
+		for {
+			if _, err := tk.Next(); err != nil {
+				if err != io.EOF {
+					b.Fatal(err)
+				}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package msgp
+
+import (
+	"io"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/philhofer/fwd"
+)
+
+// ValidationError is returned when validation finds
+// that a MessagePack object is malformed or exceeds
+// the configured limits.
+type ValidationError struct {
+	Offset int64      // offset of the offending value in the input
+	Path   []PathElem // location of the offending value
+	Err    error      // the cause, e.g. ErrShortBytes or ErrLimitExceeded
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	out := e.Err.Error() + " at offset " + strconv.FormatInt(e.Offset, 10)
+	if len(e.Path) > 0 {
+		out += " (" + pathString(e.Path) + ")"
+	}
+	return out
+}
+
+// Unwrap returns the cause.
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// Resumable is always 'false' for ValidationErrors
+func (e *ValidationError) Resumable() bool { return false }
+
+// Validate checks that 'b' starts with exactly one complete,
+// well-formed MessagePack object that stays within the limits
+// in 'opts', and returns the bytes that follow it.
+// Validate does not decode the object, and it does not allocate
+// unless the object is invalid.
+//
+// Errors are always of type *ValidationError, and they wrap:
+//
+//   - [ErrShortBytes] (the object is incomplete)
+//   - [InvalidPrefixError] (bad encoding)
+//   - [ErrRecursion] (nested deeper than opts.MaxDepth)
+//   - [ErrLimitExceeded] (too many elements, too long a string, or over opts.MaxTotalBytes)
+//   - [ErrInvalidUTF8] (bad 'str' contents, if opts.ValidateUTF8 is set)
+func Validate(b []byte, opts Limits) (rest []byte, err error) {
+	v := validator{lim: opts, size: int64(len(b))}
+	rest, err = v.bytes(b, 0)
+	return rest, done(err)
+}
+
+// Validate reads the next object from the reader and checks
+// that it is well-formed and within the limits of the reader.
+// (See SetLimits.) The object is consumed, but not decoded.
+//
+// Validate returns io.EOF if the reader is at the end of its input.
+// Otherwise, errors are of type *ValidationError, and the offset
+// is relative to the start of the input.
+func (m *Reader) Validate() error {
+	if err := m.skipPayload(); err != nil {
+		return err
+	}
+	if _, err := m.R.PeekByte(); err != nil {
+		return err
+	}
+	v := validator{lim: m.Limits()}
+	return done(v.stream(m.R, 0))
+}
+
+// validator holds the limits in effect.
+// The path to a bad value is only built
+// while unwinding from an error, so valid
+// input is never copied.
+type validator struct {
+	lim   Limits
+	size  int64  // total length of the input ([]byte only)
+	total uint64 // charged against lim.MaxTotalBytes
+}
+
+func invalid(off int64, err error) error {
+	return &ValidationError{Offset: off, Err: err}
+}
+
+// within adds a path element to a
+// *ValidationError from an inner value.
+// Elements are added innermost first,
+// and reversed by done.
+func within(err error, elem PathElem) error {
+	if verr, ok := err.(*ValidationError); ok {
+		verr.Path = append(verr.Path, elem)
+	}
+	return err
+}
+
+func done(err error) error {
+	if verr, ok := err.(*ValidationError); ok {
+		slices.Reverse(verr.Path)
+	}
+	return err
+}
+
+func atIndex(i uint32) PathElem { return PathElem{Index: int(i), IsIndex: true} }
+
+// keyString renders an encoded map key as a path element
+func keyString(raw []byte) string {
+	if len(raw) == 0 {
+		return "<invalid>"
+	}
+	switch getType(raw[0]) {
+	case StrType, BinType:
+		if k, _, err := ReadMapKeyZC(raw); err == nil {
+			return string(k)
+		}
+	case IntType:
+		if i, _, err := ReadInt64Bytes(raw); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+	case UintType:
+		if u, _, err := ReadUint64Bytes(raw); err == nil {
+			return strconv.FormatUint(u, 10)
+		}
+	}
+	return "<" + getType(raw[0]).String() + ">"
+}
+
+// header decodes the prefix of an object
+// with the given spec from the first bytes of 'p'
+//
+//   - hdr is the number of prefix bytes
+//   - n is the number of payload bytes, or the number of map
+//     entries or array elements for maps and arrays
+func header(spec bytespec, p []byte) (hdr int, n uint64) {
+	switch spec.extra {
+	case extra8:
+		return int(spec.size), uint64(p[1])
+	case extra16:
+		return int(spec.size), uint64(big.Uint16(p[1:]))
+	case extra32:
+		return int(spec.size), uint64(big.Uint32(p[1:]))
+	case map16v, array16v:
+		return int(spec.size), uint64(big.Uint16(p[1:]))
+	case map32v, array32v:
+		return int(spec.size), uint64(big.Uint32(p[1:]))
+	}
+	switch spec.typ {
+	case MapType:
+		return 1, uint64(spec.extra) / 2
+	case ArrayType:
+		return 1, uint64(spec.extra)
+	case StrType:
+		return 1, uint64(spec.size) - 1
+	}
+	return int(spec.size), 0
+}
+
+// check applies the limits that don't require reading the payload
+func (v *validator) check(spec bytespec, n uint64, depth int) error {
+	cost := n
+	switch spec.typ {
+	case MapType, ArrayType:
+		if depth >= v.lim.maxDepth() {
+			return ErrRecursion
+		}
+		if n > uint64(v.lim.maxElements()) {
+			return ErrLimitExceeded
+		}
+		cost *= elementCost
+	case StrType:
+		if n > v.lim.maxStringLength() {
+			return ErrLimitExceeded
+		}
+	case BinType, ExtensionType:
+		if n > uint64(v.lim.maxElements()) {
+			return ErrLimitExceeded
+		}
+	default:
+		return nil
+	}
+	// the same charges as (*Reader).SetMaxTotalBytes
+	v.total += cost
+	if v.total > v.lim.maxTotalBytes() {
+		return ErrLimitExceeded
+	}
+	return nil
+}
+
+func (v *validator) bytes(b []byte, depth int) ([]byte, error) {
+	off := v.size - int64(len(b))
+	if len(b) == 0 {
+		return b, invalid(off, ErrShortBytes)
+	}
+	spec := getBytespec(b[0])
+	if spec.size == 0 {
+		return b, invalid(off, InvalidPrefixError(b[0]))
+	}
+	if len(b) < int(spec.size) {
+		return b, invalid(off, ErrShortBytes)
+	}
+	hdr, n := header(spec, b)
+	if err := v.check(spec, n, depth); err != nil {
+		return b, invalid(off, err)
+	}
+
+	switch spec.typ {
+	case MapType, ArrayType:
+		isMap := spec.typ == MapType
+		o := b[hdr:]
+		// every key and value is at least one byte
+		need := n
+		if isMap {
+			need *= 2
+		}
+		if uint64(len(o)) < need {
+			return b, invalid(off, ErrShortBytes)
+		}
+		var err error
+		for i := range uint32(n) {
+			if !isMap {
+				if o, err = v.bytes(o, depth+1); err != nil {
+					return b, within(err, atIndex(i))
+				}
+				continue
+			}
+			k := o
+			if o, err = v.bytes(o, depth+1); err != nil {
+				return b, err
+			}
+			if o, err = v.bytes(o, depth+1); err != nil {
+				return b, within(err, PathElem{Key: keyString(k[:len(k)-len(o)])})
+			}
+		}
+		return o, nil
+
+	case StrType, BinType, ExtensionType:
+		if spec.extra == constsize && spec.typ != StrType {
+			// fixext: the payload is part of spec.size
+			return b[hdr:], nil
+		}
+		if uint64(len(b)-hdr) < n {
+			return b, invalid(off, ErrShortBytes)
+		}
+		end := hdr + int(n)
+		if spec.typ == StrType && v.lim.ValidateUTF8 && !utf8.Valid(b[hdr:end]) {
+			return b, invalid(off, ErrInvalidUTF8)
+		}
+		return b[end:], nil
+
+	default:
+		return b[hdr:], nil
+	}
+}
+
+func (v *validator) stream(r *fwd.Reader, depth int) error {
+	off := r.InputOffset()
+	lead, err := r.PeekByte()
+	if err != nil {
+		return invalid(off, noEOF(err))
+	}
+	spec := getBytespec(lead)
+	if spec.size == 0 {
+		return invalid(off, InvalidPrefixError(lead))
+	}
+	plen := int(spec.size)
+	if spec.typ == StrType && spec.extra == constsize {
+		plen = 1
+	}
+	p, err := r.Peek(plen)
+	if err != nil {
+		return invalid(off, noEOF(err))
+	}
+	hdr, n := header(spec, p)
+	if err := v.check(spec, n, depth); err != nil {
+		return invalid(off, err)
+	}
+	if _, err := r.Skip(hdr); err != nil {
+		return invalid(off, noEOF(err))
+	}
+
+	switch spec.typ {
+	case MapType, ArrayType:
+		isMap := spec.typ == MapType
+		var kbuf [32]byte
+		for i := range uint32(n) {
+			if !isMap {
+				if err := v.stream(r, depth+1); err != nil {
+					return within(err, atIndex(i))
+				}
+				continue
+			}
+			// copy the key now, since reading
+			// it invalidates the peeked bytes
+			key := append(kbuf[:0], peekKey(r)...)
+			if err := v.stream(r, depth+1); err != nil {
+				return err
+			}
+			if err := v.stream(r, depth+1); err != nil {
+				return within(err, PathElem{Key: keyString(key)})
+			}
+		}
+		return nil
+
+	case StrType, BinType, ExtensionType:
+		return v.payload(r, off, n, spec.typ == StrType && v.lim.ValidateUTF8)
+	}
+	return nil
+}
+
+// peekKey peeks at a small scalar key that is
+// about to be read, or just its prefix if the
+// whole key can't be peeked
+func peekKey(r *fwd.Reader) []byte {
+	const maxKey = 256
+	lead, err := r.PeekByte()
+	if err != nil {
+		return nil
+	}
+	spec := getBytespec(lead)
+	if spec.size == 0 {
+		return nil
+	}
+	var sz uint64
+	switch spec.typ {
+	case MapType, ArrayType:
+		return []byte{lead}
+	case StrType, BinType:
+		p, err := r.Peek(int(spec.size))
+		if err != nil {
+			return []byte{lead}
+		}
+		hdr, n := header(spec, p)
+		sz = uint64(hdr) + n
+	default:
+		sz = uint64(spec.size)
+	}
+	if sz > maxKey || sz > uint64(r.BufferSize()) {
+		return []byte{lead}
+	}
+	p, err := r.Peek(int(sz))
+	if err != nil {
+		return []byte{lead}
+	}
+	return p
+}
+
+// payload consumes 'n' bytes of payload, checking
+// that they are valid UTF-8 if 'utf' is set.
+// (Skip can't be used here, because seeking
+// past the end of the input isn't an error.)
+func (v *validator) payload(r *fwd.Reader, off int64, n uint64, utf bool) error {
+	var (
+		carry [utf8.UTFMax]byte
+		nc    int
+	)
+	for n > 0 {
+		p, err := r.Next(int(min(n, uint64(r.BufferSize()))))
+		if err != nil {
+			return invalid(off, noEOF(err))
+		}
+		n -= uint64(len(p))
+		if !utf {
+			continue
+		}
+		if nc > 0 {
+			// complete the rune that straddles chunks
+			need := min(utf8.UTFMax-nc, len(p))
+			tmp := append(carry[:nc:nc], p[:need]...)
+			if !utf8.FullRune(tmp) {
+				nc = copy(carry[:], tmp)
+				continue
+			}
+			c, size := utf8.DecodeRune(tmp)
+			if c == utf8.RuneError && size <= 1 {
+				return invalid(off, ErrInvalidUTF8)
+			}
+			p = p[size-nc:]
+			nc = 0
+		}
+		// hold back a trailing incomplete rune
+		cut := len(p)
+		for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(p[i]) {
+				if !utf8.FullRune(p[i:]) {
+					cut = i
+				}
+				break
+			}
+		}
+		if !utf8.Valid(p[:cut]) {
+			return invalid(off, ErrInvalidUTF8)
+		}
+		nc = copy(carry[:], p[cut:])
+	}
+	if nc > 0 {
+		return invalid(off, ErrInvalidUTF8)
+	}
+	return nil
+}
+
+// noEOF converts io.EOF in the middle
+// of an object to io.ErrUnexpectedEOF
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validateBoth(t *testing.T, raw []byte, l Limits) (error, error) {
+	t.Helper()
+	_, berr := Validate(raw, l)
+	r := NewReaderSize(bytes.NewReader(raw), 16)
+	r.SetLimits(l)
+	serr := r.Validate()
+	return berr, serr
+}
+
+func TestValidate(t *testing.T) {
+	src := map[string]any{
+		"id":    int64(-7),
+		"name":  strings.Repeat("é", 40),
+		"blob":  []byte("data"),
+		"float": 3.5,
+		"items": []any{uint64(1), nil, true, map[string]any{"k": "v"}},
+		"ext":   &RawExtension{Type: 5, Data: []byte{1, 2, 3, 4}},
+	}
+	raw, err := AppendIntf(nil, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw = AppendTime(raw, time.Now())
+	next := AppendString(nil, "next")
+
+	rest, err := Validate(append(raw, next...), Limits{ValidateUTF8: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err = Validate(rest, Limits{ValidateUTF8: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, next) {
+		t.Errorf("got rest %x; wanted %x", rest, next)
+	}
+
+	// the reader is small enough to force
+	// strings to be checked in chunks
+	r := NewReaderSize(bytes.NewReader(append(raw, next...)), 16)
+	r.SetLimits(Limits{ValidateUTF8: true})
+	for {
+		err := r.Validate()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestValidateTruncated(t *testing.T) {
+	raw := AppendMapHeader(nil, 1)
+	raw = AppendString(raw, "a")
+	raw = AppendArrayHeader(raw, 2)
+	raw = AppendString(raw, "hello")
+	raw = AppendBytes(raw, []byte{1, 2})
+	for i := 1; i < len(raw); i++ {
+		berr, serr := validateBoth(t, raw[:i], Limits{})
+		if !errors.Is(berr, ErrShortBytes) {
+			t.Errorf("len %d: got %v; wanted %v", i, berr, ErrShortBytes)
+		}
+		if !errors.Is(serr, io.ErrUnexpectedEOF) {
+			t.Errorf("len %d: stream: got %v; wanted %v", i, serr, io.ErrUnexpectedEOF)
+		}
+	}
+
+	_, err := Validate(nil, Limits{})
+	if !errors.Is(err, ErrShortBytes) {
+		t.Errorf("got %v; wanted %v", err, ErrShortBytes)
+	}
+	err = NewReader(bytes.NewReader(nil)).Validate()
+	if err != io.EOF {
+		t.Errorf("got %v; wanted %v", err, io.EOF)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	// {"a": [1, {"b": <value>}]}
+	wrap := func(value []byte) []byte {
+		raw := AppendMapHeader(nil, 1)
+		raw = AppendString(raw, "a")
+		raw = AppendArrayHeader(raw, 2)
+		raw = AppendInt(raw, 1)
+		raw = AppendMapHeader(raw, 1)
+		raw = AppendString(raw, "b")
+		return append(raw, value...)
+	}
+	const off = 8
+	tests := []struct {
+		name  string
+		value []byte
+		lim   Limits
+		want  error
+	}{
+		{"prefix", []byte{0xc1}, Limits{}, InvalidPrefixError(0xc1)},
+		{"elements", AppendArrayHeader(nil, 3), Limits{MaxElements: 2}, ErrLimitExceeded},
+		{"bin", AppendBytes(nil, []byte{1, 2, 3}), Limits{MaxElements: 2}, ErrLimitExceeded},
+		{"string", AppendString(nil, "abc"), Limits{MaxStringLength: 2}, ErrLimitExceeded},
+		{"depth", AppendArrayHeader(nil, 0), Limits{MaxDepth: 3}, ErrRecursion},
+		{"utf8", AppendStringFromBytes(nil, []byte{'a', 0xff}), Limits{ValidateUTF8: true}, ErrInvalidUTF8},
+		{"utf8 split", AppendStringFromBytes(nil, append(bytes.Repeat([]byte{'a'}, 30), 0xe2, 0x82)), Limits{ValidateUTF8: true}, ErrInvalidUTF8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := wrap(tt.value)
+			berr, serr := validateBoth(t, raw, tt.lim)
+			for _, err := range []error{berr, serr} {
+				var verr *ValidationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("got %v; wanted a *ValidationError", err)
+				}
+				if verr.Err != tt.want {
+					t.Errorf("got cause %v; wanted %v", verr.Err, tt.want)
+				}
+				if verr.Offset != off {
+					t.Errorf("got offset %d; wanted %d", verr.Offset, off)
+				}
+				if got := pathString(verr.Path); got != "a/1/b" {
+					t.Errorf("got path %q; wanted %q", got, "a/1/b")
+				}
+			}
+		})
+	}
+
+	// valid UTF-8 split across reader chunks
+	raw := wrap(AppendString(nil, strings.Repeat("a", 15)+"€€"))
+	berr, serr := validateBoth(t, raw, Limits{ValidateUTF8: true})
+	if berr != nil || serr != nil {
+		t.Errorf("got errors %v, %v", berr, serr)
+	}
+}
+
+func BenchmarkValidate(b *testing.B) {
+	raw, err := AppendIntf(nil, map[string]any{
+		"id":    int64(7),
+		"name":  "event",
+		"items": []any{1.5, "x", []byte("y"), map[string]any{"z": nil}},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(raw)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Validate(raw, Limits{ValidateUTF8: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
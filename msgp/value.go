@@ -0,0 +1,651 @@
+package msgp
+
+import (
+	"bytes"
+	"math"
+	"time"
+)
+
+// Value is a MessagePack object of any type, decoded
+// without losing information about how it was encoded:
+// unlike ReadIntf, it keeps signed and unsigned integers,
+// 'str' and 'bin', and float32 and float64 apart, keeps
+// extensions (including timestamps) as their raw type
+// and data, and keeps map entries in order with keys
+// of any type.
+//
+// Value implements Marshaler, Unmarshaler, Encodable,
+// Decodable and Sizer, so it can be used to inspect and
+// rewrite arbitrary objects. Numbers are re-encoded in
+// their smallest form. The zero Value is nil.
+type Value struct {
+	typ     Type // InvalidType is nil
+	bits    uint64
+	extType int8
+	b       []byte     // str, bin and extension data
+	elems   []Value    // array elements
+	entries []MapEntry // map entries
+}
+
+// MapEntry is one key and value of a map Value.
+type MapEntry struct {
+	Key   Value
+	Value Value
+}
+
+// IntValue returns a Value holding a signed integer.
+func IntValue(i int64) Value { return Value{typ: IntType, bits: uint64(i)} }
+
+// UintValue returns a Value holding an unsigned integer.
+func UintValue(u uint64) Value { return Value{typ: UintType, bits: u} }
+
+// Float32Value returns a Value holding a float32.
+func Float32Value(f float32) Value {
+	return Value{typ: Float32Type, bits: uint64(math.Float32bits(f))}
+}
+
+// Float64Value returns a Value holding a float64.
+func Float64Value(f float64) Value { return Value{typ: Float64Type, bits: math.Float64bits(f)} }
+
+// BoolValue returns a Value holding a bool.
+func BoolValue(b bool) Value {
+	v := Value{typ: BoolType}
+	if b {
+		v.bits = 1
+	}
+	return v
+}
+
+// StrValue returns a Value holding a 'str'.
+func StrValue(s string) Value { return Value{typ: StrType, b: []byte(s)} }
+
+// BinValue returns a Value holding a 'bin'. It does not copy 'b'.
+func BinValue(b []byte) Value { return Value{typ: BinType, b: b} }
+
+// ExtValue returns a Value holding an extension. It does not copy 'data'.
+func ExtValue(typ int8, data []byte) Value {
+	return Value{typ: ExtensionType, extType: typ, b: data}
+}
+
+// TimeValue returns a Value holding 't' as a MessagePack
+// timestamp extension (type -1).
+func TimeValue(t time.Time) Value {
+	ext := AppendTimeExt(nil, t)
+	typ, _, data, _ := readExt(ext)
+	return ExtValue(typ, data)
+}
+
+// ArrayValue returns a Value holding an array. It does not copy 'elems'.
+func ArrayValue(elems ...Value) Value {
+	if elems == nil {
+		elems = []Value{}
+	}
+	return Value{typ: ArrayType, elems: elems}
+}
+
+// MapValue returns a Value holding a map. It does not copy 'entries'.
+func MapValue(entries ...MapEntry) Value {
+	if entries == nil {
+		entries = []MapEntry{}
+	}
+	return Value{typ: MapType, entries: entries}
+}
+
+// ValueOf returns the Value of an object
+// that can be encoded with AppendIntf.
+func ValueOf(i any) (Value, error) {
+	raw, err := AppendIntf(nil, i)
+	if err != nil {
+		return Value{}, err
+	}
+	var v Value
+	_, err = v.UnmarshalMsg(raw)
+	return v, err
+}
+
+// Type returns the type of the value, which is one of
+// StrType, BinType, MapType, ArrayType, Float64Type,
+// Float32Type, BoolType, IntType, UintType, NilType
+// or ExtensionType.
+func (v Value) Type() Type {
+	if v.typ == InvalidType {
+		return NilType
+	}
+	return v.typ
+}
+
+// IsNil returns whether the value is nil.
+func (v Value) IsNil() bool { return v.typ == InvalidType || v.typ == NilType }
+
+// Int returns the value of a signed integer,
+// and whether the value is a signed integer.
+func (v Value) Int() (int64, bool) { return int64(v.bits), v.typ == IntType }
+
+// Uint returns the value of an unsigned integer,
+// and whether the value is an unsigned integer.
+func (v Value) Uint() (uint64, bool) { return v.bits, v.typ == UintType }
+
+// Float returns the value of a float32 or float64,
+// and whether the value is either one.
+func (v Value) Float() (float64, bool) {
+	switch v.typ {
+	case Float32Type:
+		return float64(math.Float32frombits(uint32(v.bits))), true
+	case Float64Type:
+		return math.Float64frombits(v.bits), true
+	}
+	return 0, false
+}
+
+// Bool returns the value of a bool,
+// and whether the value is a bool.
+func (v Value) Bool() (bool, bool) { return v.bits != 0, v.typ == BoolType }
+
+// Str returns the contents of a 'str',
+// and whether the value is a 'str'.
+func (v Value) Str() (string, bool) {
+	if v.typ != StrType {
+		return "", false
+	}
+	return string(v.b), true
+}
+
+// Bin returns the contents of a 'bin',
+// and whether the value is a 'bin'.
+func (v Value) Bin() ([]byte, bool) {
+	if v.typ != BinType {
+		return nil, false
+	}
+	return v.b, true
+}
+
+// Ext returns the type and data of an extension,
+// and whether the value is an extension.
+func (v Value) Ext() (int8, []byte, bool) {
+	if v.typ != ExtensionType {
+		return 0, nil, false
+	}
+	return v.extType, v.b, true
+}
+
+// Time returns the value of a timestamp extension
+// (either type -1 or type 5), and whether the
+// value is a valid timestamp.
+func (v Value) Time() (time.Time, bool) {
+	if v.typ != ExtensionType || (v.extType != TimeExtension && v.extType != MsgTimeExtension) {
+		return time.Time{}, false
+	}
+	raw, err := v.MarshalMsg(nil)
+	if err != nil {
+		return time.Time{}, false
+	}
+	t, _, err := ReadTimeBytes(raw)
+	return t, err == nil
+}
+
+// Len returns the number of entries in a map, the number
+// of elements in an array, or the number of bytes in a
+// 'str', 'bin' or extension. It returns 0 for other types.
+func (v Value) Len() int {
+	switch v.typ {
+	case MapType:
+		return len(v.entries)
+	case ArrayType:
+		return len(v.elems)
+	}
+	return len(v.b)
+}
+
+// Elems returns the elements of an array, or nil if
+// the value is not an array. Modifying the elements
+// modifies the array.
+func (v Value) Elems() []Value { return v.elems }
+
+// Entries returns the entries of a map in order, or nil
+// if the value is not a map. Modifying the entries
+// modifies the map.
+func (v Value) Entries() []MapEntry { return v.entries }
+
+// Index returns element 'i' of an array,
+// and whether the element exists.
+func (v Value) Index(i int) (Value, bool) {
+	if v.typ != ArrayType || i < 0 || i >= len(v.elems) {
+		return Value{}, false
+	}
+	return v.elems[i], true
+}
+
+// Key returns the value of the first map entry
+// whose key is a 'str' or 'bin' equal to 'key',
+// and whether there is one.
+func (v Value) Key(key string) (Value, bool) {
+	if i := v.find(key); i >= 0 {
+		return v.entries[i].Value, true
+	}
+	return Value{}, false
+}
+
+// Get follows 'path' into nested maps and arrays, and
+// returns the value it leads to and whether it exists.
+// A string in the path selects the map entry with that key
+// (see Key). An int selects an array element (see Index),
+// or the map entry with that integer key.
+func (v Value) Get(path ...any) (Value, bool) {
+	for _, p := range path {
+		var ok bool
+		switch p := p.(type) {
+		case string:
+			v, ok = v.Key(p)
+		case int:
+			if v.typ == ArrayType {
+				v, ok = v.Index(p)
+			} else {
+				v, ok = v.intKey(int64(p))
+			}
+		}
+		if !ok {
+			return Value{}, false
+		}
+	}
+	return v, true
+}
+
+func (v Value) find(key string) int {
+	for i := range v.entries {
+		k := &v.entries[i].Key
+		if (k.typ == StrType || k.typ == BinType) && string(k.b) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (v Value) intKey(key int64) (Value, bool) {
+	for _, e := range v.entries {
+		k := e.Key
+		if (k.typ == IntType && int64(k.bits) == key) ||
+			(k.typ == UintType && key >= 0 && k.bits == uint64(key)) {
+			return e.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+// Set sets the value of the map entry with the 'str' or
+// 'bin' key 'key', or appends a new entry with a 'str' key.
+// A nil value becomes an empty map first.
+// Set panics if the value is any other type.
+func (v *Value) Set(key string, val Value) {
+	if v.IsNil() {
+		*v = MapValue()
+	}
+	if v.typ != MapType {
+		panic("msgp: (*Value).Set called on a " + v.typ.String())
+	}
+	if i := v.find(key); i >= 0 {
+		v.entries[i].Value = val
+		return
+	}
+	v.entries = append(v.entries, MapEntry{Key: StrValue(key), Value: val})
+}
+
+// Delete removes the first map entry with the
+// 'str' or 'bin' key 'key', and returns whether
+// there was one. It preserves the order of the
+// remaining entries.
+func (v *Value) Delete(key string) bool {
+	i := v.find(key)
+	if i < 0 {
+		return false
+	}
+	v.entries = append(v.entries[:i], v.entries[i+1:]...)
+	return true
+}
+
+// MarshalMsg implements Marshaler
+func (v Value) MarshalMsg(b []byte) ([]byte, error) {
+	var err error
+	switch v.typ {
+	case InvalidType, NilType:
+		return AppendNil(b), nil
+	case StrType:
+		return AppendStringFromBytes(b, v.b), nil
+	case BinType:
+		return AppendBytes(b, v.b), nil
+	case IntType:
+		return AppendInt64(b, int64(v.bits)), nil
+	case UintType:
+		return AppendUint64(b, v.bits), nil
+	case Float32Type:
+		return AppendFloat32(b, math.Float32frombits(uint32(v.bits))), nil
+	case Float64Type:
+		return AppendFloat64(b, math.Float64frombits(v.bits)), nil
+	case BoolType:
+		return AppendBool(b, v.bits != 0), nil
+	case ExtensionType:
+		return AppendExtension(b, &RawExtension{Type: v.extType, Data: v.b})
+	case ArrayType:
+		b = AppendArrayHeader(b, uint32(len(v.elems)))
+		for i := range v.elems {
+			if b, err = v.elems[i].MarshalMsg(b); err != nil {
+				return b, WrapError(err, i)
+			}
+		}
+		return b, nil
+	case MapType:
+		b = AppendMapHeader(b, uint32(len(v.entries)))
+		for i := range v.entries {
+			if b, err = v.entries[i].Key.MarshalMsg(b); err != nil {
+				return b, err
+			}
+			if b, err = v.entries[i].Value.MarshalMsg(b); err != nil {
+				return b, WrapError(err, v.entries[i].Key.ctx())
+			}
+		}
+		return b, nil
+	}
+	return b, &ErrUnsupportedType{}
+}
+
+// EncodeMsg implements Encodable
+func (v Value) EncodeMsg(w *Writer) error {
+	switch v.typ {
+	case InvalidType, NilType:
+		return w.WriteNil()
+	case StrType:
+		return w.WriteStringFromBytes(v.b)
+	case BinType:
+		return w.WriteBytes(v.b)
+	case IntType:
+		return w.WriteInt64(int64(v.bits))
+	case UintType:
+		return w.WriteUint64(v.bits)
+	case Float32Type:
+		return w.WriteFloat32(math.Float32frombits(uint32(v.bits)))
+	case Float64Type:
+		return w.WriteFloat64(math.Float64frombits(v.bits))
+	case BoolType:
+		return w.WriteBool(v.bits != 0)
+	case ExtensionType:
+		return w.WriteExtensionRaw(v.extType, v.b)
+	case ArrayType:
+		if err := w.WriteArrayHeader(uint32(len(v.elems))); err != nil {
+			return err
+		}
+		for i := range v.elems {
+			if err := v.elems[i].EncodeMsg(w); err != nil {
+				return WrapError(err, i)
+			}
+		}
+		return nil
+	case MapType:
+		if err := w.WriteMapHeader(uint32(len(v.entries))); err != nil {
+			return err
+		}
+		for i := range v.entries {
+			if err := v.entries[i].Key.EncodeMsg(w); err != nil {
+				return err
+			}
+			if err := v.entries[i].Value.EncodeMsg(w); err != nil {
+				return WrapError(err, v.entries[i].Key.ctx())
+			}
+		}
+		return nil
+	}
+	return &ErrUnsupportedType{}
+}
+
+// Msgsize implements Sizer
+func (v Value) Msgsize() int {
+	switch v.typ {
+	case StrType:
+		return StringPrefixSize + len(v.b)
+	case BinType:
+		return BytesPrefixSize + len(v.b)
+	case IntType, UintType:
+		return Int64Size
+	case Float32Type:
+		return Float32Size
+	case Float64Type:
+		return Float64Size
+	case ExtensionType:
+		return ExtensionPrefixSize + len(v.b)
+	case ArrayType:
+		s := ArrayHeaderSize
+		for i := range v.elems {
+			s += v.elems[i].Msgsize()
+		}
+		return s
+	case MapType:
+		s := MapHeaderSize
+		for i := range v.entries {
+			s += v.entries[i].Key.Msgsize() + v.entries[i].Value.Msgsize()
+		}
+		return s
+	}
+	return NilSize
+}
+
+// ctx is the error context for a map key
+func (v Value) ctx() any {
+	switch v.typ {
+	case StrType, BinType:
+		return string(v.b)
+	case IntType:
+		return int64(v.bits)
+	case UintType:
+		return v.bits
+	}
+	return "<" + v.Type().String() + ">"
+}
+
+// UnmarshalMsg implements Unmarshaler.
+// The value does not reference 'b'.
+func (v *Value) UnmarshalMsg(b []byte) ([]byte, error) {
+	return v.unmarshal(b, 0)
+}
+
+func (v *Value) unmarshal(b []byte, depth int) (o []byte, err error) {
+	if len(b) == 0 {
+		return b, ErrShortBytes
+	}
+	var (
+		p  []byte
+		sz uint32
+	)
+	switch getType(b[0]) {
+	case StrType:
+		p, o, err = ReadStringZC(b)
+		*v = Value{typ: StrType, b: bytes.Clone(p)}
+	case BinType:
+		p, o, err = ReadBytesZC(b)
+		*v = Value{typ: BinType, b: bytes.Clone(p)}
+	case IntType:
+		var i int64
+		i, o, err = ReadInt64Bytes(b)
+		*v = IntValue(i)
+	case UintType:
+		var u uint64
+		u, o, err = ReadUint64Bytes(b)
+		*v = UintValue(u)
+	case Float32Type:
+		var f float32
+		f, o, err = ReadFloat32Bytes(b)
+		*v = Float32Value(f)
+	case Float64Type:
+		var f float64
+		f, o, err = ReadFloat64Bytes(b)
+		*v = Float64Value(f)
+	case BoolType:
+		var t bool
+		t, o, err = ReadBoolBytes(b)
+		*v = BoolValue(t)
+	case NilType:
+		o, err = ReadNilBytes(b)
+		*v = Value{}
+	case ExtensionType:
+		var typ int8
+		typ, o, p, err = readExt(b)
+		*v = ExtValue(typ, bytes.Clone(p))
+	case ArrayType:
+		if depth >= recursionLimit {
+			return b, ErrRecursion
+		}
+		sz, o, err = ReadArrayHeaderBytes(b)
+		if err != nil {
+			return b, err
+		}
+		// every element is at least one byte
+		if uint64(len(o)) < uint64(sz) {
+			return b, ErrShortBytes
+		}
+		*v = ArrayValue(make([]Value, sz)...)
+		for i := range v.elems {
+			if o, err = v.elems[i].unmarshal(o, depth+1); err != nil {
+				return b, WrapErrorBytes(err, b, o, i)
+			}
+		}
+	case MapType:
+		if depth >= recursionLimit {
+			return b, ErrRecursion
+		}
+		sz, o, err = ReadMapHeaderBytes(b)
+		if err != nil {
+			return b, err
+		}
+		// every key and value is at least one byte
+		if uint64(len(o)) < 2*uint64(sz) {
+			return b, ErrShortBytes
+		}
+		*v = MapValue(make([]MapEntry, sz)...)
+		for i := range v.entries {
+			e := &v.entries[i]
+			if o, err = e.Key.unmarshal(o, depth+1); err != nil {
+				return b, WrapErrorBytes(err, b, o)
+			}
+			if o, err = e.Value.unmarshal(o, depth+1); err != nil {
+				return b, WrapErrorBytes(err, b, o, e.Key.ctx())
+			}
+		}
+	default:
+		return b, InvalidPrefixError(b[0])
+	}
+	if err != nil {
+		return b, err
+	}
+	return o, nil
+}
+
+// DecodeMsg implements Decodable.
+// The limits of the Reader apply.
+func (v *Value) DecodeMsg(r *Reader) (err error) {
+	if err = r.skipPayload(); err != nil {
+		return
+	}
+	lead, err := r.R.PeekByte()
+	if err != nil {
+		return err
+	}
+	switch getType(lead) {
+	case StrType:
+		var p []byte
+		p, err = r.ReadStringAsBytes(nil)
+		*v = Value{typ: StrType, b: p}
+	case BinType:
+		var p []byte
+		p, err = r.ReadBytes(nil)
+		*v = Value{typ: BinType, b: p}
+	case IntType:
+		var i int64
+		i, err = r.ReadInt64()
+		*v = IntValue(i)
+	case UintType:
+		var u uint64
+		u, err = r.ReadUint64()
+		*v = UintValue(u)
+	case Float32Type:
+		var f float32
+		f, err = r.ReadFloat32()
+		*v = Float32Value(f)
+	case Float64Type:
+		var f float64
+		f, err = r.ReadFloat64()
+		*v = Float64Value(f)
+	case BoolType:
+		var t bool
+		t, err = r.ReadBool()
+		*v = BoolValue(t)
+	case NilType:
+		err = r.ReadNil()
+		*v = Value{}
+	case ExtensionType:
+		var (
+			typ  int8
+			data []byte
+		)
+		typ, data, err = r.ReadExtensionRaw()
+		if err == nil {
+			err = r.charge(uint64(len(data)))
+		}
+		*v = ExtValue(typ, bytes.Clone(data))
+	case ArrayType:
+		var sz uint32
+		if sz, err = r.ReadArrayHeader(); err != nil {
+			return err
+		}
+		if sz > r.GetMaxElements() {
+			return ErrLimitExceeded
+		}
+		var done func()
+		if done, err = r.recursiveCall(); err != nil {
+			return err
+		}
+		defer done()
+		*v = ArrayValue(make([]Value, sz)...)
+		for i := range v.elems {
+			if err = v.elems[i].DecodeMsg(r); err != nil {
+				return r.WrapError(err, i)
+			}
+		}
+	case MapType:
+		var sz uint32
+		if sz, err = r.ReadMapHeader(); err != nil {
+			return err
+		}
+		if sz > r.GetMaxElements() {
+			return ErrLimitExceeded
+		}
+		var done func()
+		if done, err = r.recursiveCall(); err != nil {
+			return err
+		}
+		defer done()
+		*v = MapValue(make([]MapEntry, sz)...)
+		for i := range v.entries {
+			e := &v.entries[i]
+			if err = e.Key.DecodeMsg(r); err != nil {
+				return r.WrapError(err)
+			}
+			if err = e.Value.DecodeMsg(r); err != nil {
+				return r.WrapError(err, e.Key.ctx())
+			}
+		}
+	default:
+		return InvalidPrefixError(lead)
+	}
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, following the
+// same rules as UnmarshalAsJSON.
+func (v Value) MarshalJSON() ([]byte, error) {
+	raw, err := v.MarshalMsg(nil)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err = UnmarshalAsJSON(&buf, raw); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
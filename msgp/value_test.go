@@ -0,0 +1,161 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValueRoundTrip(t *testing.T) {
+	now := time.Unix(1700000000, 500).UTC()
+	raw := AppendMapHeader(nil, 7)
+	raw = AppendString(raw, "int")
+	raw = AppendInt64(raw, -300)
+	raw = AppendString(raw, "uint")
+	raw = AppendUint64(raw, 1<<40)
+	raw = AppendBytes(raw, []byte("bin key"))
+	raw = AppendStringFromBytes(raw, []byte("str"))
+	raw = AppendInt(raw, 7) // integer key
+	raw = AppendArrayHeader(raw, 3)
+	raw = AppendFloat32(raw, 1.5)
+	raw = AppendNil(raw)
+	raw = AppendBool(raw, true)
+	raw = AppendString(raw, "bin")
+	raw = AppendBytes(raw, []byte{1, 2})
+	raw = AppendString(raw, "ext")
+	raw, _ = AppendExtension(raw, &RawExtension{Type: 9, Data: []byte{1, 2, 3, 4}})
+	raw = AppendString(raw, "time")
+	raw = AppendTimeExt(raw, now)
+
+	var v Value
+	rest, err := v.UnmarshalMsg(append(raw, 0xc0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 {
+		t.Errorf("got %d bytes left", len(rest))
+	}
+	r := NewReader(bytes.NewReader(raw))
+	var dv Value
+	if err := dv.DecodeMsg(r); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, v := range map[string]Value{"unmarshal": v, "decode": dv} {
+		if v.Type() != MapType || v.Len() != 7 {
+			t.Fatalf("%s: got %s with %d entries", name, v.Type(), v.Len())
+		}
+		if i, ok := v.Get("int"); !ok || i.Type() != IntType {
+			t.Errorf("%s: int: got %s", name, i.Type())
+		}
+		if u, ok := v.Get("uint"); !ok || u.Type() != UintType {
+			t.Errorf("%s: uint: got %s", name, u.Type())
+		}
+		if s, ok := v.Get("bin key"); !ok || s.Type() != StrType {
+			t.Errorf("%s: bin key: got %s", name, s.Type())
+		}
+		if f, ok := v.Get(7, 0); !ok || f.Type() != Float32Type {
+			t.Errorf("%s: 7/0: got %s", name, f.Type())
+		}
+		if b, ok := v.Get(7, 2); !ok {
+			t.Errorf("%s: 7/2 is missing", name)
+		} else if x, ok := b.Bool(); !ok || !x {
+			t.Errorf("%s: 7/2: got %v", name, x)
+		}
+		if _, ok := v.Get(7, 3); ok {
+			t.Errorf("%s: 7/3 exists", name)
+		}
+		if typ, data, ok := v.Entries()[5].Value.Ext(); !ok || typ != 9 || len(data) != 4 {
+			t.Errorf("%s: ext: got %d %x", name, typ, data)
+		}
+		if tv, _ := v.Get("time"); tv.Type() != ExtensionType {
+			t.Errorf("%s: time: got %s", name, tv.Type())
+		} else if tm, ok := tv.Time(); !ok || !tm.Equal(now) {
+			t.Errorf("%s: time: got %v", name, tm)
+		}
+
+		out, err := v.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, raw) {
+			t.Errorf("%s: got %x; wanted %x", name, out, raw)
+		}
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if err := v.EncodeMsg(w); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		if !bytes.Equal(buf.Bytes(), raw) {
+			t.Errorf("%s: encode: got %x; wanted %x", name, buf.Bytes(), raw)
+		}
+		if v.Msgsize() < len(raw) {
+			t.Errorf("%s: Msgsize %d < %d", name, v.Msgsize(), len(raw))
+		}
+	}
+}
+
+func TestValueEdit(t *testing.T) {
+	var v Value
+	v.Set("a", IntValue(1))
+	v.Set("b", ArrayValue(StrValue("x"), UintValue(2)))
+	v.Set("a", StrValue("one"))
+	if !v.Delete("b") || v.Delete("b") {
+		t.Error("Delete")
+	}
+	v.Set("c", MapValue(MapEntry{Key: IntValue(-1), Value: Value{}}))
+	js, err := v.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":"one","c":{"-1":null}}`; string(js) != want {
+		t.Errorf("got %s; wanted %s", js, want)
+	}
+
+	m, err := ValueOf(map[string]any{"k": []any{int64(1), "s"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := m.Get("k", 1); s.Type() != StrType {
+		t.Errorf("got %s", s.Type())
+	}
+}
+
+func TestValueErrors(t *testing.T) {
+	raw := AppendArrayHeader(nil, 2)
+	raw = AppendMapHeader(raw, 1)
+	raw = AppendString(raw, "k")
+	raw = append(raw, 0xc1)
+	raw = AppendNil(raw)
+
+	var v Value
+	_, err := v.UnmarshalMsg(raw)
+	var lerr LocatedError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("got %v", err)
+	}
+	if got := pathString(lerr.Path()); got != "0/k" {
+		t.Errorf("got path %q", got)
+	}
+	if lerr.Offset() != 4 {
+		t.Errorf("got offset %d; wanted 4", lerr.Offset())
+	}
+	err = v.DecodeMsg(NewReader(bytes.NewReader(raw)))
+	if !errors.As(err, &lerr) || pathString(lerr.Path()) != "0/k" {
+		t.Errorf("got %v", err)
+	}
+
+	for i := 1; i < len(raw)-1; i++ {
+		if _, err := v.UnmarshalMsg(raw[:i]); !errors.Is(err, ErrShortBytes) {
+			t.Errorf("len %d: got %v", i, err)
+		}
+	}
+
+	r := NewReader(bytes.NewReader(AppendArrayHeader(nil, 100)))
+	r.SetMaxElements(10)
+	if err := v.DecodeMsg(r); err != ErrLimitExceeded {
+		t.Errorf("got %v; wanted %v", err, ErrLimitExceeded)
+	}
+}
@@ -50,6 +50,9 @@ func popWriter(w io.Writer) *Writer {
 func pushWriter(wr *Writer) {
 	wr.w = nil
 	wr.wloc = 0
+	wr.open = wr.open[:0]
+	wr.flushed = 0
+	wr.maxOpen = 0
 	writerPool.Put(wr)
 }
 
@@ -116,6 +119,17 @@ type Writer struct {
 	w    io.Writer
 	buf  []byte
 	wloc int
+
+	// the containers begun with BeginArray or BeginMap
+	// that haven't ended, and the number of bytes before
+	// buf; everything from the first open container on
+	// stays in buf until it ends, up to maxOpen bytes
+	open    []openContainer
+	flushed int64
+	maxOpen int
+
+	// set by NewAsyncWriter
+	async *asyncWriter
 }
 
 // NewWriter returns a new *Writer.
@@ -164,10 +178,17 @@ func Encode(w io.Writer, e Encodable) error {
 }
 
 func (mw *Writer) flush() error {
+	if len(mw.open) > 0 {
+		return mw.spool()
+	}
 	if mw.wloc == 0 {
 		return nil
 	}
+	if mw.async != nil {
+		return mw.handoff()
+	}
 	n, err := mw.w.Write(mw.buf[:mw.wloc])
+	mw.flushed += int64(n)
 	if err != nil {
 		if n > 0 {
 			mw.wloc = copy(mw.buf, mw.buf[n:mw.wloc])
@@ -179,8 +200,52 @@ func (mw *Writer) flush() error {
 }
 
 // Flush flushes all of the buffered
-// data to the underlying writer.
-func (mw *Writer) Flush() error { return mw.flush() }
+// data to the underlying writer, except
+// for containers that haven't ended.
+// (See BeginArray.) The Flush of a Writer
+// returned by NewAsyncWriter waits for the
+// background writes to finish.
+func (mw *Writer) Flush() error {
+	if err := mw.flush(); err != nil || mw.async == nil {
+		return err
+	}
+	return mw.async.wait()
+}
+
+// spool makes room in the buffer while there are open
+// containers, by flushing the data before them and
+// then growing the buffer if necessary
+func (mw *Writer) spool() error {
+	if keep := int(mw.open[0].pos - mw.flushed); keep > 0 {
+		n, err := mw.w.Write(mw.buf[:keep])
+		mw.wloc = copy(mw.buf, mw.buf[n:mw.wloc])
+		mw.flushed += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	if mw.avail() < max(len(mw.buf)/2, minWriterSize) {
+		return mw.grow(minWriterSize)
+	}
+	return nil
+}
+
+// grow makes room for at least 'n' more bytes in the
+// buffer, which holds open containers, doubling it if
+// possible, but not beyond the limit of SetMaxBuffered
+func (mw *Writer) grow(n int) error {
+	limit := max(mw.maxBuffered(), len(mw.buf))
+	if mw.wloc+n > limit {
+		return errContainerSize
+	}
+	size := min(max(2*len(mw.buf), mw.wloc+n), limit)
+	if size > len(mw.buf) {
+		buf := make([]byte, size)
+		copy(buf, mw.buf[:mw.wloc])
+		mw.buf = buf
+	}
+	return nil
+}
 
 // Buffered returns the number bytes in the write buffer
 func (mw *Writer) Buffered() int { return len(mw.buf) - mw.wloc }
@@ -288,8 +353,15 @@ func (mw *Writer) Write(p []byte) (int, error) {
 		if err := mw.flush(); err != nil {
 			return 0, err
 		}
-		if l > len(mw.buf) {
-			return mw.w.Write(p)
+		if l > mw.avail() {
+			if len(mw.open) == 0 {
+				n, err := mw.w.Write(p)
+				mw.flushed += int64(n)
+				return n, err
+			}
+			if err := mw.grow(l); err != nil {
+				return 0, err
+			}
 		}
 	}
 	mw.wloc += copy(mw.buf[mw.wloc:], p)
@@ -303,9 +375,15 @@ func (mw *Writer) writeString(s string) error {
 		if err := mw.flush(); err != nil {
 			return err
 		}
-		if l > len(mw.buf) {
-			_, err := io.WriteString(mw.w, s)
-			return err
+		if l > mw.avail() {
+			if len(mw.open) == 0 {
+				n, err := io.WriteString(mw.w, s)
+				mw.flushed += int64(n)
+				return err
+			}
+			if err := mw.grow(l); err != nil {
+				return err
+			}
 		}
 	}
 	mw.wloc += copy(mw.buf[mw.wloc:], s)
@@ -317,6 +395,8 @@ func (mw *Writer) Reset(w io.Writer) {
 	mw.buf = mw.buf[:cap(mw.buf)]
 	mw.w = w
 	mw.wloc = 0
+	mw.open = mw.open[:0]
+	mw.flushed = 0
 }
 
 // WriteMapHeader writes a map header of the given
@@ -345,6 +425,134 @@ func (mw *Writer) WriteArrayHeader(sz uint32) error {
 	}
 }
 
+var (
+	errContainerOrder = errors.New("msgp: container ended out of order")
+	errContainerSize  = errors.New("msgp: open containers exceed the Writer's buffer limit")
+)
+
+// defaultMaxBuffered is the default limit
+// on the buffer size of open containers
+const defaultMaxBuffered = 64 << 20
+
+// SetMaxBuffered sets the size that the buffer may grow to while
+// there are open containers begun with BeginArray or BeginMap,
+// which stay in the buffer until they end. Writes that would need
+// a larger buffer fail. The default is 64MiB; 0 restores it.
+func (mw *Writer) SetMaxBuffered(n int) { mw.maxOpen = n }
+
+func (mw *Writer) maxBuffered() int {
+	if mw.maxOpen <= 0 {
+		return defaultMaxBuffered
+	}
+	return mw.maxOpen
+}
+
+// openContainer is a container begun with
+// BeginArray or BeginMap that hasn't ended
+type openContainer struct {
+	pos     int64 // of the header in the output
+	scanned int64 // the contents before it have been counted
+	count   containerCount
+}
+
+// Container is an array or a map of unknown
+// size, begun with BeginArray or BeginMap.
+type Container struct {
+	mw  *Writer
+	pos int64
+}
+
+// BeginArray begins an array whose size doesn't
+// need to be known in advance. Write the elements
+// as usual, and then call End on the returned Container,
+// which writes the size into the array header. Arrays
+// and maps begun this way can be nested, and must be ended
+// in the reverse order that they were begun.
+//
+// MessagePack has no way to end a container other than by
+// its size, so the outermost container that hasn't ended
+// stays in the buffer, which grows to hold it, rather than
+// being written out by Flush. The buffer is limited to 64MiB
+// by default (see SetMaxBuffered); writes that would exceed
+// the limit fail, so larger arrays need a known size.
+//
+// The header is always an array32 (5 bytes), even if the
+// array turns out to be small enough for a shorter one,
+// so prefer WriteArrayHeader if the size is known.
+func (mw *Writer) BeginArray() (Container, error) { return mw.begin(marray32) }
+
+// BeginMap begins a map whose size doesn't need
+// to be known in advance, in the same manner as
+// BeginArray. Write the keys and values as usual, and
+// then call End on the returned Container. The header is
+// always a map32 (5 bytes).
+func (mw *Writer) BeginMap() (Container, error) { return mw.begin(mmap32) }
+
+func (mw *Writer) begin(lead byte) (Container, error) {
+	if len(mw.open) > 0 {
+		// the new container is an element of the
+		// enclosing one, which doesn't count its contents
+		if err := mw.scanOpen(); err != nil {
+			return Container{}, err
+		}
+	}
+	o, err := mw.require(5)
+	if err != nil {
+		return Container{}, err
+	}
+	mw.buf[o] = lead
+	pos := mw.flushed + int64(o)
+	if len(mw.open) > 0 {
+		mw.open[len(mw.open)-1].count.add(0)
+	}
+	mw.open = append(mw.open, openContainer{pos: pos, scanned: pos + 5})
+	return Container{mw: mw, pos: pos}, nil
+}
+
+// scanOpen counts the contents of the innermost
+// open container that have been written since
+// it was last scanned
+func (mw *Writer) scanOpen() error {
+	c := &mw.open[len(mw.open)-1]
+	if err := c.count.scan(mw.buf[c.scanned-mw.flushed : mw.wloc]); err != nil {
+		return err
+	}
+	c.scanned = mw.flushed + int64(mw.wloc)
+	return nil
+}
+
+// End writes the number of elements written since the
+// container began into its header. It returns an error if
+// the container isn't the most recently begun one that
+// hasn't ended, or if its contents aren't valid
+// (for example, a map with a key but no value).
+//
+// Each byte of the contents is only examined once,
+// by the innermost container that holds it.
+func (c Container) End() error {
+	mw := c.mw
+	if mw == nil || len(mw.open) == 0 || mw.open[len(mw.open)-1].pos != c.pos {
+		return errContainerOrder
+	}
+	err := mw.scanOpen()
+	oc := mw.open[len(mw.open)-1]
+	mw.open = mw.open[:len(mw.open)-1]
+	if len(mw.open) > 0 {
+		// the enclosing container skips this one
+		mw.open[len(mw.open)-1].scanned = mw.flushed + int64(mw.wloc)
+	}
+	if err != nil {
+		return err
+	}
+	hdr := mw.buf[oc.pos-mw.flushed:]
+	sz, err := oc.count.size(hdr[0])
+	if err != nil {
+		return err
+	}
+	big.PutUint32(hdr[1:], sz)
+	return nil
+}
+
 // WriteNil writes a nil byte to the buffer
 func (mw *Writer) WriteNil() error {
 	return mw.push(mnil)
@@ -482,6 +690,42 @@ func (mw *Writer) WriteBytesHeader(sz uint32) error {
 	}
 }
 
+// WriteBytesFrom writes a MessagePack 'bin' object
+// with the next 'sz' bytes read from 'r' as its contents,
+// without holding all of them in memory. If 'r' ends early,
+// WriteBytesFrom returns io.ErrUnexpectedEOF, and the
+// object written so far is incomplete.
+func (mw *Writer) WriteBytesFrom(r io.Reader, sz uint32) error {
+	if err := mw.WriteBytesHeader(sz); err != nil {
+		return err
+	}
+	left, empty := int(sz), 0
+	for left > 0 {
+		if mw.avail() == 0 {
+			if err := mw.flush(); err != nil {
+				return err
+			}
+		}
+		n, err := r.Read(mw.buf[mw.wloc : mw.wloc+min(mw.avail(), left)])
+		mw.wloc += n
+		left -= n
+		if n > 0 {
+			empty = 0
+		} else if err == nil {
+			if empty++; empty >= maxEmptyReads {
+				return io.ErrNoProgress
+			}
+		}
+		if err == io.EOF && left > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
 // WriteBool writes a bool to the writer
 func (mw *Writer) WriteBool(b bool) error {
 	if b {
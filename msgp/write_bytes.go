@@ -59,6 +59,122 @@ func AppendArrayHeader(b []byte, sz uint32) []byte {
 	}
 }
 
+// AppendBeginArray appends the header of an array
+// whose size doesn't need to be known in advance, and
+// returns the extended slice and the offset of the header.
+// Append the elements as usual, and then call AppendEnd
+// with the offset to write the size into the header.
+// Arrays and maps begun this way can be nested, and must
+// be ended in the reverse order that they were begun.
+//
+// The header is always an array32 (5 bytes), even if the
+// array turns out to be small enough for a shorter one,
+// so prefer AppendArrayHeader if the size is known.
+func AppendBeginArray(b []byte) (o []byte, start int) {
+	return append(b, marray32, 0, 0, 0, 0), len(b)
+}
+
+// AppendBeginMap appends the header of a map whose
+// size doesn't need to be known in advance, in the same
+// manner as AppendBeginArray. The header is always
+// a map32 (5 bytes).
+func AppendBeginMap(b []byte) (o []byte, start int) {
+	return append(b, mmap32, 0, 0, 0, 0), len(b)
+}
+
+// AppendEnd writes the number of elements appended to 'b'
+// after the array or map header at 'start' into the header.
+// It returns an error if there is no such header at 'start',
+// or if the contents of the container aren't valid (for
+// example, a map with a key but no value).
+//
+// AppendEnd examines all of the contents, including those
+// of nested containers, which were examined when they ended,
+// so deeply nested containers of unknown size are costly;
+// a Writer keeps track of the contents as they are written.
+func AppendEnd(b []byte, start int) ([]byte, error) {
+	if start < 0 || len(b)-start < 5 || (b[start] != marray32 && b[start] != mmap32) {
+		return b, errContainerOrder
+	}
+	return b, patchContainer(b[start:])
+}
+
+// patchContainer writes the size of the array
+// or map whose header starts 'b' into the header;
+// the container extends to the end of 'b'
+func patchContainer(b []byte) error {
+	var c containerCount
+	if err := c.scan(b[5:]); err != nil {
+		return err
+	}
+	sz, err := c.size(b[0])
+	if err != nil {
+		return err
+	}
+	big.PutUint32(b[1:], sz)
+	return nil
+}
+
+var (
+	errMissingValue    = errors.New("msgp: map key without a value")
+	errIncompleteValue = errors.New("msgp: container ended inside a value")
+)
+
+// containerCount counts the elements of a container
+// of unknown size as its contents are scanned
+type containerCount struct {
+	n       uint64 // elements, counting keys and values separately
+	pending uint64 // values that the last element still needs
+}
+
+// scan counts the values encoded in 'b',
+// which may be followed by the rest of the
+// last one, but must not end inside an encoding
+func (c *containerCount) scan(b []byte) error {
+	for len(b) > 0 {
+		sz, children, err := getSize(b)
+		if err != nil {
+			return err
+		}
+		if uintptr(len(b)) < sz {
+			return ErrShortBytes
+		}
+		c.add(uint64(children))
+		b = b[sz:]
+	}
+	return nil
+}
+
+// add counts a value followed by
+// 'children' nested values
+func (c *containerCount) add(children uint64) {
+	if c.pending == 0 {
+		c.n++
+	} else {
+		c.pending--
+	}
+	c.pending += children
+}
+
+// size returns the size to write into a
+// header with the lead byte 'lead'
+func (c *containerCount) size(lead byte) (uint32, error) {
+	if c.pending > 0 {
+		return 0, errIncompleteValue
+	}
+	n := c.n
+	if lead == mmap32 {
+		if n%2 != 0 {
+			return 0, errMissingValue
+		}
+		n /= 2
+	}
+	if n > math.MaxUint32 {
+		return 0, ErrLimitExceeded
+	}
+	return uint32(n), nil
+}
+
 // AppendNil appends a 'nil' byte to the slice
 func AppendNil(b []byte) []byte { return append(b, mnil) }
 
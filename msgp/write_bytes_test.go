@@ -96,6 +96,50 @@ func BenchmarkAppendArrayHeader(b *testing.B) {
 	}
 }
 
+func TestAppendBeginContainer(t *testing.T) {
+	b := AppendString(nil, "before")
+	b, arr := AppendBeginArray(b)
+	for i := range 20 {
+		var m int
+		b, m = AppendBeginMap(b)
+		b = AppendString(b, "i")
+		b = AppendInt(b, i)
+		var err error
+		if b, err = AppendEnd(b, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := AppendEnd(b, arr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []any
+	for i := range 20 {
+		want = append(want, map[string]any{"i": int64(i)})
+	}
+	_, rest, err := ReadStringBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, rest, err := ReadIntfBytes(rest)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("%v; %d bytes left", err, len(rest))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; wanted %v", got, want)
+	}
+
+	b, m := AppendBeginMap(nil)
+	b = AppendString(b, "key")
+	if _, err := AppendEnd(b, m); err != errMissingValue {
+		t.Errorf("got %v; wanted %v", err, errMissingValue)
+	}
+	if _, err := AppendEnd(b, m+1); err != errContainerOrder {
+		t.Errorf("got %v; wanted %v", err, errContainerOrder)
+	}
+}
+
 func TestAppendBytesHeader(t *testing.T) {
 	szs := []uint32{0, 1, uint32(tint8), uint32(tint16), tuint32, math.MaxUint32}
 	var buf bytes.Buffer
@@ -2,9 +2,12 @@ package msgp
 
 import (
 	"bytes"
+	"io"
 	"math"
 	"math/rand"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -388,6 +391,169 @@ func TestWriteBytes(t *testing.T) {
 	}
 }
 
+func TestWriteBytesFrom(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriterSize(&buf, 64)
+	for _, size := range []int{0, 1, 225, 100000} {
+		buf.Reset()
+		bts := RandBytes(size)
+		if err := wr.WriteBytesFrom(iotest.OneByteReader(bytes.NewReader(bts)), uint32(size)); err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), AppendBytes(nil, bts)) {
+			t.Errorf("size %d: encodings differ", size)
+		}
+	}
+
+	if err := wr.WriteBytesFrom(bytes.NewReader(make([]byte, 10)), 11); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v; wanted %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestBeginContainer(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriterSize(&buf, 18)
+	long := strings.Repeat("x", 100)
+	wr.WriteString("before")
+	arr, err := wr.BeginArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 300 {
+		m, err := wr.BeginMap()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wr.WriteString("i")
+		wr.WriteInt(i)
+		wr.WriteString("s")
+		wr.WriteString(long)
+		if i == 0 {
+			// the data before the array
+			// is all that can be flushed
+			if err := wr.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), AppendString(nil, "before")) {
+				t.Fatalf("flushed %x", buf.Bytes())
+			}
+		}
+		if err := m.End(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wr.WriteBytes(make([]byte, 5000))
+	if err := arr.End(); err != nil {
+		t.Fatal(err)
+	}
+	wr.WriteString("after")
+	if err := wr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.Bytes()
+	s, rest, err := ReadStringBytes(got)
+	if err != nil || s != "before" {
+		t.Fatalf("got %q (%v); wanted \"before\"", s, err)
+	}
+	sz, rest, err := ReadArrayHeaderBytes(rest)
+	if err != nil || sz != 301 {
+		t.Fatalf("got %d elements (%v); wanted 301", sz, err)
+	}
+	for i := range 300 {
+		var msz uint32
+		msz, rest, err = ReadMapHeaderBytes(rest)
+		if err != nil || msz != 2 {
+			t.Fatalf("map %d: got %d entries (%v)", i, msz, err)
+		}
+		for range 4 {
+			if rest, err = Skip(rest); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if rest, err = Skip(rest); err != nil {
+		t.Fatal(err)
+	}
+	if s, _, err = ReadStringBytes(rest); err != nil || s != "after" {
+		t.Fatalf("got %q (%v); wanted \"after\"", s, err)
+	}
+
+	// out of order
+	wr.Reset(&buf)
+	outer, _ := wr.BeginArray()
+	inner, _ := wr.BeginMap()
+	if err := outer.End(); err != errContainerOrder {
+		t.Errorf("got %v; wanted %v", err, errContainerOrder)
+	}
+	wr.WriteString("key")
+	if err := inner.End(); err != errMissingValue {
+		t.Errorf("got %v; wanted %v", err, errMissingValue)
+	}
+	if err := inner.End(); err != errContainerOrder {
+		t.Errorf("ended twice: got %v; wanted %v", err, errContainerOrder)
+	}
+
+	// containers inside values of known size, and values
+	// of known size inside containers, are counted
+	buf.Reset()
+	wr.Reset(&buf)
+	outer, _ = wr.BeginArray()
+	wr.WriteArrayHeader(2)
+	wr.WriteInt(1)
+	inner, _ = wr.BeginMap()
+	wr.WriteString("a")
+	wr.WriteMapHeader(1)
+	wr.WriteString("b")
+	wr.WriteArrayHeader(0)
+	inner.End()
+	wr.WriteExtensionRaw(9, make([]byte, 100))
+	if err := outer.End(); err != nil {
+		t.Fatal(err)
+	}
+	wr.Flush()
+	if s, want := Diag(buf.Bytes()), `[[1, {"a": {"b": []}}_32], ext(9, h'`; !strings.HasPrefix(s, want) || !strings.HasSuffix(s, "')]_32") {
+		t.Errorf("got %s", s)
+	}
+
+	// values of known size that aren't complete
+	wr.Reset(&buf)
+	outer, _ = wr.BeginArray()
+	wr.WriteArrayHeader(2)
+	wr.WriteInt(1)
+	if err := outer.End(); err != errIncompleteValue {
+		t.Errorf("got %v; wanted %v", err, errIncompleteValue)
+	}
+
+	// the buffer is limited
+	wr = NewWriterSize(&buf, 64)
+	wr.SetMaxBuffered(1000)
+	outer, _ = wr.BeginArray()
+	for range 9 {
+		if err := wr.WriteString(long); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wr.WriteString(long); err != errContainerSize {
+		t.Errorf("got %v; wanted %v", err, errContainerSize)
+	}
+	wr.Reset(&buf)
+	outer, _ = wr.BeginArray()
+	if err := wr.WriteExtension(&RawExtension{Type: 9, Data: make([]byte, 1000)}); err != errContainerSize {
+		t.Errorf("got %v; wanted %v", err, errContainerSize)
+	}
+	wr.Reset(&buf)
+	wr.SetMaxBuffered(0)
+	outer, _ = wr.BeginArray()
+	wr.WriteExtension(&RawExtension{Type: 9, Data: make([]byte, 5000)})
+	if err := outer.End(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func benchwrBytes(size uint32, b *testing.B) {
 	bts := RandBytes(int(size))
 	wr := NewWriter(Nowhere)